@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// auditCommandWidth is how much of a remote command the audit table shows.
+const auditCommandWidth = 60
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the remote commands labman has run",
+	Long: `Every command labman runs on a server (workflow steps, sudo commands, 'labman
+ssh' sessions, checksums after a copy) is appended to ~/.labman/audit.log as a
+line of JSON: when it ran, the local user, host and remote user, the labman
+command it belonged to, the remote command, its exit code and how long it took.
+The log is rotated at 10 MiB and the last 5 files are kept. Set audit_log in
+defaults to move it, or to none to turn auditing off.
+
+Examples:
+  labman audit                          # everything, oldest first
+  labman audit --host nas --since 24h   # one host, last day
+  labman audit --failed --since 2025-06-01
+  labman audit --json | jq '.[] | select(.sudo)'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		host, _ := cmd.Flags().GetString("host")
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		failed, _ := cmd.Flags().GetBool("failed")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		path, err := auditLogPath(cfg)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("auditing is turned off (audit_log: none)")
+		}
+
+		filter := auditFilter{failed: failed}
+		if sinceFlag != "" {
+			if filter.since, err = parseSince(sinceFlag, time.Now()); err != nil {
+				return err
+			}
+		}
+		if host != "" {
+			filter.hosts = []string{host, cfg.Lookup(host).Host}
+		}
+
+		records, err := remote.NewAuditLog(path).Records()
+		if err != nil {
+			return err
+		}
+		records = filter.apply(records)
+
+		if asJSON {
+			data, err := json.MarshalIndent(records, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			return nil
+		}
+
+		printBanner(cmd)
+		if len(records) == 0 {
+			printSection(cmd, "AUDIT LOG", fmt.Sprintf("No matching commands in %s.", path))
+			return nil
+		}
+		printSection(cmd, "AUDIT LOG", formatAuditTable(records))
+		return nil
+	},
+}
+
+// initAuditLog points the remote package at the configured audit log. A
+// log that cannot be written is reported once and never fails a command.
+func initAuditLog() {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	path, err := auditLogPath(cfg)
+	if err != nil || path == "" {
+		remote.SetAuditLog(nil)
+		return
+	}
+
+	log := remote.NewAuditLog(path)
+	var once sync.Once
+	log.OnError = func(err error) {
+		once.Do(func() { fmt.Fprintf(os.Stderr, "Warning: audit log: %v\n", err) })
+	}
+	remote.SetAuditLog(log)
+}
+
+// auditLogPath resolves audit_log, returning "" when auditing is off.
+func auditLogPath(cfg *config.Config) (string, error) {
+	switch path := cfg.Defaults.AuditLog; path {
+	case "none":
+		return "", nil
+	case "":
+		return remote.DefaultAuditLogPath()
+	default:
+		return config.ExpandPath(path), nil
+	}
+}
+
+// auditFilter selects records for 'labman audit'.
+type auditFilter struct {
+	// hosts matches a record's session alias or host address
+	hosts  []string
+	since  time.Time
+	failed bool
+}
+
+func (f auditFilter) apply(records []remote.AuditRecord) []remote.AuditRecord {
+	kept := []remote.AuditRecord{}
+	for _, record := range records {
+		if f.matches(record) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+func (f auditFilter) matches(record remote.AuditRecord) bool {
+	if f.failed && !record.Failed() {
+		return false
+	}
+	if !f.since.IsZero() && record.Time.Before(f.since) {
+		return false
+	}
+	if len(f.hosts) == 0 {
+		return true
+	}
+	for _, host := range f.hosts {
+		if host != "" && (host == record.Session || host == record.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSince accepts a duration back from now (24h, 90m) or a date or
+// timestamp (2025-06-01, 2025-06-01T15:04:05Z).
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a duration such as 24h, a date such as 2025-06-01, or an RFC 3339 time", value)
+}
+
+// formatAuditTable renders one aligned line per record.
+func formatAuditTable(records []remote.AuditRecord) string {
+	headers := []string{"TIME", "HOST", "USER", "LABMAN", "EXIT", "DURATION", "COMMAND"}
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		host := record.Session
+		if host == "" {
+			host = record.Host
+		}
+		rows = append(rows, []string{
+			record.Time.Local().Format("2006-01-02 15:04:05"),
+			host,
+			record.LocalUser + "->" + record.RemoteUser,
+			strings.TrimPrefix(record.Labman, "labman "),
+			describeExit(record),
+			record.Duration().Round(time.Millisecond).String(),
+			describeAuditCommand(record),
+		})
+	}
+
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = len(header)
+		for _, row := range rows {
+			widths[i] = max(widths[i], len(row[i]))
+		}
+	}
+
+	lines := make([]string, 0, len(rows)+1)
+	for _, row := range append([][]string{headers}, rows...) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i == len(row)-1 {
+				cells[i] = cell
+				continue
+			}
+			cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		lines = append(lines, strings.Join(cells, "  "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeExit shows the exit code, or "error" for a command that never
+// reported one.
+func describeExit(record remote.AuditRecord) string {
+	if record.ExitCode == -1 {
+		return "error"
+	}
+	return fmt.Sprint(record.ExitCode)
+}
+
+// describeAuditCommand flattens a command onto one line and shortens it.
+func describeAuditCommand(record remote.AuditRecord) string {
+	command := strings.Join(strings.Fields(record.Command), " ")
+	if command == "" {
+		command = "(interactive shell)"
+	}
+	if record.Sudo {
+		command = "sudo " + command
+	}
+	if len(command) > auditCommandWidth {
+		command = command[:auditCommandWidth-3] + "..."
+	}
+	return command
+}
+
+func init() {
+	cobra.OnInitialize(initAuditLog)
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String("host", "", "only commands run on this alias or host")
+	auditCmd.Flags().String("since", "", "only commands since a duration ago (24h) or a date (2025-06-01)")
+	auditCmd.Flags().Bool("failed", false, "only commands that exited non-zero or did not finish")
+	auditCmd.Flags().Bool("json", false, "print the matching records as a JSON array")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "90m", want: now.Add(-90 * time.Minute)},
+		{value: "2025-06-01T08:30:00Z", want: time.Date(2025, 6, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2025-06-01", want: time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)},
+		{value: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSince(tt.value, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Fatalf("parseSince(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	now := time.Now()
+	records := []remote.AuditRecord{
+		{Time: now.Add(-48 * time.Hour), Session: "nas", Host: "10.0.0.5", Command: "uptime"},
+		{Time: now.Add(-time.Hour), Session: "nas", Host: "10.0.0.5", Command: "reboot", ExitCode: 1},
+		{Time: now.Add(-time.Hour), Session: "pi", Host: "10.0.0.7", Command: "uptime", ExitCode: -1, Error: "connection lost"},
+	}
+	tests := []struct {
+		name   string
+		filter auditFilter
+		want   []string
+	}{
+		{name: "all", filter: auditFilter{}, want: []string{"nas uptime", "nas reboot", "pi uptime"}},
+		{name: "alias", filter: auditFilter{hosts: []string{"nas"}}, want: []string{"nas uptime", "nas reboot"}},
+		{name: "address", filter: auditFilter{hosts: []string{"10.0.0.7"}}, want: []string{"pi uptime"}},
+		{name: "since", filter: auditFilter{since: now.Add(-24 * time.Hour)}, want: []string{"nas reboot", "pi uptime"}},
+		{name: "failed", filter: auditFilter{failed: true, hosts: []string{"pi"}}, want: []string{"pi uptime"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, record := range tt.filter.apply(records) {
+				got = append(got, record.Session+" "+record.Command)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeAuditCommand(t *testing.T) {
+	long := remote.AuditRecord{Command: "set -e\n  apt-get update\n  " + strings.Repeat("x", 80), Sudo: true}
+	got := describeAuditCommand(long)
+	if len(got) != auditCommandWidth || !strings.HasPrefix(got, "sudo set -e apt-get update") || !strings.HasSuffix(got, "...") {
+		t.Errorf("unexpected command column %q", got)
+	}
+	if got := describeAuditCommand(remote.AuditRecord{}); got != "(interactive shell)" {
+		t.Errorf("unexpected shell column %q", got)
+	}
+}
@@ -4,7 +4,9 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -24,8 +26,8 @@ inspect state, and run other management tasks against your remote server.`,
 		printBanner(cmd)
 		printSection(cmd, "CLUSTER", "Use subcommands such as 'labman cluster info'")
 	},
-	PersistentPreRunE: requireSession,
-	PersistentPostRun: cleanupSession,
+	PersistentPreRunE: requireExecutor,
+	PersistentPostRun: cleanupExecutor,
 }
 
 var clusterInfoCmd = &cobra.Command{
@@ -34,12 +36,14 @@ var clusterInfoCmd = &cobra.Command{
 	Long: `Runs 'kubectl cluster-info dump' on the remote host to print detailed cluster
 state, making it easy to inspect components from your local terminal.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		infoClient := remote.Current()
+		infoClient := currentExecutor()
 		if infoClient == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
-		output, err := infoClient.Run("kubectl cluster-info dump")
+		ctx := commandContext(cmd)
+
+		output, err := infoClient.RunIdempotent(ctx, "kubectl cluster-info dump")
 		if err != nil {
 			return fmt.Errorf("failed to run command: %w", err)
 		}
@@ -54,11 +58,13 @@ var clusterStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Summarize MicroK8s readiness and control-plane health",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
+		ctx := commandContext(cmd)
+
 		steps := []struct {
 			Title   string
 			Command string
@@ -69,9 +75,15 @@ var clusterStatusCmd = &cobra.Command{
 		}
 
 		for _, step := range steps {
-			output, err := client.Run(step.Command)
+			output, err := client.RunIdempotent(ctx, step.Command)
 			if err != nil {
-				return fmt.Errorf("%s failed: %w", strings.ToLower(step.Title), err)
+				var cmdErr *remote.CommandError
+				if !errors.As(err, &cmdErr) || cmdErr.Result.ExitCode < 0 || cmdErr.Result.CommandNotFound() {
+					return fmt.Errorf("%s failed: %w", strings.ToLower(step.Title), err)
+				}
+				// kubectl exits non-zero for deprecated or partially failing
+				// queries while still printing something worth showing
+				output = fmt.Sprintf("%s\n(exited with status %d)", strings.TrimSpace(output), cmdErr.Result.ExitCode)
 			}
 			printSection(cmd, step.Title, output)
 		}
@@ -94,11 +106,13 @@ var clusterWorkloadsCmd = &cobra.Command{
 			logTail = 20
 		}
 
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
+		ctx := commandContext(cmd)
+
 		nsArg := namespaceArg(namespace)
 		selectorArg := selectorArg(selector)
 
@@ -109,20 +123,20 @@ var clusterWorkloadsCmd = &cobra.Command{
 			"--field-selector=status.phase!=Running,status.phase!=Succeeded",
 			"--sort-by=.status.containerStatuses[0].restartCount",
 		)
-		nonRunning, err := client.Run(nonRunningCmd)
+		nonRunning, err := client.RunIdempotent(ctx, nonRunningCmd)
 		if err != nil {
 			return fmt.Errorf("list non-running pods: %w", err)
 		}
 		printSection(cmd, "NON-RUNNING PODS", nonRunning)
 
 		topCmd := joinCommand("microk8s kubectl top pods", nsArg, selectorArg)
-		topOutput, err := client.Run(topCmd)
+		topOutput, err := client.RunIdempotent(ctx, topCmd)
 		if err != nil {
 			topOutput = fmt.Sprintf("kubectl top pods failed: %v", err)
 		}
 		printSection(cmd, "POD RESOURCE USAGE", topOutput)
 
-		crashPods, err := fetchCrashLoopPods(client, nsArg, selectorArg, maxPods)
+		crashPods, err := fetchCrashLoopPods(ctx, client, nsArg, selectorArg, maxPods)
 		if err != nil {
 			printSection(cmd, "CRASHLOOP PODS", fmt.Sprintf("failed to discover CrashLoopBackOff pods: %v", err))
 			return nil
@@ -145,12 +159,12 @@ var clusterWorkloadsCmd = &cobra.Command{
 			fmt.Fprintf(out, "--- %s/%s ---\n", pod.Namespace, pod.Name)
 			logCmd := joinCommand(
 				"microk8s kubectl logs",
-				"-n "+shellQuote(pod.Namespace),
-				shellQuote(pod.Name),
+				"-n "+remote.ShellQuote(pod.Namespace),
+				remote.ShellQuote(pod.Name),
 				"--all-containers",
 				fmt.Sprintf("--tail=%d", logTail),
 			)
-			if err := client.RunStream(logCmd, out); err != nil {
+			if err := client.RunStreamContext(ctx, logCmd, out); err != nil {
 				fmt.Fprintf(out, "failed to fetch logs: %v\n", err)
 			}
 			fmt.Fprintln(out)
@@ -164,11 +178,13 @@ var clusterBackupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Create or list Velero/etcd snapshots",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
+		ctx := commandContext(cmd)
+
 		listOnly, _ := cmd.Flags().GetBool("list")
 		name, _ := cmd.Flags().GetString("name")
 		skipVelero, _ := cmd.Flags().GetBool("skip-velero")
@@ -187,22 +203,22 @@ var clusterBackupCmd = &cobra.Command{
 		}
 
 		if !skipVelero {
-			veleroCmd := fmt.Sprintf("microk8s velero create backup %s --ttl 720h", shellQuote(name))
-			output, err := client.Run(veleroCmd)
+			veleroCmd := fmt.Sprintf("microk8s velero create backup %s --ttl 720h", remote.ShellQuote(name))
+			output, err := client.RunContext(remote.Mutating(ctx, "Create Velero backup"), veleroCmd)
 			if err != nil {
 				return fmt.Errorf("velero backup failed: %w", err)
 			}
-			printSection(cmd, "VELERO BACKUP", output)
+			printSection(cmd, "VELERO BACKUP", outcome(output, "Would create Velero backup "+name))
 		}
 
 		if !skipEtcd {
 			etcdPath := fmt.Sprintf("/var/snap/microk8s/common/var/backup/labman-etcd-%s.db", time.Now().Format("20060102-150405"))
-			etcdCmd := fmt.Sprintf("sudo mkdir -p /var/snap/microk8s/common/var/backup && sudo microk8s etcd snapshot save %s", shellQuote(etcdPath))
-			output, err := client.Run(etcdCmd)
+			etcdCmd := fmt.Sprintf("mkdir -p /var/snap/microk8s/common/var/backup && microk8s etcd snapshot save %s", remote.ShellQuote(etcdPath))
+			output, err := client.RunSudo(remote.Mutating(ctx, "Save etcd snapshot"), etcdCmd)
 			if err != nil {
 				return fmt.Errorf("etcd snapshot failed: %w", err)
 			}
-			printSection(cmd, "ETCD SNAPSHOT", output+"\nSaved to: "+etcdPath)
+			printSection(cmd, "ETCD SNAPSHOT", outcome(output+"\nSaved to: "+etcdPath, "Would save an etcd snapshot to "+etcdPath))
 		}
 
 		return nil
@@ -218,32 +234,36 @@ var clusterRestartCmd = &cobra.Command{
 		mode, _ := cmd.Flags().GetString("type")
 		waitReady, _ := cmd.Flags().GetBool("wait")
 
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
+		ctx := commandContext(cmd)
+
 		var restartCmd string
 		switch mode {
 		case "addon":
 			restartCmd = strings.Join([]string{
-				"sudo microk8s disable " + shellQuote(target),
-				"sudo microk8s enable " + shellQuote(target),
+				"microk8s disable " + remote.ShellQuote(target),
+				"microk8s enable " + remote.ShellQuote(target),
 			}, " && ")
 		case "service":
-			restartCmd = "sudo systemctl restart " + shellQuote(target)
+			restartCmd = "systemctl restart " + remote.ShellQuote(target)
 		default:
 			return fmt.Errorf("unknown restart type %q (use 'addon' or 'service')", mode)
 		}
 
-		if _, err := client.Run(restartCmd); err != nil {
+		if _, err := client.RunSudo(remote.Mutating(ctx, "Restart "+mode), restartCmd); err != nil {
 			return fmt.Errorf("restart failed: %w", err)
 		}
 
-		printSection(cmd, "RESTART", fmt.Sprintf("Successfully restarted %s (%s)", target, mode))
+		printSection(cmd, "RESTART", outcome(
+			fmt.Sprintf("Successfully restarted %s (%s)", target, mode),
+			fmt.Sprintf("Would restart %s (%s)", target, mode)))
 
 		if waitReady && mode == "addon" {
-			status, err := client.Run("microk8s status --wait-ready")
+			status, err := client.RunContext(ctx, "microk8s status --wait-ready")
 			if err != nil {
 				return fmt.Errorf("microk8s did not become ready: %w", err)
 			}
@@ -274,20 +294,27 @@ func init() {
 
 	clusterRestartCmd.Flags().String("type", "addon", "what to restart: addon or service")
 	clusterRestartCmd.Flags().Bool("wait", true, "wait for microk8s to report ready after restarting an addon")
+
+	declareSteps(clusterCmd)
+	declareSteps(clusterInfoCmd)
+	declareSteps(clusterStatusCmd)
+	declareSteps(clusterWorkloadsCmd)
+	declareSteps(clusterBackupCmd, "Create Velero backup", "Save etcd snapshot")
+	declareSteps(clusterRestartCmd, "Restart addon", "Restart service")
 }
 
 func namespaceArg(namespace string) string {
 	if namespace == "" {
 		return "-A"
 	}
-	return "-n " + shellQuote(namespace)
+	return "-n " + remote.ShellQuote(namespace)
 }
 
 func selectorArg(selector string) string {
 	if selector == "" {
 		return ""
 	}
-	return "--selector=" + shellQuote(selector)
+	return "--selector=" + remote.ShellQuote(selector)
 }
 
 type podRef struct {
@@ -313,9 +340,9 @@ type kubernetesPodList struct {
 	} `json:"items"`
 }
 
-func fetchCrashLoopPods(client *remote.SSHSession, nsArg, selectorArg string, limit int) ([]podRef, error) {
+func fetchCrashLoopPods(ctx context.Context, client remote.Executor, nsArg, selectorArg string, limit int) ([]podRef, error) {
 	jsonCmd := joinCommand("microk8s kubectl get pods", nsArg, selectorArg, "-o json") + " 2>/dev/null"
-	raw, err := client.Run(jsonCmd)
+	raw, err := client.RunIdempotent(ctx, jsonCmd)
 	if err != nil {
 		return nil, err
 	}
@@ -341,14 +368,15 @@ func fetchCrashLoopPods(client *remote.SSHSession, nsArg, selectorArg string, li
 	return pods, nil
 }
 
-func showBackupInventory(cmd *cobra.Command, client *remote.SSHSession) error {
-	velero, err := client.Run("microk8s velero backup get")
+func showBackupInventory(cmd *cobra.Command, client remote.Executor) error {
+	ctx := commandContext(cmd)
+	velero, err := client.RunIdempotent(ctx, "microk8s velero backup get")
 	if err != nil {
 		velero = fmt.Sprintf("velero backup listing failed: %v", err)
 	}
 	printSection(cmd, "VELERO BACKUPS", velero)
 
-	etcd, err := client.Run("sudo microk8s etcd snapshot list")
+	etcd, err := client.RunSudo(ctx, "microk8s etcd snapshot list")
 	if err != nil {
 		etcd = fmt.Sprintf("etcd snapshot listing failed: %v", err)
 	}
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
 )
 
 func TestRootCmd(t *testing.T) {
@@ -32,6 +34,28 @@ func TestRootCmd(t *testing.T) {
 			t.Error("rootCmd should have --config flag")
 		}
 	})
+
+	t.Run("has host flag", func(t *testing.T) {
+		if rootCmd.PersistentFlags().Lookup("host") == nil {
+			t.Error("rootCmd should have --host flag")
+		}
+	})
+
+	t.Run("has credential-store flag", func(t *testing.T) {
+		if rootCmd.PersistentFlags().Lookup("credential-store") == nil {
+			t.Error("rootCmd should have --credential-store flag")
+		}
+	})
+
+	t.Run("has timeout flag", func(t *testing.T) {
+		flag := rootCmd.PersistentFlags().Lookup("timeout")
+		if flag == nil {
+			t.Fatal("rootCmd should have --timeout flag")
+		}
+		if flag.DefValue != "0s" {
+			t.Errorf("--timeout default = %q, want %q", flag.DefValue, "0s")
+		}
+	})
 }
 
 func TestClusterCmd(t *testing.T) {
@@ -129,18 +153,20 @@ func TestSessionCmd(t *testing.T) {
 		}
 	})
 
-	t.Run("has drop subcommand", func(t *testing.T) {
-		found := false
-		for _, cmd := range sessionCmd.Commands() {
-			if cmd.Use == "drop" {
-				found = true
-				break
+	for _, name := range []string{"drop", "list", "extend"} {
+		t.Run("has "+name+" subcommand", func(t *testing.T) {
+			found := false
+			for _, cmd := range sessionCmd.Commands() {
+				if cmd.Name() == name {
+					found = true
+					break
+				}
 			}
-		}
-		if !found {
-			t.Error("sessionCmd should have 'drop' subcommand")
-		}
-	})
+			if !found {
+				t.Errorf("sessionCmd should have '%s' subcommand", name)
+			}
+		})
+	}
 }
 
 func TestLoginCmd(t *testing.T) {
@@ -198,6 +224,12 @@ func TestConfigCmd(t *testing.T) {
 		}
 	})
 
+	t.Run("show has effective flag", func(t *testing.T) {
+		if configShowCmd.Flags().Lookup("effective") == nil {
+			t.Error("configShowCmd should have --effective flag")
+		}
+	})
+
 	t.Run("has validate subcommand", func(t *testing.T) {
 		found := false
 		for _, cmd := range configCmd.Commands() {
@@ -240,6 +272,30 @@ func TestShellCmd(t *testing.T) {
 	})
 }
 
+func TestHostsCmd(t *testing.T) {
+	t.Run("has trust, forget and show subcommands", func(t *testing.T) {
+		for _, name := range []string{"trust", "forget", "show"} {
+			found := false
+			for _, cmd := range hostsCmd.Commands() {
+				if cmd.Name() == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("hostsCmd should have %q subcommand", name)
+			}
+		}
+	})
+
+	t.Run("trust has yes flag", func(t *testing.T) {
+		flag := hostsTrustCmd.Flags().Lookup("yes")
+		if flag == nil {
+			t.Error("hostsTrustCmd should have --yes flag")
+		}
+	})
+}
+
 func TestClusterWorkloadsCmd(t *testing.T) {
 	t.Run("has namespace flag", func(t *testing.T) {
 		flag := clusterWorkloadsCmd.Flags().Lookup("namespace")
@@ -347,6 +403,70 @@ func TestSessionStatusCmd(t *testing.T) {
 	})
 }
 
+func TestSSHCmd(t *testing.T) {
+	t.Run("has no-tty flag", func(t *testing.T) {
+		flag := sshCmd.Flags().ShorthandLookup("T")
+		if flag == nil || flag.Name != "no-tty" {
+			t.Error("sshCmd should have -T/--no-tty flag")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		hosts   []string
+		wantErr bool
+	}{
+		{name: "no arguments", args: nil, hosts: nil},
+		{name: "host only", args: []string{"homelab-prod"}, hosts: []string{"homelab-prod"}},
+		{name: "command without host", args: []string{"--", "uptime"}, hosts: []string{}},
+		{name: "host and command", args: []string{"homelab-prod", "--", "uptime", "-p"}, hosts: []string{"homelab-prod"}},
+		{name: "command without dash", args: []string{"homelab-prod", "uptime"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			args := cmd.Flags().Args()
+			err := sshCmd.Args(cmd, args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Args() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := sshHostArgs(cmd, args); strings.Join(got, " ") != strings.Join(tt.hosts, " ") {
+				t.Errorf("sshHostArgs() = %q, want %q", got, tt.hosts)
+			}
+		})
+	}
+}
+
+func TestDaemonCmd(t *testing.T) {
+	t.Run("has subcommands", func(t *testing.T) {
+		for _, name := range []string{"start", "run", "status", "stop"} {
+			sub, _, err := daemonCmd.Find([]string{name})
+			if err != nil || sub.Name() != name {
+				t.Errorf("daemonCmd should have %s subcommand", name)
+			}
+		}
+	})
+
+	t.Run("start and run take an idle timeout", func(t *testing.T) {
+		for _, cmd := range []*cobra.Command{daemonStartCmd, daemonRunCmd} {
+			flag := cmd.Flags().Lookup("idle-timeout")
+			if flag == nil {
+				t.Fatalf("%s should have --idle-timeout flag", cmd.Name())
+			}
+			if flag.DefValue != remote.DefaultDaemonIdleTimeout.String() {
+				t.Errorf("%s --idle-timeout default = %s", cmd.Name(), flag.DefValue)
+			}
+		}
+	})
+}
+
 func TestCommandStructure(t *testing.T) {
 	t.Run("all commands have descriptions", func(t *testing.T) {
 		commands := []*cobra.Command{
@@ -358,6 +478,10 @@ func TestCommandStructure(t *testing.T) {
 			loginCmd,
 			configCmd,
 			shellCmd,
+			hostsCmd,
+			sshCmd,
+			useCmd,
+			daemonCmd,
 		}
 
 		for _, cmd := range commands {
@@ -3,6 +3,8 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tinotenda-alfaneti/labman/internal/config"
@@ -23,6 +25,10 @@ The config file is located at ~/.labman/config.yaml (or $XDG_CONFIG_HOME/labman/
 var configShowCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Display the current configuration",
+	Long: `Prints the configuration file. With --effective it instead prints the settings
+labman will use for each host, after defaults and ~/.ssh/config are applied,
+and where each value came from. Aliases limit the output to those hosts; by
+default every alias from the config file and ~/.ssh/config is shown.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		printBanner(cmd)
 
@@ -31,6 +37,19 @@ var configShowCmd = &cobra.Command{
 			return fmt.Errorf("load config: %w", err)
 		}
 
+		effective, _ := cmd.Flags().GetBool("effective")
+		if effective {
+			aliases := args
+			if len(aliases) == 0 {
+				aliases = effectiveAliases(cfg)
+			}
+			printSection(cmd, "EFFECTIVE CONFIGURATION", formatEffectiveHosts(cfg, aliases))
+			return nil
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("aliases can only be given with --effective")
+		}
+
 		configPath, _ := config.GetConfigPath()
 
 		// Marshal to YAML for display
@@ -46,6 +65,49 @@ var configShowCmd = &cobra.Command{
 	},
 }
 
+// effectiveAliases lists the configured aliases followed by the hosts named
+// only in ~/.ssh/config.
+func effectiveAliases(cfg *config.Config) []string {
+	aliases := make([]string, 0, len(cfg.Hosts))
+	for alias := range cfg.Hosts {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range cfg.SSHConfigHosts() {
+		if _, exists := cfg.Hosts[alias]; !exists {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// formatEffectiveHosts lists each host's resolved settings with their sources.
+func formatEffectiveHosts(cfg *config.Config, aliases []string) string {
+	if len(aliases) == 0 {
+		return "No hosts configured."
+	}
+
+	body := &strings.Builder{}
+	for i, alias := range aliases {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(body, "%s\n", alias)
+
+		_, settings := cfg.Effective(alias)
+		nameWidth, valueWidth := 0, 0
+		for _, setting := range settings {
+			nameWidth = max(nameWidth, len(setting.Name))
+			valueWidth = max(valueWidth, len(setting.Value))
+		}
+		for _, setting := range settings {
+			fmt.Fprintf(body, "  %-*s  %-*s  (%s)\n", nameWidth, setting.Name, valueWidth, setting.Value, setting.Source)
+		}
+	}
+	return body.String()
+}
+
 var configValidateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate the configuration file for errors",
@@ -121,6 +183,7 @@ var configPathCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configShowCmd)
+	configShowCmd.Flags().Bool("effective", false, "Show each host's resolved settings and where they came from")
 	configCmd.AddCommand(configValidateCmd)
 	configCmd.AddCommand(configInitCmd)
 	configCmd.AddCommand(configPathCmd)
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+)
+
+func TestFormatEffectiveHosts(t *testing.T) {
+	dir := t.TempDir()
+	sshConfig := filepath.Join(dir, "config")
+	if err := os.WriteFile(sshConfig, []byte("Host nas prod\n  HostName 192.168.1.40\n  User admin\n\nHost *.lab\n  Port 2222\n"), 0o600); err != nil {
+		t.Fatalf("write ssh config: %v", err)
+	}
+	config.ClearCache()
+	t.Cleanup(config.ClearCache)
+
+	cfg := &config.Config{
+		Defaults: config.Defaults{Username: "ubuntu", Port: 22, SSHConfig: sshConfig},
+		Hosts:    map[string]config.Host{"prod": {Host: "192.168.1.10"}},
+	}
+
+	t.Run("aliases from both files", func(t *testing.T) {
+		if got := strings.Join(effectiveAliases(cfg), ","); got != "prod,nas" {
+			t.Fatalf("effectiveAliases = %s, want prod,nas", got)
+		}
+	})
+
+	t.Run("values and sources", func(t *testing.T) {
+		got := formatEffectiveHosts(cfg, []string{"prod", "nas"})
+		want := "prod\n" +
+			"  host      192.168.1.10  (hosts.prod)\n" +
+			"  username  ubuntu        (defaults)\n" +
+			"  port      22            (defaults)\n" +
+			"\n" +
+			"nas\n" +
+			"  host      192.168.1.40  (" + sshConfig + ":2)\n" +
+			"  username  admin         (" + sshConfig + ":3)\n" +
+			"  port      22            (defaults)\n"
+		if got != want {
+			t.Fatalf("formatEffectiveHosts =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("no hosts", func(t *testing.T) {
+		if got := formatEffectiveHosts(cfg, nil); got != "No hosts configured." {
+			t.Fatalf("formatEffectiveHosts = %q", got)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp <src> <dst>",
+	Short: "Copy files to or from the server over SFTP",
+	Long: `Copies files between this machine and the logged-in server. Remote paths
+are written as <host>:<path>, where host is an alias from the config file or
+the address you logged in to; paths without a host are local.
+
+Permissions and modification times are preserved, and every file is verified
+with a SHA-256 checksum once it has been copied. Symlinks are skipped.
+
+Examples:
+  labman cp ./values.yaml homelab-prod:/tmp/
+  labman cp -r homelab-prod:/etc/rancher ./rancher-backup
+  labman cp homelab-prod:~/labman-diag.tar.gz .`,
+	Args:              cobra.ExactArgs(2),
+	PersistentPreRunE: requireSession,
+	PersistentPostRun: cleanupSession,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := remote.Current()
+		if client == nil {
+			return fmt.Errorf("not connected to any server. Run 'labman login' first")
+		}
+
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		src, dst := parseCopyEndpoint(args[0]), parseCopyEndpoint(args[1])
+		if src.remote() == dst.remote() {
+			return fmt.Errorf("exactly one of <src> and <dst> must be a remote <host>:<path>")
+		}
+
+		endpoint := src
+		if dst.remote() {
+			endpoint = dst
+		}
+		if err := checkSessionHost(client, endpoint.Host, endpoint.User); err != nil {
+			return err
+		}
+
+		opts := remote.TransferOptions{Recursive: recursive}
+		if !quiet {
+			opts.Progress = newCopyProgress(cmd.ErrOrStderr()).update
+		}
+
+		ctx := commandContext(cmd)
+		var stats *remote.TransferStats
+		var err error
+		if dst.remote() {
+			stats, err = client.Upload(ctx, src.Path, dst.Path, opts)
+		} else {
+			stats, err = client.Download(ctx, src.Path, dst.Path, opts)
+		}
+		if err != nil {
+			return fmt.Errorf("copy failed: %w", err)
+		}
+
+		summary := fmt.Sprintf("Copied %d file(s), %s, checksums verified.", stats.Files, formatBytes(stats.Bytes))
+		if len(stats.Skipped) > 0 {
+			summary += fmt.Sprintf("\nSkipped (not regular files): %s", strings.Join(stats.Skipped, ", "))
+		}
+		printSection(cmd, "COPY", summary)
+		return nil
+	},
+}
+
+// copyEndpoint is one side of a cp: a local path, or a path on Host.
+type copyEndpoint struct {
+	User string
+	Host string
+	Path string
+}
+
+func (e copyEndpoint) remote() bool {
+	return e.Host != ""
+}
+
+// parseCopyEndpoint splits [user@]host:path the way scp does: a colon only
+// marks a remote path when it comes before the first slash. Single letters
+// before the colon are Windows drive letters, not hosts.
+func parseCopyEndpoint(arg string) copyEndpoint {
+	colon := strings.Index(arg, ":")
+	if colon <= 0 || strings.ContainsAny(arg[:colon], `/\`) || colon == 1 {
+		return copyEndpoint{Path: arg}
+	}
+
+	endpoint := copyEndpoint{Host: arg[:colon], Path: arg[colon+1:]}
+	if user, host, ok := strings.Cut(endpoint.Host, "@"); ok {
+		endpoint.User, endpoint.Host = user, host
+	}
+	return endpoint
+}
+
+// copyProgress redraws one status line per file, only when the percentage changes.
+type copyProgress struct {
+	w       io.Writer
+	path    string
+	percent int
+}
+
+func newCopyProgress(w io.Writer) *copyProgress {
+	return &copyProgress{w: w, percent: -1}
+}
+
+func (p *copyProgress) update(progress remote.TransferProgress) {
+	percent := 100
+	if progress.Total > 0 {
+		percent = int(progress.Bytes * 100 / progress.Total)
+	}
+	if progress.Path == p.path && percent == p.percent && !progress.Done {
+		return
+	}
+	p.path, p.percent = progress.Path, percent
+
+	fmt.Fprintf(p.w, "\r%s %3d%% %s/%s", progress.Path, percent, formatBytes(progress.Bytes), formatBytes(progress.Total))
+	if progress.Done {
+		fmt.Fprintln(p.w, " ok")
+		p.path = ""
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	cpCmd.Flags().BoolP("recursive", "r", false, "Copy directories recursively")
+	cpCmd.Flags().BoolP("quiet", "q", false, "Do not show per-file progress")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import "testing"
+
+func TestParseCopyEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want copyEndpoint
+	}{
+		{name: "local relative path", arg: "values.yaml", want: copyEndpoint{Path: "values.yaml"}},
+		{name: "alias with absolute path", arg: "homelab-prod:/tmp/", want: copyEndpoint{Host: "homelab-prod", Path: "/tmp/"}},
+		{name: "user and host", arg: "admin@192.168.1.10:~/backup.tar", want: copyEndpoint{User: "admin", Host: "192.168.1.10", Path: "~/backup.tar"}},
+		{name: "host with empty path", arg: "pi:", want: copyEndpoint{Host: "pi", Path: ""}},
+		{name: "colon after a slash is local", arg: "./odd:name", want: copyEndpoint{Path: "./odd:name"}},
+		{name: "windows drive letter", arg: `C:\Users\me\notes.txt`, want: copyEndpoint{Path: `C:\Users\me\notes.txt`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCopyEndpoint(tt.arg); got != tt.want {
+				t.Errorf("parseCopyEndpoint(%q) = %+v, want %+v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+	}
+	for input, want := range tests {
+		if got := formatBytes(input); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// initCredentialStore selects where session secrets are kept, from
+// --credential-store or credential_store in the config. It runs before
+// every command, so a bad value stops labman before anything is saved.
+func initCredentialStore() {
+	store, err := configuredCredentialStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	remote.SetCredentialStore(store)
+}
+
+// configuredCredentialStore builds the store named by the flag, falling
+// back to the config and then the OS keyring.
+func configuredCredentialStore() (remote.CredentialStore, error) {
+	kind, file := credentialStore, ""
+	if cfg, err := config.Load(); err == nil {
+		if kind == "" {
+			kind = cfg.Defaults.CredentialStore
+		}
+		file = config.ExpandPath(cfg.Defaults.CredentialFile)
+	}
+	return remote.NewCredentialStore(kind, file)
+}
+
+// readCredentialPassphrase asks for the credential file's passphrase, twice
+// when the file is about to be created.
+func readCredentialPassphrase(path string, create bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for the passphrase of %s without a terminal; set %s", path, remote.CredentialPassphraseEnv)
+	}
+
+	prompt := fmt.Sprintf("Passphrase for credential file %s: ", path)
+	if create {
+		prompt = fmt.Sprintf("New passphrase for credential file %s: ", path)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passBytes, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase from terminal: %w", err)
+	}
+	if !create {
+		return string(passBytes), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	confirmBytes, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase from terminal: %w", err)
+	}
+	if string(confirmBytes) != string(passBytes) {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return string(passBytes), nil
+}
+
+func init() {
+	remote.CredentialPassphrasePrompt = readCredentialPassphrase
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestConfiguredCredentialStore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	configFile := filepath.Join(dir, "labman", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	secrets := filepath.Join(dir, "secrets.enc")
+	if err := os.WriteFile(configFile, []byte("defaults:\n  credential_store: file\n  credential_file: "+secrets+"\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	config.ClearCache()
+	t.Cleanup(config.ClearCache)
+
+	original := credentialStore
+	t.Cleanup(func() { credentialStore = original })
+
+	tests := []struct {
+		name    string
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{name: "config", flag: "", want: "*remote.FileStore"},
+		{name: "flag overrides config", flag: "keyring", want: "remote.KeyringStore"},
+		{name: "auto", flag: "auto", want: "*remote.fallbackStore"},
+		{name: "unknown", flag: "vault", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credentialStore = tt.flag
+			store, err := configuredCredentialStore()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configuredCredentialStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := fmt.Sprintf("%T", store); got != tt.want {
+				t.Errorf("configuredCredentialStore() = %s, want %s", got, tt.want)
+			}
+			if file, ok := store.(*remote.FileStore); ok && file.Path() != secrets {
+				t.Errorf("credential file = %s, want %s", file.Path(), secrets)
+			}
+		})
+	}
+}
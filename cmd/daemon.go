@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// daemonStartTimeout is how long 'daemon start' waits for the socket.
+const daemonStartTimeout = 5 * time.Second
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep SSH connections open between labman commands",
+	Long: `Runs a background process that holds one authenticated SSH connection per
+cached session, like OpenSSH's ControlMaster. While it is running, every
+command that needs a session runs its remote commands through the daemon
+instead of re-dialing the host and reading the keyring, which saves the
+handshake on every call.
+
+The daemon listens on ~/.labman/daemon.sock, which only your user can open,
+and exits once it has been idle for --idle-timeout. Dropped and expired
+sessions are closed; a new 'labman login' is picked up on the next command.
+The daemon cannot prompt, so a host whose key is not yet trusted, or an
+encrypted key whose passphrase 'labman login' did not store, fails with an
+error instead.
+
+Examples:
+  labman daemon start
+  labman daemon start --idle-timeout 1h
+  labman daemon status
+  labman daemon stop`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the connection daemon in the background",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		if status, err := remote.QueryDaemon(); err == nil {
+			printSection(cmd, "DAEMON", fmt.Sprintf("Already running (pid %d).", status.PID))
+			return nil
+		}
+
+		idle, _ := cmd.Flags().GetDuration("idle-timeout")
+		logFile, err := daemonLogPath()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(logFile), 0o700); err != nil {
+			return fmt.Errorf("create log directory: %w", err)
+		}
+		logOut, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("open daemon log: %w", err)
+		}
+		defer logOut.Close()
+
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("locate labman executable: %w", err)
+		}
+		runArgs := []string{"daemon", "run", "--idle-timeout", idle.String()}
+		if cfgFile != "" {
+			runArgs = append(runArgs, "--config", cfgFile)
+		}
+		if credentialStore != "" {
+			runArgs = append(runArgs, "--credential-store", credentialStore)
+		}
+		process := exec.Command(executable, runArgs...)
+		process.Stdout = logOut
+		process.Stderr = logOut
+		detachProcess(process)
+		if err := process.Start(); err != nil {
+			return fmt.Errorf("start daemon: %w", err)
+		}
+		pid := process.Process.Pid
+		_ = process.Process.Release()
+
+		if err := waitForDaemon(daemonStartTimeout); err != nil {
+			return fmt.Errorf("daemon did not start (see %s): %w", logFile, err)
+		}
+		printSection(cmd, "DAEMON", fmt.Sprintf("Started (pid %d), exits after %s idle.\nLog: %s", pid, idle, logFile))
+		return nil
+	},
+}
+
+var daemonRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the connection daemon in the foreground",
+	Long: `Runs the daemon in the foreground, logging to stderr, until it is stopped,
+interrupted or idle for --idle-timeout. 'labman daemon start' runs this in
+the background.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		idle, _ := cmd.Flags().GetDuration("idle-timeout")
+		logger := log.New(cmd.ErrOrStderr(), "labman daemon: ", log.LstdFlags)
+
+		// Nobody is at a terminal to answer: an unknown host key or a key
+		// file without a stored passphrase fails the request, and the error
+		// tells the client to run 'labman hosts trust' or 'labman login'.
+		remote.HostKeyPrompt = nil
+		remote.PassphrasePrompt = nil
+
+		err := remote.ServeDaemon(commandContext(cmd), remote.DaemonOptions{
+			IdleTimeout: idle,
+			Configure:   daemonSessionConfigurer(logger),
+			Logf:        logger.Printf,
+		})
+		if err != nil {
+			return fmt.Errorf("daemon: %w", err)
+		}
+		logger.Printf("stopped")
+		return nil
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is running and which sessions it holds",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		status, err := remote.QueryDaemon()
+		if errors.Is(err, remote.ErrDaemonNotRunning) {
+			printSection(cmd, "DAEMON", "Not running. Start it with 'labman daemon start'.")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("query daemon: %w", err)
+		}
+		printSection(cmd, "DAEMON", formatDaemonStatus(status, time.Now()))
+		return nil
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon and close its connections",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		err := remote.StopDaemon()
+		if errors.Is(err, remote.ErrDaemonNotRunning) {
+			printSection(cmd, "DAEMON", "Not running.")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stop daemon: %w", err)
+		}
+		printSection(cmd, "DAEMON", "Stopped.")
+		return nil
+	},
+}
+
+// formatDaemonStatus describes a running daemon for 'daemon status'.
+func formatDaemonStatus(status *remote.DaemonStatus, now time.Time) string {
+	sessions := "none yet"
+	if len(status.Sessions) > 0 {
+		sessions = strings.Join(status.Sessions, ", ")
+	}
+
+	body := &strings.Builder{}
+	fmt.Fprintf(body, "PID          : %d\n", status.PID)
+	fmt.Fprintf(body, "Socket       : %s\n", status.Socket)
+	// formatTTL drops anything under a second.
+	fmt.Fprintf(body, "Uptime       : %s\n", formatTTL(max(now.Sub(status.Started), time.Second)))
+	fmt.Fprintf(body, "Idle Timeout : %s\n", formatTTL(status.IdleTimeout))
+	fmt.Fprintf(body, "Exits In     : %s\n", formatTTL(max(status.LastRequest.Add(status.IdleTimeout).Sub(now), time.Second)))
+	fmt.Fprintf(body, "Sessions     : %s\n", sessions)
+	return body.String()
+}
+
+// daemonSessionConfigurer applies the configured reconnect policy to the
+// daemon's connections, logging reconnects instead of printing them.
+func daemonSessionConfigurer(logger *log.Logger) func(*remote.SSHSession) {
+	return func(session *remote.SSHSession) {
+		cfg, err := config.Load()
+		if err != nil || cfg.Defaults.ReconnectAttempts <= 0 {
+			return
+		}
+		session.Reconnect = &remote.ReconnectPolicy{
+			MaxAttempts:    cfg.Defaults.ReconnectAttempts,
+			InitialBackoff: cfg.Defaults.ReconnectBackoff,
+		}
+		session.OnReconnect = func(event remote.ReconnectEvent) {
+			logger.Printf("%s: %s", session.Name, describeReconnect(event))
+		}
+	}
+}
+
+// waitForDaemon polls the socket until the daemon answers.
+func waitForDaemon(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := remote.QueryDaemon()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func daemonLogPath() (string, error) {
+	socket, err := remote.DaemonSocketPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(socket), "daemon.log"), nil
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonStartCmd)
+	daemonCmd.AddCommand(daemonRunCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+
+	for _, c := range []*cobra.Command{daemonStartCmd, daemonRunCmd} {
+		c.Flags().Duration("idle-timeout", remote.DefaultDaemonIdleTimeout, "exit after this long without a request")
+	}
+}
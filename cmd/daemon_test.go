@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestFormatDaemonStatus(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	status := &remote.DaemonStatus{
+		PID:         4242,
+		Socket:      "/home/admin/.labman/daemon.sock",
+		Started:     now.Add(-90 * time.Minute),
+		LastRequest: now.Add(-5 * time.Minute),
+		IdleTimeout: 15 * time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		sessions []string
+		want     string
+	}{
+		{
+			name: "no sessions yet",
+			want: "" +
+				"PID          : 4242\n" +
+				"Socket       : /home/admin/.labman/daemon.sock\n" +
+				"Uptime       : 1h 30m\n" +
+				"Idle Timeout : 15m\n" +
+				"Exits In     : 10m\n" +
+				"Sessions     : none yet\n",
+		},
+		{
+			name:     "held sessions",
+			sessions: []string{"homelab-prod", "nas"},
+			want: "" +
+				"PID          : 4242\n" +
+				"Socket       : /home/admin/.labman/daemon.sock\n" +
+				"Uptime       : 1h 30m\n" +
+				"Idle Timeout : 15m\n" +
+				"Exits In     : 10m\n" +
+				"Sessions     : homelab-prod, nas\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status.Sessions = tt.sessions
+			if got := formatDaemonStatus(status, now); got != tt.want {
+				t.Errorf("formatDaemonStatus() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess starts the daemon in its own session so it outlives the
+// terminal that started it.
+func detachProcess(process *exec.Cmd) {
+	process.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
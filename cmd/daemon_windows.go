@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const detachedProcess = 0x00000008
+
+// detachProcess starts the daemon without a console so closing the terminal
+// that started it does not stop it.
+func detachProcess(process *exec.Cmd) {
+	process.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+	}
+}
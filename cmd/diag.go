@@ -15,8 +15,8 @@ var diagCmd = &cobra.Command{
 	Short: "Collect diagnostic bundles for troubleshooting",
 	Long: `The diag commands gather Kubernetes manifests, MicroK8s logs,
 and journal output into a single tarball you can download or stream.`,
-	PersistentPreRunE: requireSession,
-	PersistentPostRun: cleanupSession,
+	PersistentPreRunE: requireExecutor,
+	PersistentPostRun: cleanupExecutor,
 	Run: func(cmd *cobra.Command, args []string) {
 		printBanner(cmd)
 		printSection(cmd, "DIAG", "Use 'labman diag bundle' to collect support artifacts.")
@@ -27,11 +27,13 @@ var diagBundleCmd = &cobra.Command{
 	Use:   "bundle",
 	Short: "Create a tarball with kubectl output and MicroK8s diagnostics",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any cluster. Please login first")
 		}
 
+		ctx := commandContext(cmd)
+
 		remotePath, _ := cmd.Flags().GetString("remote-path")
 		if remotePath == "" {
 			remotePath = fmt.Sprintf("/tmp/labman-diag-%s.tar.gz", time.Now().Format("20060102-150405"))
@@ -39,30 +41,41 @@ var diagBundleCmd = &cobra.Command{
 		stream, _ := cmd.Flags().GetBool("stdout")
 
 		script := buildDiagBundleScript(remotePath)
-		result, err := client.Run(script)
+		result, err := client.RunContext(remote.Mutating(ctx, "Build diagnostic bundle"), script)
 		if err != nil {
 			return fmt.Errorf("failed to build diagnostic bundle: %w", err)
 		}
 
 		path := strings.TrimSpace(result)
-		summary := fmt.Sprintf(`Created bundle at %s
+		created := "Created"
+		if dryRun {
+			path = remotePath
+			created = "Would create"
+		}
+		summary := fmt.Sprintf(`%s bundle at %s
 Contents:
 - kubectl get all -A -o yaml
 - kubectl get events -A --sort-by=.lastTimestamp
 - kubectl describe nodes
 - journalctl -u 'snap.microk8s*' --since -2h
-- microk8s inspect output`, path)
+- microk8s inspect output`, created, path)
 
+		if stream && dryRun {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Would stream the diagnostic bundle from %s\n", path)
+			return nil
+		}
 		if stream {
 			fmt.Fprintf(cmd.ErrOrStderr(), "Streaming diagnostic bundle from %s ...\n", path)
-			if err := client.RunStream("cat "+shellQuote(path), cmd.OutOrStdout()); err != nil {
+			if err := client.RunStreamContext(ctx, "cat "+remote.ShellQuote(path), cmd.OutOrStdout()); err != nil {
 				return fmt.Errorf("stream bundle: %w", err)
 			}
 			return nil
 		}
 
 		printSection(cmd, "DIAGNOSTIC BUNDLE", summary)
-		fmt.Fprintf(cmd.OutOrStdout(), "\nRetrieve it later with: scp <host>:%s ./\n", path)
+		if !dryRun {
+			fmt.Fprintf(cmd.OutOrStdout(), "\nRetrieve it later with: labman cp <host>:%s ./\n", path)
+		}
 		return nil
 	},
 }
@@ -79,7 +92,7 @@ sudo journalctl -u 'snap.microk8s*' --since -2h > "$TMP_DIR/microk8s-journal.txt
 microk8s inspect > "$TMP_DIR/microk8s-inspect.txt" || true
 mkdir -p "$(dirname %s)"
 tar -czf %s -C "$TMP_DIR" .
-echo %s`, shellQuote(remotePath), shellQuote(remotePath), shellQuote(remotePath))
+echo %s`, remote.ShellQuote(remotePath), remote.ShellQuote(remotePath), remote.ShellQuote(remotePath))
 }
 
 func init() {
@@ -88,4 +101,7 @@ func init() {
 
 	diagBundleCmd.Flags().String("remote-path", "", "Where to store the bundle on the server (default: /tmp/labman-diag-<timestamp>.tar.gz)")
 	diagBundleCmd.Flags().Bool("stdout", false, "Stream the tarball to stdout (use with shell redirection)")
+
+	declareSteps(diagCmd)
+	declareSteps(diagBundleCmd, "Build diagnostic bundle")
 }
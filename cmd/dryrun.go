@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// mutatesAnnotation holds the steps a command declares as changing the host,
+// separated by mutatesSeparator. Only commands that carry it accept --dry-run.
+const (
+	mutatesAnnotation = "labman/mutates"
+	mutatesSeparator  = "\n"
+)
+
+// dryRun prints the mutating steps of a workflow instead of running them
+var dryRun bool
+
+// planning skips the mutating commands of a workflow run with --dry-run.
+var planning *remote.DryRun
+
+// declareSteps records which steps of cmd change the host, in the order the
+// workflow runs them; a read-only command declares none. The workflow marks
+// each of them with remote.Mutating when it runs the step's commands.
+func declareSteps(cmd *cobra.Command, steps ...string) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[mutatesAnnotation] = strings.Join(steps, mutatesSeparator)
+}
+
+// declaredSteps returns the steps cmd declared and whether it declared any
+// at all.
+func declaredSteps(cmd *cobra.Command) ([]string, bool) {
+	steps, ok := cmd.Annotations[mutatesAnnotation]
+	if !ok || steps == "" {
+		return nil, ok
+	}
+	return strings.Split(steps, mutatesSeparator), true
+}
+
+// outcome is what a workflow reports after a mutating step: done when the
+// step ran, planned under --dry-run, which only printed it.
+func outcome(done, planned string) string {
+	if dryRun {
+		return planned
+	}
+	return done
+}
+
+// checkDryRun refuses --dry-run for a command that has not declared which of
+// its steps change the host, since nothing could be held back.
+func checkDryRun(cmd *cobra.Command) error {
+	if !dryRun {
+		return nil
+	}
+	if _, ok := declaredSteps(cmd); !ok {
+		return fmt.Errorf("%s does not support --dry-run", cmd.CommandPath())
+	}
+	return nil
+}
+
+// formatPlan lists the declared steps in order with the commands a dry run
+// held back for each, then any step the workflow reached but never declared.
+func formatPlan(declared []string, skipped []remote.PlannedStep) string {
+	if len(declared) == 0 && len(skipped) == 0 {
+		return "This command does not change the host; every command ran."
+	}
+
+	byStep := map[string][]string{}
+	for _, step := range skipped {
+		byStep[step.Step] = append(byStep[step.Step], step.Display())
+	}
+	order := slices.Clone(declared)
+	for _, step := range skipped {
+		if !slices.Contains(order, step.Step) {
+			order = append(order, step.Step)
+		}
+	}
+
+	var b strings.Builder
+	for i, step := range order {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+		commands := byStep[step]
+		if len(commands) == 0 {
+			b.WriteString("   (not reached with these flags)\n")
+		}
+		for _, command := range commands {
+			for _, line := range strings.Split(strings.TrimSpace(command), "\n") {
+				fmt.Fprintf(&b, "   %s\n", line)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the commands that would change the host instead of running them (read-only checks still run)")
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+	"github.com/tinotenda-alfaneti/labman/internal/remote/remotetest"
+)
+
+func TestDryRun(t *testing.T) {
+	t.Run("self upgrade prints its mutating steps", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.Handle(remote.FactsCommand, remotetest.Response{Stdout: ubuntuFacts})
+		fake.Handle("hostname", remotetest.Response{Stdout: "box\n"})
+		fake.HandleRegexp(`^systemctl is-active`, remotetest.Response{Stdout: "inactive\n"})
+		fake.HandleRegexp(`^microk8s kubectl get ns velero >/dev/null 2>&1 \|\| true$`, remotetest.Response{})
+
+		out, err := runLabman(t, "self", "upgrade", "--local", "--dry-run")
+		if err != nil {
+			t.Fatalf("self upgrade --dry-run: %v\n%s", err, out)
+		}
+
+		for _, call := range fake.Calls() {
+			if call.Sudo || strings.Contains(call.Command, "velero create") {
+				t.Errorf("dry run executed a mutating command: %+v", call)
+			}
+		}
+		if got := fake.Commands(); len(got) != 4 || got[1] != "hostname" {
+			t.Errorf("expected only the read-only probes to run, got %q", got)
+		}
+
+		for _, want := range []string{
+			"Target node: box",
+			"Platform: Ubuntu 24.04.1 LTS (x86_64, systemd, apt), microk8s",
+			"[dry-run] Cordon node: sudo microk8s kubectl cordon box",
+			"[dry-run] Upgrade OS packages: sudo apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get full-upgrade -yq && do-release-upgrade",
+			"[dry-run] Reboot: sudo reboot now",
+			"Would wait for the node",
+			"DRY RUN PLAN",
+			"2. Cordon node",
+			"5. Refresh microk8s",
+			"(not reached with these flags)",
+			"7. Uncordon node",
+			"Node would be cordoned.",
+			"OS packages would be upgraded.",
+			"Node would be uncordoned.",
+			"nothing was changed",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+		assertNotReported(t, out, "Node cordoned.", "Node drained.", "OS packages upgraded.", "Node uncordoned.", "OS upgrade flow completed.")
+		if dryRun || planning != nil {
+			t.Error("expected --dry-run to be reset after the command")
+		}
+	})
+
+	t.Run("self clean does not report steps as completed", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.Handle(remote.FactsCommand, remotetest.Response{Stdout: ubuntuFacts})
+
+		out, err := runLabman(t, "self", "clean", "--local", "--dry-run")
+		if err != nil {
+			t.Fatalf("self clean --dry-run: %v\n%s", err, out)
+		}
+		for _, want := range []string{
+			"[dry-run] Update package lists: sudo apt-get update -y",
+			"Update package lists would run",
+			"Dry run: no step was run.",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+		assertNotReported(t, out, "completed\n", "All steps completed successfully.")
+	})
+
+	t.Run("cluster restart does not report the restart", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.Handle("microk8s status --wait-ready", remotetest.Response{Stdout: "microk8s is running\n"})
+
+		out, err := runLabman(t, "cluster", "restart", "dns", "--local", "--dry-run")
+		if err != nil {
+			t.Fatalf("cluster restart --dry-run: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "[dry-run] Restart addon: sudo microk8s disable 'dns' && microk8s enable 'dns'") || !strings.Contains(out, "Would restart dns (addon)") {
+			t.Errorf("expected the restart described as planned:\n%s", out)
+		}
+		assertNotReported(t, out, "Successfully restarted")
+	})
+
+	t.Run("cluster backup describes the backups it would take", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+
+		out, err := runLabman(t, "cluster", "backup", "--name", "nightly", "--local", "--dry-run")
+		if err != nil {
+			t.Fatalf("cluster backup --dry-run: %v\n%s", err, out)
+		}
+		if got := fake.Commands(); len(got) != 0 {
+			t.Errorf("expected nothing to run, got %q", got)
+		}
+		for _, want := range []string{"Would create Velero backup nightly", "Would save an etcd snapshot to /var/snap/microk8s/common/var/backup/labman-etcd-"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output missing %q:\n%s", want, out)
+			}
+		}
+		assertNotReported(t, out, "Saved to:")
+	})
+
+	t.Run("diag bundle describes the bundle it would create", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+
+		out, err := runLabman(t, "diag", "bundle", "--local", "--dry-run", "--remote-path", "/tmp/diag.tar.gz")
+		if err != nil {
+			t.Fatalf("diag bundle --dry-run: %v\n%s", err, out)
+		}
+		if got := fake.Commands(); len(got) != 0 {
+			t.Errorf("expected nothing to run, got %q", got)
+		}
+		if !strings.Contains(out, "Would create bundle at /tmp/diag.tar.gz") || !strings.Contains(out, "1. Build diagnostic bundle") {
+			t.Errorf("expected the bundle described as planned:\n%s", out)
+		}
+		assertNotReported(t, out, "Created bundle", "Retrieve it later")
+	})
+
+	t.Run("read-only commands run unchanged", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.Handle(remote.FactsCommand, remotetest.Response{Stdout: ubuntuFacts})
+		fake.Handle("uname -a && lsb_release -a && lscpu", remotetest.Response{Stdout: "Linux box 6.8.0\n"})
+
+		out, err := runLabman(t, "self", "info", "--local", "--dry-run")
+		if err != nil || !strings.Contains(out, "Linux box 6.8.0") || !strings.Contains(out, "does not change the host") {
+			t.Fatalf("self info --dry-run: %v\n%s", err, out)
+		}
+	})
+
+	t.Run("commands without declared steps refuse it", func(t *testing.T) {
+		useFakeExecutor(t)
+
+		_, err := runLabman(t, "ssh", "--dry-run")
+		if err == nil || !strings.Contains(err.Error(), "labman ssh does not support --dry-run") {
+			t.Fatalf("expected ssh to refuse --dry-run, got %v", err)
+		}
+	})
+}
+
+// assertNotReported fails when a dry run's output claims a step happened.
+func assertNotReported(t *testing.T, out string, claims ...string) {
+	t.Helper()
+	for _, claim := range claims {
+		if strings.Contains(out, claim) {
+			t.Errorf("dry run reported %q:\n%s", claim, out)
+		}
+	}
+}
+
+func TestFormatPlan(t *testing.T) {
+	skipped := []remote.PlannedStep{
+		{Step: "Restart service", Command: "systemctl restart 'k3s'", Sudo: true},
+		{Step: "Undeclared", Command: "set -e\necho hi"},
+	}
+	want := `1. Restart addon
+   (not reached with these flags)
+2. Restart service
+   sudo systemctl restart 'k3s'
+3. Undeclared
+   set -e
+   echo hi`
+	if got := formatPlan([]string{"Restart addon", "Restart service"}, skipped); got != want {
+		t.Errorf("formatPlan =\n%s\nwant\n%s", got, want)
+	}
+}
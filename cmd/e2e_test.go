@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+	"github.com/tinotenda-alfaneti/labman/internal/remote/sshtest"
+)
+
+// newTestLab starts an in-process SSH server, configures it as the host
+// alias "lab" under a temporary HOME and logs in to it, so commands run end
+// to end: session cache, credential store, known_hosts and all.
+func newTestLab(t *testing.T) *sshtest.Server {
+	t.Helper()
+
+	server := sshtest.NewServer(t)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv(remote.CredentialPassphraseEnv, "labman-e2e")
+
+	configFile := filepath.Join(home, ".labman", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	contents := fmt.Sprintf(`defaults:
+  credential_store: file
+  host_key_policy: accept-new
+  ssh_config: none
+hosts:
+  lab:
+    host: %s
+    port: %d
+    username: %s
+    sudo: nopasswd
+`, server.Host(), server.Port(), server.User)
+	if err := os.WriteFile(configFile, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	config.ClearCache()
+	t.Cleanup(func() {
+		if current := remote.Current(); current != nil {
+			current.Close()
+			remote.SetCurrent(nil)
+		}
+		remote.SetCredentialStore(remote.KeyringStore{})
+		config.ClearCache()
+	})
+
+	loginTestLab(t, server, "lab")
+	return server
+}
+
+// loginTestLab logs in to alias with the test server's password.
+func loginTestLab(t *testing.T, server *sshtest.Server, alias string) {
+	t.Helper()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte(server.Password), 0o600); err != nil {
+		t.Fatalf("write password: %v", err)
+	}
+	stdin, err := os.Open(passwordFile)
+	if err != nil {
+		t.Fatalf("open password: %v", err)
+	}
+	defer stdin.Close()
+	originalStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = originalStdin }()
+
+	if out, err := runLabman(t, "login", alias, "--password-stdin"); err != nil {
+		t.Fatalf("login %s: %v\n%s", alias, err, out)
+	}
+}
+
+// runLabman executes the root command with args and returns everything it
+// printed. Flags are reset afterwards so they do not leak into later runs.
+func runLabman(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	defer func() {
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	}()
+
+	executed, err := rootCmd.ExecuteContextC(context.Background())
+	resetFlags(executed)
+	return out.String(), err
+}
+
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		if flag.Changed {
+			flag.Value.Set(flag.DefValue)
+			flag.Changed = false
+		}
+	}
+	for c := cmd; c != nil; c = c.Parent() {
+		c.Flags().VisitAll(reset)
+		c.PersistentFlags().VisitAll(reset)
+	}
+}
+
+// receivedCommand reports whether the server was sent a command containing want.
+func receivedCommand(server *sshtest.Server, want string) bool {
+	for _, command := range server.Commands() {
+		if strings.Contains(command, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSelfCleanEndToEnd(t *testing.T) {
+	server := newTestLab(t)
+	server.Handle(remote.FactsCommand, sshtest.Response{Stdout: ubuntuFacts})
+	server.HandleRegexp(`^sudo -n -- sh -c `, sshtest.Response{Stdout: "ok\n"})
+	server.HandleRegexp(`journalctl --vacuum-time`, sshtest.Response{Stderr: "journalctl: permission denied\n", ExitCode: 1})
+	server.Handle(`df -h / | awk 'NR==2{print $4}'`, sshtest.Response{Stdout: "12G\n"})
+	server.Handle("test -f /var/run/reboot-required && echo 'yes' || echo 'no'", sshtest.Response{Stdout: "no\n"})
+
+	out, err := runLabman(t, "self", "clean")
+	if err != nil {
+		t.Fatalf("self clean: %v\n%s", err, out)
+	}
+
+	for _, want := range []string{
+		"[1/6] Update package lists...",
+		"Update package lists completed",
+		"Vacuum logs (7 days) failed",
+		"Disk free before: 12G",
+		"Reboot required : no",
+		"Failed steps    : Vacuum logs (7 days)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if !receivedCommand(server, "sudo -n -- sh -c 'apt-get update -y'") {
+		t.Errorf("expected apt-get update to run under sudo, got %q", server.Commands())
+	}
+	if meta, err := remote.SessionMetadata("lab"); err != nil || meta.Facts != nil {
+		t.Errorf("expected self clean to forget the platform facts it may have changed, got %+v (%v)", meta.Facts, err)
+	}
+}
+
+func TestClusterWorkloadsEndToEnd(t *testing.T) {
+	server := newTestLab(t)
+	server.HandleRegexp(`^microk8s kubectl get pods -n 'web' --field-selector`, sshtest.Response{Stdout: "NAME  READY  STATUS\napi-1  0/1  CrashLoopBackOff\n"})
+	server.Handle("microk8s kubectl top pods -n 'web'", sshtest.Response{Stderr: "error: Metrics API not available\n", ExitCode: 1})
+	server.Handle("microk8s kubectl get pods -n 'web' -o json 2>/dev/null", sshtest.Response{Stdout: `{"items":[
+		{"metadata":{"namespace":"web","name":"api-1"},"status":{"containerStatuses":[{"state":{"waiting":{"reason":"CrashLoopBackOff"}}}]}},
+		{"metadata":{"namespace":"web","name":"api-2"},"status":{"containerStatuses":[{"state":{}}]}}
+	]}`})
+	server.HandleRegexp(`^microk8s kubectl logs -n 'web' 'api-1'`, sshtest.Response{Stdout: "panic: missing DATABASE_URL\n"})
+
+	out, err := runLabman(t, "cluster", "workloads", "-n", "web", "--logs-tail", "5")
+	if err != nil {
+		t.Fatalf("cluster workloads: %v\n%s", err, out)
+	}
+
+	for _, want := range []string{
+		"api-1  0/1  CrashLoopBackOff",
+		"kubectl top pods failed",
+		"web/api-1",
+		"--- web/api-1 ---",
+		"panic: missing DATABASE_URL",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "web/api-2") {
+		t.Errorf("api-2 is not crash looping:\n%s", out)
+	}
+	if !receivedCommand(server, "microk8s kubectl logs -n 'web' 'api-1' --all-containers --tail=5") {
+		t.Errorf("expected logs to be fetched with --tail=5, got %q", server.Commands())
+	}
+}
+
+func TestDiagBundleEndToEnd(t *testing.T) {
+	server := newTestLab(t)
+	server.HandleRegexp(`(?s)^set -euo pipefail.*tar -czf '/tmp/diag\.tar\.gz'`, sshtest.Response{Stdout: "/tmp/diag.tar.gz\n"})
+	server.Handle("cat '/tmp/diag.tar.gz'", sshtest.Response{Stdout: "TARBALL"})
+
+	t.Run("summary", func(t *testing.T) {
+		out, err := runLabman(t, "diag", "bundle", "--remote-path", "/tmp/diag.tar.gz")
+		if err != nil {
+			t.Fatalf("diag bundle: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "Created bundle at /tmp/diag.tar.gz") || !strings.Contains(out, "labman cp <host>:/tmp/diag.tar.gz") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+	})
+
+	t.Run("stream to stdout", func(t *testing.T) {
+		out, err := runLabman(t, "diag", "bundle", "--remote-path", "/tmp/diag.tar.gz", "--stdout")
+		if err != nil {
+			t.Fatalf("diag bundle --stdout: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "Streaming diagnostic bundle from /tmp/diag.tar.gz") || !strings.Contains(out, "TARBALL") {
+			t.Errorf("expected the tarball to be streamed, got:\n%q", out)
+		}
+	})
+
+	t.Run("script failure", func(t *testing.T) {
+		server.HandleRegexp(`(?s)^set -euo pipefail`, sshtest.Response{Stderr: "microk8s: command not found\n", ExitCode: 127})
+		out, err := runLabman(t, "diag", "bundle")
+		if err == nil || !strings.Contains(err.Error(), "failed to build diagnostic bundle") {
+			t.Fatalf("expected the bundle to fail, got %v\n%s", err, out)
+		}
+	})
+}
+
+func TestCommandsNeedASession(t *testing.T) {
+	newTestLab(t)
+	if _, err := runLabman(t, "session", "drop"); err != nil {
+		t.Fatalf("session drop: %v", err)
+	}
+
+	_, err := runLabman(t, "self", "clean")
+	if err == nil || !strings.Contains(err.Error(), "failed to load session") {
+		t.Fatalf("expected a missing session error, got %v", err)
+	}
+}
+
+func TestSSHSelectsSessionByAlias(t *testing.T) {
+	server := newTestLab(t)
+	server.Handle("hostname", sshtest.Response{Stdout: "lab\n"})
+
+	// A second alias for the same server, logged in last so that it is the
+	// active session.
+	configFile := filepath.Join(os.Getenv("HOME"), ".labman", "config.yaml")
+	file, err := os.OpenFile(configFile, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open config: %v", err)
+	}
+	fmt.Fprintf(file, "  other:\n    host: %s\n    port: %d\n    username: %s\n", server.Host(), server.Port(), server.User)
+	file.Close()
+	config.ClearCache()
+	loginTestLab(t, server, "other")
+
+	out, err := runLabman(t, "ssh", "lab", "--", "hostname")
+	if err != nil {
+		t.Fatalf("ssh lab: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "lab") {
+		t.Errorf("expected the command output, got:\n%s", out)
+	}
+	if active, err := remote.ActiveSession(); err != nil || active != "other" {
+		t.Errorf("expected the active session to stay other, got %q (%v)", active, err)
+	}
+	out, err = runLabman(t, "audit", "--json")
+	if err != nil {
+		t.Fatalf("audit: %v\n%s", err, out)
+	}
+	var records []remote.AuditRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatalf("parse audit output: %v\n%s", err, out)
+	}
+	if len(records) == 0 || records[len(records)-1].Command != "hostname" || records[len(records)-1].Session != "lab" {
+		t.Errorf("expected hostname to run in session lab, got %+v", records)
+	}
+
+	_, err = runLabman(t, "ssh", "elsewhere", "--", "hostname")
+	if err == nil || !strings.Contains(err.Error(), "is not the server of session other") {
+		t.Errorf("expected a host without a session to be checked against the active one, got %v", err)
+	}
+}
+
+func TestAuditEndToEnd(t *testing.T) {
+	server := newTestLab(t)
+	server.Handle(remote.FactsCommand, sshtest.Response{Stdout: ubuntuFacts})
+	server.HandleRegexp(`^sudo -n -- sh -c `, sshtest.Response{Stdout: "ok\n"})
+	server.HandleRegexp(`journalctl --vacuum-time`, sshtest.Response{Stderr: "journalctl: permission denied\n", ExitCode: 1})
+
+	if out, err := runLabman(t, "self", "clean"); err != nil {
+		t.Fatalf("self clean: %v\n%s", err, out)
+	}
+
+	out, err := runLabman(t, "audit", "--json", "--host", "lab", "--since", "1h")
+	if err != nil {
+		t.Fatalf("audit: %v\n%s", err, out)
+	}
+	var records []remote.AuditRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatalf("parse audit output: %v\n%s", err, out)
+	}
+	var sawUpdate bool
+	for _, record := range records {
+		if record.Session != "lab" || record.Host != server.Host() || record.RemoteUser != server.User || record.Labman != "labman self clean" {
+			t.Errorf("unexpected record %+v", record)
+		}
+		if record.Command == "apt-get update -y" && record.Sudo && record.ExitCode == 0 {
+			sawUpdate = true
+		}
+	}
+	if !sawUpdate {
+		t.Errorf("expected apt-get update to be audited as a sudo command, got %+v", records)
+	}
+
+	out, err = runLabman(t, "audit", "--failed")
+	if err != nil {
+		t.Fatalf("audit --failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "self clean") || !strings.Contains(out, "journalctl --vacuum-time") || strings.Contains(out, "apt-get update") {
+		t.Errorf("expected only the failed vacuum in the table:\n%s", out)
+	}
+
+	out, err = runLabman(t, "audit", "--host", "elsewhere")
+	if err != nil || !strings.Contains(out, "No matching commands") {
+		t.Errorf("expected no records for another host, got %v\n%s", err, out)
+	}
+}
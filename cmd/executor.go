@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// localMode runs cluster, self and diag workflows on this machine instead of over SSH
+var localMode bool
+
+// recordFile writes every workflow command and its result to a cassette
+var recordFile string
+
+// replayFile answers workflow commands from a cassette instead of a host
+var replayFile string
+
+// executor is where workflow commands run when it is not the SSH session in
+// remote.Current(): the local machine for --local or a localhost host, or a
+// cassette for --replay.
+var executor remote.Executor
+
+// recording captures the commands of a workflow run with --record.
+var recording *remote.Recorder
+
+// newLocalExecutor builds the executor used for --local; tests replace it
+// with a scripted fake.
+var newLocalExecutor = func(sudo remote.SudoMode) remote.Executor {
+	local := remote.NewLocalExecutor(sudo)
+	local.CommandTimeout = commandTimeout
+	return local
+}
+
+// requireExecutor picks where a workflow's commands run: a cassette with
+// --replay, this machine with --local or when --host names a host configured
+// as localhost, otherwise the SSH session loaded by requireSession. With
+// --record the commands are also written to a cassette, and with --dry-run
+// the steps that change the host are only printed.
+func requireExecutor(cmd *cobra.Command, args []string) error {
+	releaseExecutor()
+	if err := checkDryRun(cmd); err != nil {
+		return err
+	}
+	if dryRun {
+		planning = remote.NewDryRun(cmd.OutOrStdout())
+	}
+
+	if replayFile != "" {
+		if recordFile != "" {
+			return errors.New("--record and --replay cannot be used together")
+		}
+		replayer, err := remote.NewReplayer(replayFile)
+		if err != nil {
+			return err
+		}
+		executor = replayer
+		return nil
+	}
+
+	local, sudo, err := localTarget()
+	if err != nil {
+		return err
+	}
+	if local {
+		executor = newLocalExecutor(sudo)
+	} else if err := requireSession(cmd, args); err != nil {
+		return err
+	}
+
+	if recordFile != "" {
+		recorder, err := remote.NewRecorder(recordFile)
+		if err != nil {
+			return err
+		}
+		recording = recorder
+	}
+	return nil
+}
+
+// localTarget reports whether workflows should run locally and with which
+// sudo mode.
+func localTarget() (bool, remote.SudoMode, error) {
+	if !localMode && sessionHost == "" {
+		return false, "", nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return false, "", fmt.Errorf("load config: %w", err)
+	}
+	if localMode {
+		return true, remote.SudoMode(cfg.Defaults.Sudo), nil
+	}
+	host := cfg.Lookup(sessionHost)
+	return host.IsLocal(), remote.SudoMode(host.Sudo), nil
+}
+
+// currentExecutor returns where workflow commands run, recording them with
+// --record and holding back mutating steps with --dry-run, or nil when there
+// is neither an executor nor an SSH session.
+func currentExecutor() remote.Executor {
+	var current remote.Executor
+	switch session := remote.Current(); {
+	case executor != nil:
+		current = executor
+	case session != nil:
+		current = session
+	default:
+		return nil
+	}
+
+	if recording != nil {
+		current = recording.Wrap(current)
+	}
+	if planning != nil {
+		current = planning.Wrap(current)
+	}
+	return current
+}
+
+// currentSession returns the SSH session workflow commands run over, or nil
+// when they run locally or from a cassette.
+func currentSession() *remote.SSHSession {
+	if executor != nil {
+		return nil
+	}
+	return remote.Current()
+}
+
+// cleanupExecutor prints the plan of a dry run, reports where a recording
+// went and releases the local or replay executor, or the SSH session like
+// cleanupSession.
+func cleanupExecutor(cmd *cobra.Command, args []string) {
+	if planning != nil {
+		declared, _ := declaredSteps(cmd)
+		printSection(cmd, "DRY RUN PLAN", formatPlan(declared, planning.Steps()))
+	}
+	if recording != nil {
+		if err := recording.Err(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to write %s: %v\n", recordFile, err)
+		} else {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Recorded %d command(s) to %s\n", recording.Len(), recordFile)
+		}
+	}
+	if executor == nil {
+		cleanupSession(cmd, args)
+	}
+	releaseExecutor()
+}
+
+// releaseExecutor drops what an earlier workflow left behind, including one
+// that failed before its cleanup ran.
+func releaseExecutor() {
+	if executor != nil {
+		_ = executor.Close()
+		executor = nil
+	}
+	recording = nil
+	planning = nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{clusterCmd, selfCmd, diagCmd} {
+		c.PersistentFlags().BoolVar(&localMode, "local", false, "run the workflow on this machine instead of over SSH (no login needed)")
+		c.PersistentFlags().StringVar(&recordFile, "record", "", "write every command with its output, exit code and timing to this cassette (.json for JSON, YAML otherwise)")
+		c.PersistentFlags().StringVar(&replayFile, "replay", "", "answer commands from a cassette written by --record instead of connecting to a host")
+	}
+}
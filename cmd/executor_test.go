@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+	"github.com/tinotenda-alfaneti/labman/internal/remote/remotetest"
+)
+
+// useFakeExecutor writes a config with a localhost alias "box" under a
+// temporary HOME and makes --local run commands against a scripted fake.
+func useFakeExecutor(t *testing.T) *remotetest.Executor {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	configFile := filepath.Join(home, ".labman", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	contents := "defaults:\n  ssh_config: none\nhosts:\n  box:\n    host: localhost\n    sudo: none\n"
+	if err := os.WriteFile(configFile, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	config.ClearCache()
+
+	fake := remotetest.New()
+	original := newLocalExecutor
+	newLocalExecutor = func(remote.SudoMode) remote.Executor { return fake }
+	t.Cleanup(func() {
+		newLocalExecutor = original
+		releaseExecutor()
+		config.ClearCache()
+	})
+	return fake
+}
+
+func TestLocalExecutorSelection(t *testing.T) {
+	t.Run("--local runs without a session", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.Handle(remote.FactsCommand, remotetest.Response{Stdout: ubuntuFacts})
+		fake.Handle("uname -a && lsb_release -a && lscpu", remotetest.Response{Stdout: "Linux box 6.8.0\n"})
+
+		out, err := runLabman(t, "self", "info", "--local")
+		if err != nil {
+			t.Fatalf("self info --local: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "Linux box 6.8.0") || !strings.Contains(out, "Ubuntu 24.04.1 LTS (ubuntu, like debian)") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+		if !fake.Closed() || executor != nil {
+			t.Error("expected the executor to be closed and released after the command")
+		}
+	})
+
+	t.Run("host configured as localhost", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+		fake.HandleRegexp(`^systemctl restart `, remotetest.Response{})
+		fake.Handle("microk8s status --wait-ready", remotetest.Response{Stdout: "microk8s is running\n"})
+		fake.HandleRegexp(`^\s*report\(\)`, remotetest.Response{Stdout: "Pi-hole  active\n"})
+
+		out, err := runLabman(t, "self", "services", "--host", "box", "--restart", "pihole")
+		if err != nil {
+			t.Fatalf("self services --host box: %v\n%s", err, out)
+		}
+		calls := fake.Calls()
+		if len(calls) == 0 || calls[0] != (remotetest.Call{Command: "systemctl restart pihole-FTL", Sudo: true}) {
+			t.Errorf("expected the restart to run as root first, got %+v", calls)
+		}
+	})
+
+	t.Run("upgrade needs --no-reboot locally", func(t *testing.T) {
+		fake := useFakeExecutor(t)
+
+		_, err := runLabman(t, "self", "upgrade", "--local")
+		if err == nil || !strings.Contains(err.Error(), "--no-reboot") {
+			t.Fatalf("expected upgrade to refuse to reboot this machine, got %v", err)
+		}
+		if len(fake.Calls()) != 0 {
+			t.Errorf("expected no commands to run, got %q", fake.Commands())
+		}
+	})
+
+	t.Run("login to a localhost alias is a no-op", func(t *testing.T) {
+		useFakeExecutor(t)
+
+		out, err := runLabman(t, "login", "box")
+		if err != nil || !strings.Contains(out, "no login is needed") {
+			t.Fatalf("login box = %v\n%s", err, out)
+		}
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	fake := useFakeExecutor(t)
+	fake.Handle("df -h", remotetest.Response{Stdout: "Filesystem  Size  Used Avail Use% Mounted on\n/dev/sda2   228G  171G   46G  79% /\n"})
+	fake.HandleRegexp(`^lsblk `, remotetest.Response{Stdout: "NAME SIZE\nsda  232.9G\n"})
+	fake.HandleRegexp(`^du -xh`, remotetest.Response{Stderr: "sudo: a password is required\n", ExitCode: 1})
+	cassette := filepath.Join(t.TempDir(), "disks.json")
+
+	recorded, err := runLabman(t, "self", "disks", "--local", "--record", cassette)
+	if err != nil {
+		t.Fatalf("self disks --record: %v\n%s", err, recorded)
+	}
+	if !strings.Contains(recorded, "Recorded 4 command(s) to "+cassette) {
+		t.Errorf("expected the recording to be reported:\n%s", recorded)
+	}
+
+	replayed, err := runLabman(t, "self", "disks", "--replay", cassette)
+	if err != nil {
+		t.Fatalf("self disks --replay: %v\n%s", err, replayed)
+	}
+	if want, _, _ := strings.Cut(recorded, "Recorded"); replayed != want {
+		t.Errorf("replayed output differs from the recording:\n%s\nwant\n%s", replayed, want)
+	}
+	if len(fake.Calls()) != 4 {
+		t.Errorf("expected the replay not to run anything, got %q", fake.Commands())
+	}
+
+	_, err = runLabman(t, "self", "info", "--replay", cassette)
+	if err == nil || !strings.Contains(err.Error(), "command not in cassette") {
+		t.Fatalf("expected a command missing from the cassette to fail, got %v", err)
+	}
+
+	_, err = runLabman(t, "self", "disks", "--replay", cassette, "--record", cassette)
+	if err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Fatalf("expected --record with --replay to be rejected, got %v", err)
+	}
+}
+
+// TestReplayGolden renders a recorded 'self disks' run and compares it with
+// testdata/self-disks.golden. Regenerate the golden file with:
+//
+//	go run . self disks --replay cmd/testdata/self-disks.yaml > cmd/testdata/self-disks.golden
+func TestReplayGolden(t *testing.T) {
+	useFakeExecutor(t)
+
+	out, err := runLabman(t, "self", "disks", "--replay", filepath.Join("testdata", "self-disks.yaml"))
+	if err != nil {
+		t.Fatalf("self disks --replay: %v\n%s", err, out)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "self-disks.golden"))
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if out != string(golden) {
+		t.Errorf("output differs from testdata/self-disks.golden:\n%s", out)
+	}
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// hostFacts describes the platform workflow commands run on. Over SSH the
+// probe is cached with the session; with --record it runs again so that the
+// cassette holds it for --replay.
+func hostFacts(ctx context.Context, client remote.Executor) (*remote.Facts, error) {
+	if session := currentSession(); session != nil && recording == nil {
+		return session.Facts(ctx)
+	}
+	return remote.ProbeFacts(ctx, client)
+}
+
+// forgetHostFacts drops the facts cached with the session after a workflow
+// that may have changed the release, kernel or installed packages. A dry run
+// changed nothing, so it keeps them.
+func forgetHostFacts(out io.Writer) {
+	session := currentSession()
+	if session == nil || dryRun {
+		return
+	}
+	if err := session.ForgetFacts(); err != nil {
+		fmt.Fprintf(out, "Warning: could not clear the cached platform facts: %v\n", err)
+	}
+}
+
+// packageCommands is how the self workflows drive one package manager.
+type packageCommands struct {
+	// Refresh updates the package lists
+	Refresh string
+	// Upgrade upgrades installed packages, as in 'self clean'
+	Upgrade string
+	// Clean removes packages nothing needs and empties the cache
+	Clean string
+	// UpgradeOS brings the whole system up to date, as in 'self upgrade'
+	UpgradeOS string
+}
+
+var packageManagerCommands = map[string]packageCommands{
+	"apt": {
+		Refresh:   "apt-get update -y",
+		Upgrade:   "DEBIAN_FRONTEND=noninteractive apt-get upgrade -yq",
+		Clean:     "apt-get autoremove -y && apt-get autoclean -y",
+		UpgradeOS: "apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get full-upgrade -yq",
+	},
+	"dnf": {
+		Refresh:   "dnf makecache -y",
+		Upgrade:   "dnf upgrade -y",
+		Clean:     "dnf autoremove -y && dnf clean all",
+		UpgradeOS: "dnf upgrade --refresh -y",
+	},
+	"yum": {
+		Refresh:   "yum makecache -y",
+		Upgrade:   "yum update -y",
+		Clean:     "yum autoremove -y && yum clean all",
+		UpgradeOS: "yum update -y",
+	},
+	"pacman": {
+		Refresh:   "pacman -Sy --noconfirm",
+		Upgrade:   "pacman -Su --noconfirm",
+		Clean:     "pacman -Sc --noconfirm",
+		UpgradeOS: "pacman -Syu --noconfirm",
+	},
+	"apk": {
+		Refresh:   "apk update",
+		Upgrade:   "apk upgrade",
+		Clean:     "apk cache clean 2>/dev/null || rm -rf /var/cache/apk/*",
+		UpgradeOS: "apk update && apk upgrade --available",
+	},
+	"zypper": {
+		Refresh:   "zypper --non-interactive refresh",
+		Upgrade:   "zypper --non-interactive update",
+		Clean:     "zypper clean --all",
+		UpgradeOS: "zypper --non-interactive refresh && zypper --non-interactive dist-upgrade",
+	},
+}
+
+// packageCommandsFor picks the commands for the host's package manager, or
+// explains why labman cannot manage its packages.
+func packageCommandsFor(facts *remote.Facts) (packageCommands, error) {
+	commands, ok := packageManagerCommands[facts.PackageManager]
+	if !ok {
+		return packageCommands{}, fmt.Errorf("no supported package manager on %s; labman knows apt, dnf, yum, pacman, apk and zypper", facts.Describe())
+	}
+	return commands, nil
+}
+
+// kubeFlavor is how the self workflows talk to the node's Kubernetes.
+type kubeFlavor struct {
+	Name    string
+	Kubectl string
+	// Ready exits 0 and prints ReadyOutput once the node serves again; it
+	// needs root when ReadySudo is set
+	Ready       string
+	ReadyOutput string
+	ReadySudo   bool
+}
+
+var (
+	microk8sFlavor = kubeFlavor{
+		Name:        "microk8s",
+		Kubectl:     "microk8s kubectl",
+		Ready:       "microk8s status --wait-ready",
+		ReadyOutput: "microk8s is running",
+	}
+	k3sFlavor = kubeFlavor{
+		Name:        "k3s",
+		Kubectl:     "k3s kubectl",
+		Ready:       "k3s kubectl get --raw /readyz",
+		ReadyOutput: "ok",
+		ReadySudo:   true,
+	}
+)
+
+// kubeFlavorFor picks microk8s or k3s, preferring microk8s like the rest of
+// labman.
+func kubeFlavorFor(facts *remote.Facts) (kubeFlavor, bool) {
+	switch {
+	case facts.Has("microk8s"):
+		return microk8sFlavor, true
+	case facts.Has("k3s"):
+		return k3sFlavor, true
+	}
+	return kubeFlavor{}, false
+}
+
+// systemInfoCommand prints uname and whichever of lsb_release and lscpu the
+// host has.
+func systemInfoCommand(facts *remote.Facts) string {
+	parts := []string{"uname -a"}
+	if facts.Has("lsb_release") {
+		parts = append(parts, "lsb_release -a")
+	}
+	if facts.Has("lscpu") {
+		parts = append(parts, "lscpu")
+	}
+	return strings.Join(parts, " && ")
+}
+
+// platformTools are the tools 'self info' reports as installed or missing.
+var platformTools = []string{"microk8s", "k3s", "kubectl", "docker", "snap"}
+
+// formatFacts renders facts for the PLATFORM section of 'self info'.
+func formatFacts(facts *remote.Facts) string {
+	osLine := facts.OS.PrettyName
+	if osLine == "" {
+		osLine = strings.TrimSpace(facts.OS.Name + " " + facts.OS.VersionID)
+	}
+	if id := facts.OS.ID; id != "" {
+		like := ""
+		if len(facts.OS.IDLike) > 0 {
+			like = ", like " + strings.Join(facts.OS.IDLike, " ")
+		}
+		osLine = strings.TrimSpace(fmt.Sprintf("%s (%s%s)", osLine, id, like))
+	}
+
+	var installed, missing []string
+	for _, tool := range platformTools {
+		if facts.Has(tool) {
+			installed = append(installed, tool)
+		} else {
+			missing = append(missing, tool)
+		}
+	}
+
+	valueOr := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	lines := []string{
+		"OS              : " + valueOr(osLine, "unknown (no /etc/os-release)"),
+		"Kernel          : " + valueOr(strings.TrimSpace(strings.Join([]string{facts.Kernel, facts.KernelRelease, facts.Arch}, " ")), "unknown"),
+		"Init system     : " + valueOr(facts.Init, "unknown"),
+		"Package manager : " + valueOr(facts.PackageManager, "none supported"),
+		"Installed       : " + valueOr(strings.Join(installed, ", "), "none"),
+		"Missing         : " + valueOr(strings.Join(missing, ", "), "none"),
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// ubuntuFacts is what remote.FactsCommand prints on an Ubuntu MicroK8s node.
+const ubuntuFacts = `[os-release]
+NAME="Ubuntu"
+ID=ubuntu
+ID_LIKE=debian
+PRETTY_NAME="Ubuntu 24.04.1 LTS"
+VERSION_ID="24.04"
+[uname]
+Linux
+6.8.0-45-generic
+x86_64
+[init]
+systemd
+[commands]
+apt-get
+systemctl
+journalctl
+timedatectl
+snap
+microk8s
+lsb_release
+lscpu
+do-release-upgrade
+`
+
+// alpineFacts is an Alpine host running k3s under OpenRC.
+const alpineFacts = `[os-release]
+NAME="Alpine Linux"
+ID=alpine
+PRETTY_NAME="Alpine Linux v3.20"
+VERSION_ID=3.20.3
+[uname]
+Linux
+6.6.58-0-lts
+aarch64
+[init]
+openrc
+[commands]
+apk
+k3s
+kubectl
+`
+
+func parseTestFacts(t *testing.T, output string) *remote.Facts {
+	t.Helper()
+	facts, err := remote.ParseFacts(output)
+	if err != nil {
+		t.Fatalf("ParseFacts: %v", err)
+	}
+	return facts
+}
+
+func TestSelfCleanStepsPerPlatform(t *testing.T) {
+	tests := []struct {
+		name  string
+		facts string
+		want  []string
+	}{
+		{
+			name:  "ubuntu",
+			facts: ubuntuFacts,
+			want: []string{
+				"apt-get update -y",
+				"DEBIAN_FRONTEND=noninteractive apt-get upgrade -yq",
+				"apt-get autoremove -y && apt-get autoclean -y",
+				"journalctl --vacuum-time=7d",
+				"timedatectl set-ntp true",
+				"microk8s ctr image prune -a || true",
+			},
+		},
+		{
+			name:  "alpine",
+			facts: alpineFacts,
+			want: []string{
+				"apk update",
+				"apk upgrade",
+				"apk cache clean 2>/dev/null || rm -rf /var/cache/apk/*",
+				"skipped: no systemd journal on this host",
+				"skipped: timedatectl is not installed; configure NTP with the host's own tools",
+				"k3s crictl rmi --prune",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facts := parseTestFacts(t, tt.facts)
+			packages, err := packageCommandsFor(facts)
+			if err != nil {
+				t.Fatalf("packageCommandsFor: %v", err)
+			}
+			var got []string
+			for _, step := range selfCleanSteps {
+				command, skipped := step.Command(packages, facts)
+				if command == "" {
+					command = "skipped: " + skipped
+				}
+				got = append(got, command)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("steps =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestUnsupportedPlatformsFailFast(t *testing.T) {
+	facts := parseTestFacts(t, "[os-release]\nPRETTY_NAME=\"NixOS 24.05\"\n[uname]\nLinux\n6.6.0\nx86_64\n[init]\nsystemd\n[commands]\nsystemctl\n")
+
+	_, err := packageCommandsFor(facts)
+	if err == nil || !strings.Contains(err.Error(), "no supported package manager on NixOS 24.05 (x86_64, systemd)") {
+		t.Errorf("expected the package manager to be explained, got %v", err)
+	}
+	if _, ok := kubeFlavorFor(facts); ok {
+		t.Error("expected no Kubernetes flavor without microk8s or k3s")
+	}
+}
+
+func TestFormatFacts(t *testing.T) {
+	want := `OS              : Alpine Linux v3.20 (alpine)
+Kernel          : Linux 6.6.58-0-lts aarch64
+Init system     : openrc
+Package manager : apk
+Installed       : k3s, kubectl
+Missing         : microk8s, docker, snap`
+	if got := formatFacts(parseTestFacts(t, alpineFacts)); got != want {
+		t.Errorf("formatFacts =\n%s\nwant\n%s", got, want)
+	}
+	if got := systemInfoCommand(parseTestFacts(t, ubuntuFacts)); got != "uname -a && lsb_release -a && lscpu" {
+		t.Errorf("systemInfoCommand on Ubuntu = %q", got)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward <host> <localport>:<remotehost>:<remoteport>...",
+	Short: "Forward local ports to services reachable from the server",
+	Long: `Opens local ports that tunnel through the cached SSH session, like ssh -L.
+Use it to reach dashboards that only listen on the server's loopback. Each
+spec is [bind_address:]localport:remotehost:remoteport, where remotehost is
+resolved on the server; local ports bind to 127.0.0.1 unless an address is
+given.
+
+Every connection is reported when it opens and closes, with the bytes sent
+and received. Press Ctrl-C to stop forwarding.
+
+Examples:
+  labman forward homelab-prod 3000:localhost:3000
+  labman forward homelab-prod 8443:localhost:10443 8080:pihole.lan:80`,
+	Args:              cobra.MinimumNArgs(2),
+	PersistentPreRunE: requireSession,
+	PersistentPostRun: cleanupSession,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := remote.Current()
+		if client == nil {
+			return fmt.Errorf("not connected to any server. Run 'labman login' first")
+		}
+
+		user, host, ok := strings.Cut(args[0], "@")
+		if !ok {
+			user, host = "", args[0]
+		}
+		if err := checkSessionHost(client, host, user); err != nil {
+			return err
+		}
+
+		var specs []remote.ForwardSpec
+		var lines []string
+		for _, arg := range args[1:] {
+			spec, err := remote.ParseForwardSpec(arg)
+			if err != nil {
+				return err
+			}
+			specs = append(specs, spec)
+			lines = append(lines, spec.String())
+		}
+
+		printSection(cmd, "FORWARDING", strings.Join(lines, "\n")+"\n\nPress Ctrl-C to stop.")
+
+		stats := &forwardStats{}
+		err := client.Forward(commandContext(cmd), specs, func(event remote.ForwardEvent) {
+			stats.add(event)
+			fmt.Fprintln(cmd.ErrOrStderr(), describeForwardEvent(event))
+		})
+		if err != nil {
+			return fmt.Errorf("forward failed: %w", err)
+		}
+
+		printSection(cmd, "STOPPED", stats.String())
+		return nil
+	},
+}
+
+func describeForwardEvent(event remote.ForwardEvent) string {
+	prefix := fmt.Sprintf("[#%d %d] ", event.ID, event.Spec.LocalPort)
+	switch {
+	case event.Spec.RemoteHost == "":
+		return prefix + fmt.Sprintf("rejected %s: %v", event.Peer, event.Err)
+	case !event.Closed:
+		return prefix + fmt.Sprintf("%s -> %s opened", event.Peer, event.Spec.RemoteAddr())
+	case errors.Is(event.Err, remote.ErrDestinationDenied):
+		return prefix + fmt.Sprintf("denied %s (not in proxy_allow)", event.Spec.RemoteAddr())
+	case event.Err != nil:
+		return prefix + fmt.Sprintf("could not reach %s: %v", event.Spec.RemoteAddr(), event.Err)
+	default:
+		return prefix + fmt.Sprintf("closed (sent %s, received %s)", formatBytes(event.Sent), formatBytes(event.Received))
+	}
+}
+
+// forwardStats totals the connections seen while forwarding.
+type forwardStats struct {
+	mu          sync.Mutex
+	connections int
+	failed      int
+	sent        int64
+	received    int64
+}
+
+func (s *forwardStats) add(event remote.ForwardEvent) {
+	if !event.Closed {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections++
+	if event.Err != nil {
+		s.failed++
+	}
+	s.sent += event.Sent
+	s.received += event.Received
+}
+
+func (s *forwardStats) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := fmt.Sprintf("%d connection(s), sent %s, received %s", s.connections, formatBytes(s.sent), formatBytes(s.received))
+	if s.failed > 0 {
+		summary += fmt.Sprintf(" (%d failed)", s.failed)
+	}
+	return summary
+}
+
+func init() {
+	rootCmd.AddCommand(forwardCmd)
+}
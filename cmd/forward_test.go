@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestDescribeForwardEvent(t *testing.T) {
+	spec := remote.ForwardSpec{LocalPort: 3000, RemoteHost: "localhost", RemotePort: 3000}
+
+	tests := []struct {
+		name  string
+		event remote.ForwardEvent
+		want  string
+	}{
+		{
+			name:  "opened",
+			event: remote.ForwardEvent{Spec: spec, ID: 1, Peer: "127.0.0.1:51000"},
+			want:  "[#1 3000] 127.0.0.1:51000 -> localhost:3000 opened",
+		},
+		{
+			name:  "closed with counters",
+			event: remote.ForwardEvent{Spec: spec, ID: 2, Sent: 512, Received: 2048, Closed: true},
+			want:  "[#2 3000] closed (sent 512 B, received 2.0 KiB)",
+		},
+		{
+			name:  "remote unreachable",
+			event: remote.ForwardEvent{Spec: spec, ID: 3, Closed: true, Err: errors.New("connection refused")},
+			want:  "[#3 3000] could not reach localhost:3000: connection refused",
+		},
+		{
+			name:  "proxy destination denied",
+			event: remote.ForwardEvent{Spec: remote.ForwardSpec{LocalPort: 1080, RemoteHost: "example.com", RemotePort: 443}, ID: 4, Closed: true, Err: fmt.Errorf("%w: example.com:443", remote.ErrDestinationDenied)},
+			want:  "[#4 1080] denied example.com:443 (not in proxy_allow)",
+		},
+		{
+			name:  "proxy handshake failure",
+			event: remote.ForwardEvent{Spec: remote.ForwardSpec{LocalPort: 1080}, ID: 5, Peer: "127.0.0.1:52000", Closed: true, Err: errors.New("authentication failed")},
+			want:  "[#5 1080] rejected 127.0.0.1:52000: authentication failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeForwardEvent(tt.event); got != tt.want {
+				t.Errorf("describeForwardEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("stats total closed connections", func(t *testing.T) {
+		stats := &forwardStats{}
+		for _, tt := range tests {
+			stats.add(tt.event)
+		}
+		want := "4 connection(s), sent 512 B, received 2.0 KiB (3 failed)"
+		if got := stats.String(); got != want {
+			t.Errorf("stats = %q, want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Manage trusted SSH host keys",
+	Long: `Inspect and edit the entries labman relies on in ~/.ssh/known_hosts.
+Every connection verifies the server's host key; use these commands to trust a
+new server up front, forget a key after a reinstall, or see what is recorded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		printBanner(cmd)
+		printSection(cmd, "HOSTS", "Use 'labman hosts trust', 'labman hosts forget', or 'labman hosts show'")
+	},
+}
+
+var hostsTrustCmd = &cobra.Command{
+	Use:   "trust <host|alias>",
+	Short: "Fetch a server's host key and add it to known_hosts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		addr, err := hostKeyAddress(args[0])
+		if err != nil {
+			return err
+		}
+
+		key, err := remote.FetchHostKey(addr, remote.DefaultConnectTimeout)
+		if err != nil {
+			return err
+		}
+
+		assumeYes, _ := cmd.Flags().GetBool("yes")
+		if !assumeYes {
+			accepted, err := confirmHostKey(addr, key)
+			if err != nil {
+				return err
+			}
+			if !accepted {
+				return fmt.Errorf("host key for %s was not accepted", addr)
+			}
+		}
+
+		added, err := remote.TrustHostKey("", addr, key)
+		if err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Added %s key %s for %s", key.Type(), ssh.FingerprintSHA256(key), addr)
+		if !added {
+			message = fmt.Sprintf("%s is already trusted (%s %s)", addr, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		printSection(cmd, "HOST TRUSTED", message)
+		return nil
+	},
+}
+
+var hostsForgetCmd = &cobra.Command{
+	Use:   "forget <host|alias>",
+	Short: "Remove a server's entries from known_hosts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		addr, err := hostKeyAddress(args[0])
+		if err != nil {
+			return err
+		}
+
+		removed, err := remote.ForgetHost("", addr)
+		if err != nil {
+			return err
+		}
+
+		if removed == 0 {
+			printSection(cmd, "HOST FORGOTTEN", fmt.Sprintf("No known_hosts entries found for %s", addr))
+			return nil
+		}
+		printSection(cmd, "HOST FORGOTTEN", fmt.Sprintf("Removed %d known_hosts entries for %s", removed, addr))
+		return nil
+	},
+}
+
+var hostsShowCmd = &cobra.Command{
+	Use:   "show <host|alias>",
+	Short: "Show the host keys recorded for a server",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		addr, err := hostKeyAddress(args[0])
+		if err != nil {
+			return err
+		}
+
+		entries, err := remote.KnownHostEntries("", addr)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			printSection(cmd, "KNOWN HOST KEYS", fmt.Sprintf("%s is not in known_hosts (run 'labman hosts trust %s')", addr, args[0]))
+			return nil
+		}
+
+		body := &strings.Builder{}
+		for _, entry := range entries {
+			marker := ""
+			if entry.Marker != "" {
+				marker = "@" + entry.Marker + " "
+			}
+			fmt.Fprintf(body, "line %-4d %s%-20s %s\n", entry.Line, marker, entry.KeyType, entry.Fingerprint)
+		}
+		printSection(cmd, fmt.Sprintf("KNOWN HOST KEYS (%s)", addr), body.String())
+		return nil
+	},
+}
+
+// hostKeyAddress resolves an alias or hostname to the host:port used in known_hosts.
+func hostKeyAddress(identifier string) (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("load config: %w", err)
+	}
+
+	host, _, port, _, err := cfg.ResolveHost(identifier)
+	if err != nil {
+		return "", fmt.Errorf("resolve host: %w", err)
+	}
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// confirmHostKey shows the fingerprint of an unknown host and asks whether to trust it.
+func confirmHostKey(hostname string, key ssh.PublicKey) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("cannot confirm host key without a terminal")
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host %s can't be established.\n", hostname)
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	fmt.Fprint(os.Stderr, "Trust this host and add it to known_hosts? [y/N]: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("read answer: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(hostsCmd)
+	hostsCmd.AddCommand(hostsTrustCmd)
+	hostsCmd.AddCommand(hostsForgetCmd)
+	hostsCmd.AddCommand(hostsShowCmd)
+
+	hostsTrustCmd.Flags().BoolP("yes", "y", false, "trust the key without prompting")
+
+	remote.HostKeyPrompt = confirmHostKey
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/tinotenda-alfaneti/labman/internal/config"
@@ -20,6 +21,12 @@ var loginCmd = &cobra.Command{
 	Short: "Authenticate to a server and cache the SSH session",
 	Long: `Establishes an SSH connection to the specified host, verifies the host key,
 and saves the credentials in the local keyring so other commands can reuse them.
+Without a keyring (headless boxes, CI runners) use --credential-store file or
+auto to keep them in a passphrase-encrypted file instead.
+
+Authentication follows the host's auth_methods order (default: key_file,
+then ssh-agent via SSH_AUTH_SOCK, then password). The password is only
+requested once the key-based methods have been rejected.
 
 The host argument can be:
   - A configured host alias from ~/.labman/config.yaml
@@ -28,7 +35,10 @@ The host argument can be:
 Examples:
   labman login homelab-prod              # Use configured alias
   labman login 192.168.1.10 -u admin     # Direct IP with username
-  labman login my-server --password-stdin < password.txt`,
+  labman login my-server --password-stdin < password.txt
+
+Hosts with proxy_jump are reached through the listed bastions, each of which
+is authenticated and host-key checked on its own.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		printBanner(cmd)
@@ -41,10 +51,12 @@ Examples:
 
 		// Resolve host (could be alias or direct IP/hostname)
 		hostIdentifier := args[0]
-		serverIP, defaultUsername, port, keyFile, err := cfg.ResolveHost(hostIdentifier)
-		if err != nil {
-			return fmt.Errorf("resolve host: %w", err)
+		hostConfig := cfg.Lookup(hostIdentifier)
+		if hostConfig.IsLocal() {
+			printSection(cmd, "LOGIN", fmt.Sprintf("%s is this machine; no login is needed. Run workflows with --host %s or --local.", hostIdentifier, hostIdentifier))
+			return nil
 		}
+		serverIP, defaultUsername, port, keyFile := hostConfig.Host, hostConfig.Username, hostConfig.Port, hostConfig.KeyFile
 
 		// Get username (flag takes precedence over config)
 		user, err := cmd.Flags().GetString("username")
@@ -58,13 +70,15 @@ Examples:
 			return fmt.Errorf("username is required (specify with -u or set in config)")
 		}
 
-		// Get password
-		password, err := getPassword(cmd)
+		// The password is only needed when key-based methods are unavailable or rejected
+		auth, err := authOptions(cmd, hostConfig, getPassword)
 		if err != nil {
-			return fmt.Errorf("read password: %w", err)
+			return err
 		}
-		if password == "" {
-			return fmt.Errorf("password is required")
+
+		opts, err := sessionOptions(cfg, hostConfig, user, auth)
+		if err != nil {
+			return err
 		}
 
 		// Show connection info
@@ -75,27 +89,218 @@ Examples:
 		if keyFile != "" {
 			connectionInfo += fmt.Sprintf("\nKey file: %s", keyFile)
 		}
+		if via := describeJumps(opts); via != "" {
+			connectionInfo += fmt.Sprintf("\nJump hosts: %s", strings.TrimPrefix(via, "via "))
+		}
 		printSection(cmd, "LOGIN", connectionInfo)
 
-		loginClient, err := remote.NewSSHSession(serverIP, user, password)
+		loginClient, err := remote.NewSSHSession(opts)
 		if err != nil {
 			return fmt.Errorf("failed to login to SSH session: %w", err)
 		}
 		defer loginClient.Close()
+		loginClient.Name = remote.SessionName(hostIdentifier)
+		loginClient.Expiry = sessionExpiry(hostConfig)
 
 		if !loginClient.IsConnected() {
 			return fmt.Errorf("failed to connect to server")
 		}
 
+		if err := ensureSudoPassword(loginClient); err != nil {
+			return err
+		}
+
 		if err := remote.SaveSession(loginClient); err != nil {
 			return fmt.Errorf("failed to save session: %w", err)
 		}
 
-		printSection(cmd, "SUCCESS", "Login successful and session saved.")
+		printSection(cmd, "SUCCESS", fmt.Sprintf("Login successful (%s auth) and session saved as %s (now active).", loginClient.AuthMethod, loginClient.Name))
 		return nil
 	},
 }
 
+// authOptions builds the credentials for a login. When only password auth is
+// possible the password is read up front; otherwise it is only requested if
+// the agent and key file are rejected.
+func authOptions(cmd *cobra.Command, host config.Host, readPassword func(*cobra.Command) (string, error)) (remote.AuthOptions, error) {
+	auth := remote.AuthOptions{Methods: host.AuthMethods}
+	if host.KeyFile != "" {
+		auth.KeyFile = config.ExpandPath(host.KeyFile)
+	}
+	if host.CertFile != "" {
+		auth.CertFile = config.ExpandPath(host.CertFile)
+	}
+
+	keyPossible := auth.KeyFile != "" && allowsAuthMethod(auth.Methods, remote.AuthPublicKey)
+	agentPossible := remote.AgentAvailable() && allowsAuthMethod(auth.Methods, remote.AuthAgent)
+	if !keyPossible && !agentPossible {
+		password, err := readPassword(cmd)
+		if err != nil {
+			return remote.AuthOptions{}, fmt.Errorf("read password: %w", err)
+		}
+		if password == "" {
+			return remote.AuthOptions{}, fmt.Errorf("password is required")
+		}
+		auth.Password = password
+		return auth, nil
+	}
+
+	if !allowsAuthMethod(auth.Methods, remote.AuthPassword) {
+		return auth, nil
+	}
+	if passwordProvided(cmd) {
+		password, err := readPassword(cmd)
+		if err != nil {
+			return remote.AuthOptions{}, fmt.Errorf("read password: %w", err)
+		}
+		auth.Password = password
+		return auth, nil
+	}
+	auth.PasswordPrompt = func() (string, error) { return readPassword(cmd) }
+	return auth, nil
+}
+
+// sessionOptions assembles the dial options for a resolved host, including
+// the bastions named by its proxy_jump.
+func sessionOptions(cfg *config.Config, hostConfig config.Host, user string, auth remote.AuthOptions) (remote.SessionOptions, error) {
+	chain, err := cfg.JumpChain(hostConfig)
+	if err != nil {
+		return remote.SessionOptions{}, fmt.Errorf("resolve proxy_jump: %w", err)
+	}
+
+	opts := remote.SessionOptions{
+		Host:              hostConfig.Host,
+		Port:              hostConfig.Port,
+		User:              user,
+		Timeout:           cfg.Defaults.ConnectionTimeout,
+		Auth:              auth,
+		HostKeyPolicy:     remote.HostKeyPolicy(hostConfig.HostKeyPolicy),
+		KeepaliveInterval: cfg.Defaults.KeepaliveInterval,
+		Sudo:              remote.SudoMode(hostConfig.Sudo),
+	}
+	for _, hop := range chain {
+		if hop.Username == "" {
+			return remote.SessionOptions{}, fmt.Errorf("jump host %s needs a username (use user@host or set one in config)", hop.Host)
+		}
+		opts.Jumps = append(opts.Jumps, remote.SessionOptions{
+			Host:          hop.Host,
+			Port:          hop.Port,
+			User:          hop.Username,
+			Timeout:       cfg.Defaults.ConnectionTimeout,
+			Auth:          jumpAuthOptions(hop),
+			HostKeyPolicy: remote.HostKeyPolicy(hop.HostKeyPolicy),
+		})
+	}
+	return opts, nil
+}
+
+// sessionExpiry turns a host's session_* settings into cache expiry options.
+func sessionExpiry(host config.Host) remote.SessionExpiry {
+	return remote.SessionExpiry{
+		TTL:     host.SessionTTL,
+		Sliding: host.SessionExpiry == "sliding",
+		MaxTTL:  host.SessionMaxTTL,
+	}
+}
+
+// jumpAuthOptions builds the credentials for a bastion. Login flags belong to
+// the target host, so a bastion password is always asked for on the terminal.
+func jumpAuthOptions(hop config.Host) remote.AuthOptions {
+	auth := remote.AuthOptions{Methods: hop.AuthMethods}
+	if hop.KeyFile != "" {
+		auth.KeyFile = config.ExpandPath(hop.KeyFile)
+	}
+	if hop.CertFile != "" {
+		auth.CertFile = config.ExpandPath(hop.CertFile)
+	}
+	auth.PasswordPrompt = func() (string, error) {
+		return readTerminalSecret(fmt.Sprintf("Password for %s@%s: ", hop.Username, hop.Host))
+	}
+	return auth
+}
+
+// ensureSudoPassword asks for the sudo password when a host uses sudo
+// password mode but the login itself did not need one.
+func ensureSudoPassword(session *remote.SSHSession) error {
+	if session.Sudo != remote.SudoPassword || session.Password != "" || session.SudoPassword != "" {
+		return nil
+	}
+
+	password, err := readTerminalSecret(fmt.Sprintf("Sudo password for %s@%s: ", session.User, session.Host))
+	if err != nil {
+		return fmt.Errorf("read sudo password: %w", err)
+	}
+	session.SudoPassword = password
+	return nil
+}
+
+// describeJumps renders the bastion chain as "via a -> b", or "" without one.
+func describeJumps(opts remote.SessionOptions) string {
+	if len(opts.Jumps) == 0 {
+		return ""
+	}
+	hops := make([]string, 0, len(opts.Jumps))
+	for _, hop := range opts.Jumps {
+		hops = append(hops, fmt.Sprintf("%s@%s", hop.User, hop.Addr()))
+	}
+	return "via " + strings.Join(hops, " -> ")
+}
+
+// readTerminalSecret prompts on stderr and reads a line without echo.
+func readTerminalSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt %q without a terminal", strings.TrimSpace(prompt))
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read from terminal: %w", err)
+	}
+	return string(secret), nil
+}
+
+// allowsAuthMethod reports whether method is part of the configured order.
+// An empty order allows every method.
+func allowsAuthMethod(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, candidate := range methods {
+		if candidate == method {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordProvided reports whether the password was given on the command line or stdin.
+func passwordProvided(cmd *cobra.Command) bool {
+	if passStdin, _ := cmd.Flags().GetBool("password-stdin"); passStdin {
+		return true
+	}
+	passFlag, _ := cmd.Flags().GetString("password")
+	return passFlag != ""
+}
+
+// readPassphrase prompts on the terminal for the passphrase of an encrypted key.
+func readPassphrase(keyFile string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for the passphrase of %s without a terminal", keyFile)
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key %s: ", keyFile)
+	passBytes, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase from terminal: %w", err)
+	}
+	return string(passBytes), nil
+}
+
 func getPassword(cmd *cobra.Command) (string, error) {
 	// Check if password provided via stdin
 	passStdin, _ := cmd.Flags().GetBool("password-stdin")
@@ -129,4 +334,6 @@ func init() {
 	loginCmd.Flags().StringP("username", "u", "", "username for ssh login (overrides config)")
 	loginCmd.Flags().StringP("password", "p", "", "(insecure) password for ssh login - prefer interactive prompt or --password-stdin")
 	loginCmd.Flags().Bool("password-stdin", false, "read password from stdin")
+
+	remote.PassphrasePrompt = readPassphrase
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestAuthOptions(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().StringP("password", "p", "", "")
+		cmd.Flags().Bool("password-stdin", false, "")
+		return cmd
+	}
+	readCalls := 0
+	readPassword := func(*cobra.Command) (string, error) {
+		readCalls++
+		return "secret", nil
+	}
+
+	t.Run("reads password up front when only password auth is possible", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		readCalls = 0
+
+		auth, err := authOptions(newCmd(), config.Host{Host: "lab"}, readPassword)
+		if err != nil {
+			t.Fatalf("authOptions: %v", err)
+		}
+		if readCalls != 1 || auth.Password != "secret" || auth.PasswordPrompt != nil {
+			t.Fatalf("expected eager password, got calls=%d auth=%+v", readCalls, auth)
+		}
+	})
+
+	t.Run("defers password prompt when a key file is configured", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		readCalls = 0
+
+		auth, err := authOptions(newCmd(), config.Host{Host: "lab", KeyFile: "/keys/id"}, readPassword)
+		if err != nil {
+			t.Fatalf("authOptions: %v", err)
+		}
+		if readCalls != 0 || auth.PasswordPrompt == nil || auth.KeyFile != "/keys/id" {
+			t.Fatalf("expected lazy password prompt, got calls=%d auth=%+v", readCalls, auth)
+		}
+	})
+
+	t.Run("defers password prompt when an agent is available", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+		readCalls = 0
+
+		auth, err := authOptions(newCmd(), config.Host{Host: "lab", AuthMethods: []string{"agent", "password"}}, readPassword)
+		if err != nil {
+			t.Fatalf("authOptions: %v", err)
+		}
+		if readCalls != 0 || auth.PasswordPrompt == nil {
+			t.Fatalf("expected lazy password prompt, got calls=%d", readCalls)
+		}
+		if len(auth.Methods) != 2 || auth.Methods[0] != "agent" {
+			t.Fatalf("expected configured order to be passed through, got %v", auth.Methods)
+		}
+	})
+
+	t.Run("omits password when excluded from auth methods", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+		readCalls = 0
+
+		auth, err := authOptions(newCmd(), config.Host{Host: "lab", AuthMethods: []string{"agent"}}, readPassword)
+		if err != nil {
+			t.Fatalf("authOptions: %v", err)
+		}
+		if readCalls != 0 || auth.PasswordPrompt != nil || auth.Password != "" {
+			t.Fatalf("expected no password, got calls=%d auth=%+v", readCalls, auth)
+		}
+	})
+
+	t.Run("requires a password when nothing else is possible", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+
+		_, err := authOptions(newCmd(), config.Host{Host: "lab"}, func(*cobra.Command) (string, error) {
+			return "", nil
+		})
+		if err == nil || err.Error() != "password is required" {
+			t.Fatalf("expected password is required, got %v", err)
+		}
+	})
+
+	t.Run("propagates read errors", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+
+		_, err := authOptions(newCmd(), config.Host{Host: "lab"}, func(*cobra.Command) (string, error) {
+			return "", errors.New("no tty")
+		})
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestSessionOptionsJumps(t *testing.T) {
+	cfg := &config.Config{
+		Hosts: map[string]config.Host{
+			"bastion":  {Host: "bastion.example", Username: "jump", Port: 2200},
+			"internal": {Host: "10.0.0.5", Username: "admin", ProxyJump: "bastion, ops@gw.example:2222"},
+		},
+	}
+
+	t.Run("resolves the chain outermost first", func(t *testing.T) {
+		opts, err := sessionOptions(cfg, cfg.Lookup("internal"), "admin", remote.AuthOptions{})
+		if err != nil {
+			t.Fatalf("sessionOptions: %v", err)
+		}
+		if len(opts.Jumps) != 2 {
+			t.Fatalf("expected 2 jump hosts, got %d", len(opts.Jumps))
+		}
+		if got := describeJumps(opts); got != "via jump@bastion.example:2200 -> ops@gw.example:2222" {
+			t.Fatalf("unexpected chain %q", got)
+		}
+	})
+
+	t.Run("requires a username for every hop", func(t *testing.T) {
+		host := config.Host{Host: "10.0.0.6", ProxyJump: "gw.example"}
+		if _, err := sessionOptions(cfg, host, "admin", remote.AuthOptions{}); err == nil {
+			t.Fatalf("expected error for jump host without username")
+		}
+	})
+}
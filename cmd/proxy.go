@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// proxyPasswordEnv supplies the SOCKS password for --auth-user without a prompt.
+const proxyPasswordEnv = "LABMAN_PROXY_PASSWORD"
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy <host>",
+	Short: "Run a SOCKS5 proxy that tunnels through the server",
+	Long: `Starts a local SOCKS5 server; every CONNECT is tunnelled through the cached
+SSH session, so a browser pointed at it reaches the LAN as the server sees it.
+
+Without --auth-user clients connect without authentication, so keep the
+listener on loopback. With --auth-user, clients must send that username and
+the password from $LABMAN_PROXY_PASSWORD (prompted for when unset).
+
+Destinations can be limited per host with proxy_allow in the config file:
+hostnames with * wildcards, IPs or CIDR ranges, each optionally with :port.
+
+Examples:
+  labman proxy homelab-prod
+  labman proxy homelab-prod --listen 127.0.0.1:1081 --auth-user lab`,
+	Args:              cobra.ExactArgs(1),
+	PersistentPreRunE: requireSession,
+	PersistentPostRun: cleanupSession,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := remote.Current()
+		if client == nil {
+			return fmt.Errorf("not connected to any server. Run 'labman login' first")
+		}
+
+		user, host, ok := strings.Cut(args[0], "@")
+		if !ok {
+			user, host = "", args[0]
+		}
+		if err := checkSessionHost(client, host, user); err != nil {
+			return err
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+
+		listen, _ := cmd.Flags().GetString("listen")
+		opts := remote.ProxyOptions{
+			Listen: listen,
+			Allow:  cfg.Lookup(host).ProxyAllow,
+		}
+		opts.Username, _ = cmd.Flags().GetString("auth-user")
+		if opts.Username != "" {
+			opts.Password = os.Getenv(proxyPasswordEnv)
+			if opts.Password == "" {
+				if opts.Password, err = readTerminalSecret(fmt.Sprintf("SOCKS password for %s: ", opts.Username)); err != nil {
+					return fmt.Errorf("read proxy password: %w", err)
+				}
+			}
+		}
+
+		printSection(cmd, "SOCKS5 PROXY", describeProxy(opts, client))
+
+		stats := &forwardStats{}
+		err = client.Proxy(commandContext(cmd), opts, func(event remote.ForwardEvent) {
+			stats.add(event)
+			fmt.Fprintln(cmd.ErrOrStderr(), describeForwardEvent(event))
+		})
+		if err != nil {
+			return fmt.Errorf("proxy failed: %w", err)
+		}
+
+		printSection(cmd, "STOPPED", stats.String())
+		return nil
+	},
+}
+
+func describeProxy(opts remote.ProxyOptions, client *remote.SSHSession) string {
+	lines := []string{
+		fmt.Sprintf("Listening on socks5://%s via %s@%s", opts.Listen, client.User, client.Host),
+	}
+	if opts.Username != "" {
+		lines = append(lines, fmt.Sprintf("Authentication: username/password (%s)", opts.Username))
+	} else {
+		lines = append(lines, "Authentication: none")
+	}
+	if len(opts.Allow) > 0 {
+		lines = append(lines, "Allowed destinations: "+strings.Join(opts.Allow, ", "))
+	} else {
+		lines = append(lines, "Allowed destinations: any")
+	}
+	return strings.Join(lines, "\n") + "\n\nPress Ctrl-C to stop."
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+
+	proxyCmd.Flags().String("listen", remote.DefaultProxyListen, "Address for the SOCKS5 listener")
+	proxyCmd.Flags().String("auth-user", "", "Require this SOCKS username (password from $"+proxyPasswordEnv+" or a prompt)")
+}
@@ -4,13 +4,27 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var cfgFile string
 
+// sessionHost selects a cached session by alias instead of the active one
+var sessionHost string
+
+// credentialStore overrides credential_store: keyring, file, or auto
+var credentialStore string
+
+// commandTimeout bounds every remote command run by a workflow (0 = no limit)
+var commandTimeout time.Duration
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "labman",
@@ -22,14 +36,41 @@ Use it as the entry point for every cluster subcommand.`,
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Ctrl-C cancels the command's context; a second Ctrl-C exits immediately.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	var exit *exitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.code)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// exitError makes labman exit with a status other than 1 without printing an
+// error, e.g. to pass on the exit code of a remote command.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func init() {
+	cobra.OnInitialize(initCredentialStore)
+
 	// Global flags available to all commands
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ~/.labman/config.yaml or $XDG_CONFIG_HOME/labman/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&sessionHost, "host", "", "use the cached session for this alias instead of the active one (see 'labman session list')")
+	rootCmd.PersistentFlags().StringVar(&credentialStore, "credential-store", "", "where session secrets are kept: keyring, file (passphrase-encrypted), or auto (default from config, else keyring)")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "timeout", 0, "abort any remote command that runs longer than this (e.g. 30s, 5m; 0 disables)")
 }
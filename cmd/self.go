@@ -4,6 +4,8 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -18,8 +20,8 @@ var selfCmd = &cobra.Command{
 	Short: "Run maintenance tasks directly on the server",
 	Long: `Use the self command for host-level operations such as updating packages,
 cleaning disk space, or checking system status without touching the cluster.`,
-	PersistentPreRunE: requireSession,
-	PersistentPostRun: cleanupSession,
+	PersistentPreRunE: requireExecutor,
+	PersistentPostRun: cleanupExecutor,
 	Run: func(cmd *cobra.Command, args []string) {
 		printBanner(cmd)
 		printSection(cmd, "SELF", "Run 'labman self info' or other maintenance subcommands")
@@ -32,12 +34,20 @@ var selfInfoCmd = &cobra.Command{
 	Long: `Fetches and displays system information from the remote host,
 including OS version, kernel details, and hardware specs.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
-		output, err := client.Run("uname -a && lsb_release -a && lscpu")
+		ctx := commandContext(cmd)
+
+		facts, err := hostFacts(ctx, client)
+		if err != nil {
+			return fmt.Errorf("failed to fetch system info: %w", err)
+		}
+		printSection(cmd, "PLATFORM", formatFacts(facts))
+
+		output, err := client.RunIdempotent(ctx, systemInfoCommand(facts))
 		if err != nil {
 			return fmt.Errorf("failed to fetch system info: %w", err)
 		}
@@ -58,52 +68,63 @@ var selfCleanCmd = &cobra.Command{
 - Optionally prunes MicroK8s container images`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		out := cmd.OutOrStdout()
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
+		ctx := commandContext(cmd)
+
+		facts, err := hostFacts(ctx, client)
+		if err != nil {
+			return fmt.Errorf("detect platform: %w", err)
+		}
+		packages, err := packageCommandsFor(facts)
+		if err != nil {
+			return fmt.Errorf("self clean: %w", err)
+		}
+
 		fmt.Fprintln(out, "===== SYSTEM MAINTENANCE =====")
+		fmt.Fprintf(out, "Platform: %s\n", facts.Describe())
 		fmt.Fprintln(out, "Starting maintenance sequence...")
 
 		// helper to run a command and print status
 		run := func(name, command string) error {
 			fmt.Fprintf(out, "→ %s\n", name)
-			err := client.RunStream(command, out)
+			err := client.RunStreamSudo(remote.Mutating(ctx, name), command, out)
+			var cmdErr *remote.CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Result.CommandNotFound() {
+				fmt.Fprintf(out, "%s skipped: command not available on this host\n", name)
+				return nil
+			}
 			if err != nil {
 				fmt.Fprintf(out, "%s failed: %v\n", name, err)
 				return err
 			}
-			fmt.Fprintf(out, "%s completed\n", name)
+			fmt.Fprintln(out, outcome(name+" completed", name+" would run"))
 			return nil
 		}
 
-		before, _ := client.Run(`df -h / | awk 'NR==2{print $4}'`)
+		before, _ := client.RunContext(ctx, `df -h / | awk 'NR==2{print $4}'`)
 		before = strings.TrimSpace(before)
 
-		steps := []struct {
-			Name    string
-			Command string
-		}{
-			{"Update package lists", "sudo apt-get update -y"},
-			{"Upgrade packages", "sudo DEBIAN_FRONTEND=noninteractive apt-get upgrade -yq"},
-			{"Clean old packages", "sudo apt-get autoremove -y && sudo apt-get autoclean -y"},
-			{"Vacuum logs (7 days)", "sudo journalctl --vacuum-time=7d"},
-			{"Sync system clock", "sudo timedatectl set-ntp true"},
-			{"Prune container images", "sudo microk8s ctr image prune -a || true"},
-		}
-
 		var failed []string
-		for i, s := range steps {
-			fmt.Fprintf(out, "[%d/%d] %s...\n", i+1, len(steps), s.Name)
-			if err := run(s.Name, s.Command); err != nil {
+		for i, s := range selfCleanSteps {
+			fmt.Fprintf(out, "[%d/%d] %s...\n", i+1, len(selfCleanSteps), s.Name)
+			command, skipped := s.Command(packages, facts)
+			if command == "" {
+				fmt.Fprintf(out, "→ %s\n%s skipped: %s\n", s.Name, s.Name, skipped)
+				continue
+			}
+			if err := run(s.Name, command); err != nil {
 				failed = append(failed, s.Name)
 			}
 		}
+		forgetHostFacts(cmd.ErrOrStderr())
 
-		rebootReq, _ := client.Run("test -f /var/run/reboot-required && echo 'yes' || echo 'no'")
+		rebootReq, _ := client.RunContext(ctx, "test -f /var/run/reboot-required && echo 'yes' || echo 'no'")
 		rebootReq = strings.TrimSpace(rebootReq)
-		after, _ := client.Run(`df -h / | awk 'NR==2{print $4}'`)
+		after, _ := client.RunContext(ctx, `df -h / | awk 'NR==2{print $4}'`)
 		after = strings.TrimSpace(after)
 
 		fmt.Fprintln(out, "--------------------------------------------------")
@@ -113,7 +134,7 @@ var selfCleanCmd = &cobra.Command{
 		if len(failed) > 0 {
 			fmt.Fprintf(out, "Failed steps    : %s\n", strings.Join(failed, ", "))
 		} else {
-			fmt.Fprintln(out, "All steps completed successfully.")
+			fmt.Fprintln(out, outcome("All steps completed successfully.", "Dry run: no step was run."))
 		}
 		fmt.Fprintf(out, "Completed at    : %s\n", time.Now().Format(time.RFC1123))
 		fmt.Fprintln(out, "--------------------------------------------------")
@@ -121,35 +142,102 @@ var selfCleanCmd = &cobra.Command{
 	},
 }
 
+// selfCleanSteps are the maintenance steps of 'self clean', all run as root.
+// Command picks what a step runs on the host, or returns "" and the reason
+// the step does not apply there.
+var selfCleanSteps = []struct {
+	Name    string
+	Command func(packages packageCommands, facts *remote.Facts) (command, skipped string)
+}{
+	{"Update package lists", func(packages packageCommands, _ *remote.Facts) (string, string) {
+		return packages.Refresh, ""
+	}},
+	{"Upgrade packages", func(packages packageCommands, _ *remote.Facts) (string, string) {
+		return packages.Upgrade, ""
+	}},
+	{"Clean old packages", func(packages packageCommands, _ *remote.Facts) (string, string) {
+		return packages.Clean, ""
+	}},
+	{"Vacuum logs (7 days)", func(_ packageCommands, facts *remote.Facts) (string, string) {
+		if !facts.Has("journalctl") {
+			return "", "no systemd journal on this host"
+		}
+		return "journalctl --vacuum-time=7d", ""
+	}},
+	{"Sync system clock", func(_ packageCommands, facts *remote.Facts) (string, string) {
+		if !facts.Has("timedatectl") {
+			return "", "timedatectl is not installed; configure NTP with the host's own tools"
+		}
+		return "timedatectl set-ntp true", ""
+	}},
+	{"Prune container images", func(_ packageCommands, facts *remote.Facts) (string, string) {
+		flavor, ok := kubeFlavorFor(facts)
+		switch {
+		case !ok:
+			return "", "neither microk8s nor k3s is installed"
+		case flavor.Name == "k3s":
+			return "k3s crictl rmi --prune", ""
+		}
+		return "microk8s ctr image prune -a || true", ""
+	}},
+}
+
 var selfUpgradeOSCmd = &cobra.Command{
 	Use:   "upgrade",
-	Short: "Safely upgrade the OS on the current MicroK8s node without disrupting workloads",
+	Short: "Safely upgrade the OS on the current MicroK8s or k3s node without disrupting workloads",
 	Long: `Performs a safe, Kubernetes-aware OS upgrade on the current node:
 
 1. Detects Pi-hole and warns
 2. Cordon + drain the node (move workloads away)
-3. Run non-interactive apt upgrade
+3. Run a non-interactive upgrade with the host's package manager
+   (apt, dnf, yum, pacman, apk or zypper)
 4. Optionally refresh microk8s
 5. Reboot
-6. Wait for node + microk8s to be ready again
+6. Wait for node + microk8s (or k3s) to be ready again
 7. Uncordon the node
 
 This command assumes you have a working SSH session via 'labman login'.`,
-	PreRunE: requireSession, // your existing helper
+	PreRunE: requireExecutor, // your existing helper
 	RunE: func(cmd *cobra.Command, args []string) error {
 		out := cmd.OutOrStdout()
 
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
+		ctx := commandContext(cmd)
+
 		doRefreshMicrok8s, _ := cmd.Flags().GetBool("refresh-microk8s")
 		skipReboot, _ := cmd.Flags().GetBool("no-reboot")
 
+		// Waiting for the node to come back means re-dialing it over SSH.
+		session := currentSession()
+		overSSH := session != nil
+		if !skipReboot && !overSSH && !dryRun {
+			return fmt.Errorf("self upgrade cannot wait for this machine to reboot; pass --no-reboot and reboot it yourself")
+		}
+
+		facts, err := hostFacts(ctx, client)
+		if err != nil {
+			return fmt.Errorf("detect platform: %w", err)
+		}
+		packages, err := packageCommandsFor(facts)
+		if err != nil {
+			return fmt.Errorf("self upgrade: %w", err)
+		}
+		kube, ok := kubeFlavorFor(facts)
+		if !ok {
+			return fmt.Errorf("self upgrade drains the node through microk8s or k3s, and neither is installed on %s", facts.Describe())
+		}
+		if doRefreshMicrok8s && (kube.Name != "microk8s" || !facts.Has("snap")) {
+			return fmt.Errorf("--refresh-microk8s needs microk8s installed as a snap, which %s does not have", facts.Describe())
+		}
+
 		fmt.Fprintln(out, "===== CLUSTER OS UPGRADE =====")
+		fmt.Fprintf(out, "Platform: %s, %s\n", facts.Describe(), kube.Name)
 
-		hostnameRaw, err := client.Run("hostname")
+		hostnameRaw, err := client.RunIdempotent(ctx, "hostname")
 		if err != nil {
 			return fmt.Errorf("failed to detect hostname: %w", err)
 		}
@@ -157,45 +245,55 @@ This command assumes you have a working SSH session via 'labman login'.`,
 		fmt.Fprintf(out, "Target node: %s\n", nodeName)
 
 		fmt.Fprintln(out, "→ Checking for Pi-hole on host ...")
-		piholeStatus, _ := client.Run("systemctl is-active pihole-FTL 2>/dev/null || true")
+		piholeStatus, _ := client.RunIdempotent(ctx, "systemctl is-active pihole-FTL 2>/dev/null || true")
 		if strings.TrimSpace(piholeStatus) == "active" {
 			fmt.Fprintln(out, "Pi-hole is running directly on this host.")
 			fmt.Fprintln(out, "DNS may be unavailable while this node reboots.")
 		}
 
 		// 3) check for velero and attempt pre-upgrade backup (best-effort)
-		fmt.Fprintln(out, "→ Checking for Velero ...")
-		_, _ = client.Run("microk8s kubectl get ns velero >/dev/null 2>&1 || true")
-		_, _ = client.Run(`microk8s kubectl get ns velero >/dev/null 2>&1 && microk8s velero create backup pre-upgrade-$(date +%F-%H%M) || true`)
-		fmt.Fprintln(out, "Velero check complete (backup best-effort).")
+		if kube.Name == "microk8s" {
+			fmt.Fprintln(out, "→ Checking for Velero ...")
+			_, _ = client.RunContext(ctx, "microk8s kubectl get ns velero >/dev/null 2>&1 || true")
+			_, _ = client.RunContext(remote.Mutating(ctx, "Create Velero backup"), `microk8s kubectl get ns velero >/dev/null 2>&1 && microk8s velero create backup pre-upgrade-$(date +%F-%H%M) || true`)
+			fmt.Fprintln(out, outcome("Velero check complete (backup best-effort).", "Velero check complete (backup not created in a dry run)."))
+		} else {
+			fmt.Fprintln(out, "→ Skipping Velero backup (only the microk8s addon is supported).")
+		}
 
 		fmt.Fprintf(out, "→ Cordoning node %s ...\n", nodeName)
-		if _, err := client.Run("sudo microk8s kubectl cordon " + nodeName); err != nil {
+		if _, err := client.RunSudo(remote.Mutating(ctx, "Cordon node"), kube.Kubectl+" cordon "+nodeName); err != nil {
 			return fmt.Errorf("failed to cordon node: %w", err)
 		}
-		fmt.Fprintln(out, "Node cordoned.")
+		fmt.Fprintln(out, outcome("Node cordoned.", "Node would be cordoned."))
 
 		fmt.Fprintf(out, "→ Draining node %s ...\n", nodeName)
-		drainCmd := "sudo microk8s kubectl drain " + nodeName + " --ignore-daemonsets --delete-emptydir-data --force"
-		if _, err := client.Run(drainCmd); err != nil {
+		drainCmd := kube.Kubectl + " drain " + nodeName + " --ignore-daemonsets --delete-emptydir-data --force"
+		if _, err := client.RunSudo(remote.Mutating(ctx, "Drain node"), drainCmd); err != nil {
 			fmt.Fprintf(out, "drain reported an error: %v\n", err)
 		} else {
-			fmt.Fprintln(out, "Node drained.")
+			fmt.Fprintln(out, outcome("Node drained.", "Node would be drained."))
 		}
 
 		fmt.Fprintln(out, "→ Updating package lists & upgrading OS (non-interactive) ...")
-		upgradeCmd := "sudo apt-get update -y && sudo DEBIAN_FRONTEND=noninteractive apt-get full-upgrade -yq && sudo do-release-upgrade"
-		if _, err := client.Run(upgradeCmd); err != nil {
+		upgradeCmd := packages.UpgradeOS
+		if facts.Has("do-release-upgrade") {
+			upgradeCmd += " && do-release-upgrade"
+		}
+		_, err = client.RunSudo(remote.Mutating(ctx, "Upgrade OS packages"), upgradeCmd)
+		// Even a failed upgrade may have changed the release or packages.
+		forgetHostFacts(cmd.ErrOrStderr())
+		if err != nil {
 			return fmt.Errorf("failed to run OS upgrade: %w", err)
 		}
-		fmt.Fprintln(out, "OS packages upgraded.")
+		fmt.Fprintln(out, outcome("OS packages upgraded.", "OS packages would be upgraded."))
 
 		if doRefreshMicrok8s {
 			fmt.Fprintln(out, "→ Refreshing microk8s snap ...")
-			if _, err := client.Run("sudo snap refresh microk8s"); err != nil {
+			if _, err := client.RunSudo(remote.Mutating(ctx, "Refresh microk8s"), "snap refresh microk8s"); err != nil {
 				fmt.Fprintf(out, "microk8s refresh failed: %v\n", err)
 			} else {
-				fmt.Fprintln(out, "microk8s refreshed.")
+				fmt.Fprintln(out, outcome("microk8s refreshed.", "microk8s would be refreshed."))
 			}
 		}
 
@@ -204,29 +302,40 @@ This command assumes you have a working SSH session via 'labman login'.`,
 		} else {
 			fmt.Fprintln(out, "→ Rebooting node ...")
 			// fire-and-forget reboot; SSH will drop
-			_, _ = client.Run("sudo reboot now || sudo shutdown -r now || true")
+			_, _ = client.RunSudo(remote.Mutating(ctx, "Reboot"), "reboot now || shutdown -r now || true")
 		}
 
-		if !skipReboot {
+		if !skipReboot && dryRun {
+			fmt.Fprintf(out, "→ Would wait for the node and %s to come back.\n", kube.Name)
+		} else if !skipReboot {
 			fmt.Fprintln(out, "→ Waiting for node to return (this may take a few minutes)...")
 
 			var ready bool
 			for i := 0; i < 30; i++ {
-				time.Sleep(20 * time.Second)
+				select {
+				case <-ctx.Done():
+					return fmt.Errorf("waiting for node %s: %w (run: %s uncordon %s)", nodeName, context.Cause(ctx), kube.Kubectl, nodeName)
+				case <-time.After(20 * time.Second):
+				}
 
-				newClient, err := remote.LoadSession()
+				newClient, err := remote.LoadSession(session.Name)
 				if err != nil || newClient == nil {
 					fmt.Fprintln(out, "... node not up yet (SSH not ready)")
 					continue
 				}
 
-				status, err := newClient.Run("microk8s status --wait-ready")
+				check := newClient.RunContext
+				if kube.ReadySudo {
+					check = newClient.RunSudo
+				}
+				status, err := check(ctx, kube.Ready)
 				if err != nil {
-					fmt.Fprintln(out, "... microk8s not ready yet")
+					fmt.Fprintf(out, "... %s not ready yet\n", kube.Name)
 					continue
 				}
-				if strings.Contains(status, "microk8s is running") {
-					fmt.Fprintln(out, "Node and microk8s are back.")
+				if strings.Contains(status, kube.ReadyOutput) {
+					fmt.Fprintf(out, "Node and %s are back.\n", kube.Name)
+					configureSession(cmd, newClient)
 					remote.SetCurrent(newClient)
 					ready = true
 					break
@@ -235,28 +344,30 @@ This command assumes you have a working SSH session via 'labman login'.`,
 
 			if !ready {
 				fmt.Fprintln(out, "Node did not come back in time. Please check manually.")
-				fmt.Fprintf(out, "You may need to run: microk8s kubectl uncordon %s\n", nodeName)
+				fmt.Fprintf(out, "You may need to run: %s uncordon %s\n", kube.Kubectl, nodeName)
 				return nil
 			}
 		}
 
 		fmt.Fprintf(out, "→ Uncordoning node %s ...\n", nodeName)
-		newClient := remote.Current()
-		if newClient == nil {
-			newClient, _ = remote.LoadSession()
+		newClient := currentExecutor()
+		if newClient == nil && overSSH {
+			if reloaded, err := remote.LoadSession(session.Name); err == nil {
+				newClient = reloaded
+			}
 		}
 		if newClient != nil {
-			if _, err := newClient.Run("sudo microk8s kubectl uncordon " + nodeName); err != nil {
+			if _, err := newClient.RunSudo(remote.Mutating(ctx, "Uncordon node"), kube.Kubectl+" uncordon "+nodeName); err != nil {
 				fmt.Fprintf(out, "failed to uncordon node: %v\n", err)
 			} else {
-				fmt.Fprintln(out, "Node uncordoned.")
+				fmt.Fprintln(out, outcome("Node uncordoned.", "Node would be uncordoned."))
 			}
 		} else {
 			fmt.Fprintln(out, "could not restore SSH session to uncordon; please uncordon manually.")
 		}
 
 		fmt.Fprintln(out, "--------------------------------------------------")
-		fmt.Fprintln(out, "OS upgrade flow completed.")
+		fmt.Fprintln(out, outcome("OS upgrade flow completed.", "OS upgrade dry run completed; nothing was changed."))
 		fmt.Fprintf(out, "Node: %s\n", nodeName)
 		if skipReboot {
 			fmt.Fprintln(out, "Note: reboot was skipped, you should reboot this node to finish the upgrade.")
@@ -271,23 +382,30 @@ var selfDisksCmd = &cobra.Command{
 	Use:   "disks",
 	Short: "Inspect filesystem usage and surface heavy directories",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
+		ctx := commandContext(cmd)
+
 		sections := []struct {
 			Title   string
 			Command string
+			Sudo    bool
 		}{
-			{"FILESYSTEM USAGE", "df -h"},
-			{"BLOCK DEVICES", "lsblk -o NAME,SIZE,FSTYPE,TYPE,MOUNTPOINT"},
-			{"TOP /var/lib DIRECTORIES", "sudo du -xh --max-depth=1 /var/lib 2>/dev/null | sort -hr | head -n 10"},
-			{"TOP /var/log DIRECTORIES", "sudo du -xh --max-depth=1 /var/log 2>/dev/null | sort -hr | head -n 10"},
+			{"FILESYSTEM USAGE", "df -h", false},
+			{"BLOCK DEVICES", "lsblk -o NAME,SIZE,FSTYPE,TYPE,MOUNTPOINT", false},
+			{"TOP /var/lib DIRECTORIES", "du -xh --max-depth=1 /var/lib 2>/dev/null | sort -hr | head -n 10", true},
+			{"TOP /var/log DIRECTORIES", "du -xh --max-depth=1 /var/log 2>/dev/null | sort -hr | head -n 10", true},
 		}
 
 		for _, section := range sections {
-			output, err := client.Run(section.Command)
+			run := client.RunIdempotent
+			if section.Sudo {
+				run = client.RunSudo
+			}
+			output, err := run(ctx, section.Command)
 			if err != nil {
 				output = fmt.Sprintf("%s failed: %v", section.Title, err)
 			}
@@ -302,29 +420,31 @@ var selfServicesCmd = &cobra.Command{
 	Use:   "services",
 	Short: "Check core services (Pi-hole, MicroK8s, VPN) and optionally restart them",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
+		ctx := commandContext(cmd)
+
 		restartTarget, _ := cmd.Flags().GetString("restart")
 		if restartTarget != "" {
 			restartCmd, ok := serviceRestartCommands[restartTarget]
 			if !ok {
 				return fmt.Errorf("unknown service %q (choose from microk8s, pihole, tailscale, wireguard)", restartTarget)
 			}
-			if _, err := client.Run(restartCmd); err != nil {
+			if _, err := client.RunSudo(remote.Mutating(ctx, "Restart service"), restartCmd); err != nil {
 				return fmt.Errorf("restart %s: %w", restartTarget, err)
 			}
 		}
 
-		statusOutput, err := client.Run(serviceStatusScript)
+		statusOutput, err := client.RunContext(ctx, serviceStatusScript)
 		if err != nil {
 			return fmt.Errorf("service status check failed: %w", err)
 		}
 		printSection(cmd, "SERVICE STATUS", statusOutput)
 
-		microk8sStatus, err := client.Run("microk8s status --wait-ready")
+		microk8sStatus, err := client.RunContext(ctx, "microk8s status --wait-ready")
 		if err != nil {
 			microk8sStatus = fmt.Sprintf("microk8s status failed: %v", err)
 		}
@@ -337,12 +457,14 @@ var selfNetCheckCmd = &cobra.Command{
 	Use:   "netcheck",
 	Short: "Run ping, traceroute, and speed tests from the node",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := remote.Current()
+		client := currentExecutor()
 		if client == nil {
 			return fmt.Errorf("not connected to any server. Run 'labman login' first")
 		}
 
-		gatewayRaw, err := client.Run(`ip route | awk '/default/ {print $3; exit}'`)
+		ctx := commandContext(cmd)
+
+		gatewayRaw, err := client.RunContext(ctx, `ip route | awk '/default/ {print $3; exit}'`)
 		if err != nil {
 			return fmt.Errorf("detect default gateway: %w", err)
 		}
@@ -355,8 +477,8 @@ var selfNetCheckCmd = &cobra.Command{
 			gatewayTitle += fmt.Sprintf(" (%s)", gateway)
 		}
 
-		lanCmd := fmt.Sprintf("ping -c 4 %s", shellQuote(gateway))
-		lanOutput, err := client.Run(lanCmd)
+		lanCmd := fmt.Sprintf("ping -c 4 %s", remote.ShellQuote(gateway))
+		lanOutput, err := client.RunContext(ctx, lanCmd)
 		if err != nil {
 			lanOutput = fmt.Sprintf("ping failed: %v", err)
 		}
@@ -364,7 +486,7 @@ var selfNetCheckCmd = &cobra.Command{
 
 		for _, target := range []string{"1.1.1.1", "8.8.8.8"} {
 			pingCmd := fmt.Sprintf("ping -c 4 %s", target)
-			output, err := client.Run(pingCmd)
+			output, err := client.RunContext(ctx, pingCmd)
 			if err != nil {
 				output = fmt.Sprintf("ping failed: %v", err)
 			}
@@ -372,14 +494,14 @@ var selfNetCheckCmd = &cobra.Command{
 		}
 
 		traceCmd := `if command -v mtr >/dev/null 2>&1; then mtr -r -c 10 1.1.1.1; elif command -v traceroute >/dev/null 2>&1; then traceroute 1.1.1.1; else echo "Install mtr or traceroute for hop diagnostics."; fi`
-		traceOutput, err := client.Run(traceCmd)
+		traceOutput, err := client.RunContext(ctx, traceCmd)
 		if err != nil {
 			traceOutput = fmt.Sprintf("trace failed: %v", err)
 		}
 		printSection(cmd, "ROUTE TO 1.1.1.1", traceOutput)
 
 		speedCmd := `if command -v speedtest-cli >/dev/null 2>&1; then speedtest-cli --simple; else echo "speedtest-cli not installed (sudo snap install speedtest-cli)"; fi`
-		speedOutput, err := client.Run(speedCmd)
+		speedOutput, err := client.RunContext(ctx, speedCmd)
 		if err != nil {
 			speedOutput = fmt.Sprintf("speedtest failed: %v", err)
 		}
@@ -410,10 +532,10 @@ mount | grep -E '/mnt/(nas|media|storage)' || echo "  (no NAS mounts detected)"
 `
 
 var serviceRestartCommands = map[string]string{
-	"microk8s":  "sudo snap restart microk8s",
-	"pihole":    "sudo systemctl restart pihole-FTL",
-	"tailscale": "sudo systemctl restart tailscaled",
-	"wireguard": "sudo systemctl restart wg-quick@wg0",
+	"microk8s":  "snap restart microk8s",
+	"pihole":    "systemctl restart pihole-FTL",
+	"tailscale": "systemctl restart tailscaled",
+	"wireguard": "systemctl restart wg-quick@wg0",
 }
 
 func init() {
@@ -427,4 +549,20 @@ func init() {
 	selfUpgradeOSCmd.Flags().Bool("refresh-microk8s", false, "refresh the microk8s snap after OS upgrade")
 	selfUpgradeOSCmd.Flags().Bool("no-reboot", false, "perform the upgrade but do not reboot (for testing)")
 	selfServicesCmd.Flags().String("restart", "", "Restart one service (microk8s, pihole, tailscale, wireguard) before checking status")
+
+	declareSteps(selfCmd)
+	declareSteps(selfInfoCmd)
+	declareSteps(selfCleanCmd, selfCleanStepNames()...)
+	declareSteps(selfUpgradeOSCmd, "Create Velero backup", "Cordon node", "Drain node", "Upgrade OS packages", "Refresh microk8s", "Reboot", "Uncordon node")
+	declareSteps(selfDisksCmd)
+	declareSteps(selfServicesCmd, "Restart service")
+	declareSteps(selfNetCheckCmd)
+}
+
+func selfCleanStepNames() []string {
+	names := make([]string, 0, len(selfCleanSteps))
+	for _, step := range selfCleanSteps {
+		names = append(names, step.Name)
+	}
+	return names
 }
@@ -6,15 +6,18 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/tinotenda-alfaneti/labman/internal/remote"
 )
 
 var sessionCmd = &cobra.Command{
 	Use:   "session",
-	Short: "Inspect or remove the cached SSH session",
-	Long: `Shows details about the cached SSH session stored under ~/.labman/sessions
-and provides helpers to discard the credentials when you want to rotate secrets.`,
+	Short: "Inspect or remove cached SSH sessions",
+	Long: `Shows details about the SSH sessions cached under ~/.labman/sessions, one per
+host alias, and provides helpers to discard the credentials when you want to
+rotate secrets. Commands use the active session (see 'labman use') unless
+--host names another.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return sessionStatusCmd.RunE(cmd, args)
 	},
@@ -26,7 +29,7 @@ var sessionStatusCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		printBanner(cmd)
 
-		meta, err := remote.SessionMetadata()
+		meta, err := remote.SessionMetadata(selectedSession())
 		if err != nil {
 			return fmt.Errorf("unable to read cached session: %w", err)
 		}
@@ -36,18 +39,27 @@ var sessionStatusCmd = &cobra.Command{
 			ttl = 0
 		}
 
-		connectivity := diagnoseConnectivity()
+		connectivity := diagnoseConnectivity(meta.Name)
 		body := &strings.Builder{}
-		fmt.Fprintf(body, "Host          : %s\n", meta.Host)
+		fmt.Fprintf(body, "Session       : %s\n", meta.Name)
+		fmt.Fprintf(body, "Host          : %s\n", describeEndpoint(meta))
 		fmt.Fprintf(body, "User          : %s\n", meta.User)
+		if len(meta.Jumps) > 0 {
+			fmt.Fprintf(body, "Via           : %s\n", describeJumpChain(meta.Jumps))
+		}
+		fmt.Fprintf(body, "Auth          : %s\n", describeAuth(meta))
+		if meta.CertFile != "" {
+			fmt.Fprintf(body, "Certificate   : %s\n", describeCertificateFile(meta.CertFile, time.Now()))
+		}
 		fmt.Fprintf(body, "Expires At    : %s\n", meta.Timeout.Format(time.RFC1123))
 		fmt.Fprintf(body, "TTL Remaining : %s\n", formatTTL(ttl))
+		fmt.Fprintf(body, "Renewal       : %s\n", describeExpiry(meta))
 		fmt.Fprintf(body, "Connectivity  : %s\n", connectivity)
 		printSection(cmd, "SESSION STATUS", body.String())
 
 		shouldDrop, _ := cmd.Flags().GetBool("drop")
 		if shouldDrop {
-			if err := dropSession(); err != nil {
+			if err := dropSession(meta.Name); err != nil {
 				return err
 			}
 			printSection(cmd, "SESSION DROP", "Removed cached credentials and session file.")
@@ -57,11 +69,18 @@ var sessionStatusCmd = &cobra.Command{
 }
 
 var sessionDropCmd = &cobra.Command{
-	Use:   "drop",
-	Short: "Delete the cached SSH session and keyring secrets",
+	Use:   "drop [alias]",
+	Short: "Delete a cached SSH session and its keyring secrets",
+	Long: `Deletes the session cached for alias, or the active session (or the one
+named by --host) when no alias is given.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		printBanner(cmd)
-		if err := dropSession(); err != nil {
+		name := selectedSession()
+		if len(args) == 1 {
+			name = remote.SessionName(args[0])
+		}
+		if err := dropSession(name); err != nil {
 			return err
 		}
 
@@ -70,8 +89,93 @@ var sessionDropCmd = &cobra.Command{
 	},
 }
 
-func diagnoseConnectivity() string {
-	session, err := remote.LoadSession()
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached sessions and show which one is active",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		sessions, err := remote.ListSessions()
+		if err != nil {
+			return fmt.Errorf("unable to read cached sessions: %w", err)
+		}
+		if len(sessions) == 0 {
+			printSection(cmd, "SESSIONS", "No cached sessions. Run 'labman login <host>' to create one.")
+			return nil
+		}
+
+		active, _ := remote.ActiveSession()
+		printSection(cmd, "SESSIONS", formatSessionList(sessions, active, time.Now()))
+		return nil
+	},
+}
+
+// formatSessionList renders one line per session, marking the active one
+// with an asterisk.
+func formatSessionList(sessions []remote.SSHSessionConfig, active string, now time.Time) string {
+	nameWidth, endpointWidth := len("NAME"), len("ENDPOINT")
+	for _, meta := range sessions {
+		nameWidth = max(nameWidth, len(meta.Name))
+		endpointWidth = max(endpointWidth, len(meta.User)+1+len(describeEndpoint(meta)))
+	}
+
+	lines := []string{fmt.Sprintf("  %-*s  %-*s  %s", nameWidth, "NAME", endpointWidth, "ENDPOINT", "TTL")}
+	for _, meta := range sessions {
+		marker := " "
+		if meta.Name == active {
+			marker = "*"
+		}
+		endpoint := meta.User + "@" + describeEndpoint(meta)
+		lines = append(lines, fmt.Sprintf("%s %-*s  %-*s  %s", marker, nameWidth, meta.Name, endpointWidth, endpoint, formatTTL(meta.Timeout.Sub(now))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var sessionExtendCmd = &cobra.Command{
+	Use:   "extend",
+	Short: "Push back the cached session's expiry without logging in again",
+	Long: `Re-dials the server with the credentials cached in the keyring and, once
+they are accepted, extends the session (by its TTL unless --by is given). An
+expired session can be extended too, but never past its session_max_ttl
+counted from login.
+
+Examples:
+  labman session extend
+  labman session extend --by 2h --host k8s-master`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		by, _ := cmd.Flags().GetDuration("by")
+		if by < 0 {
+			return fmt.Errorf("--by must be positive, got %s", by)
+		}
+
+		meta, err := remote.ExtendSession(selectedSession(), by)
+		if err != nil {
+			return fmt.Errorf("extend session: %w", err)
+		}
+
+		body := fmt.Sprintf("Session %s now expires at %s (%s remaining).", meta.Name, meta.Timeout.Format(time.RFC1123), formatTTL(time.Until(meta.Timeout)))
+		if meta.Timeout.Equal(meta.Deadline()) {
+			body += "\nThis is its maximum lifetime; log in again to go further."
+		}
+		printSection(cmd, "SESSION EXTEND", body)
+		return nil
+	},
+}
+
+// describeExpiry explains how the session's timeout moves.
+func describeExpiry(meta remote.SSHSessionConfig) string {
+	deadline := meta.Deadline().Format(time.RFC1123)
+	if meta.Sliding {
+		return fmt.Sprintf("sliding, %s after each command until %s", formatTTL(meta.Expiry().EffectiveTTL()), deadline)
+	}
+	return fmt.Sprintf("fixed, extendable until %s", deadline)
+}
+
+func diagnoseConnectivity(name string) string {
+	session, err := remote.LoadSession(name)
 	if err != nil {
 		return fmt.Sprintf("unavailable (%v)", err)
 	}
@@ -84,6 +188,64 @@ func diagnoseConnectivity() string {
 	return "disconnected"
 }
 
+func describeEndpoint(meta remote.SSHSessionConfig) string {
+	if meta.Port == 0 || meta.Port == 22 {
+		return meta.Host
+	}
+	return fmt.Sprintf("%s:%d", meta.Host, meta.Port)
+}
+
+func describeJumpChain(jumps []remote.SSHSessionConfig) string {
+	hops := make([]string, 0, len(jumps))
+	for _, jump := range jumps {
+		hops = append(hops, fmt.Sprintf("%s@%s", jump.User, describeEndpoint(jump)))
+	}
+	return strings.Join(hops, " -> ")
+}
+
+func describeAuth(meta remote.SSHSessionConfig) string {
+	switch meta.AuthMethod {
+	case remote.AuthPublicKey:
+		return fmt.Sprintf("%s (%s)", meta.AuthMethod, meta.KeyFile)
+	case "":
+		return remote.AuthPassword
+	default:
+		return meta.AuthMethod
+	}
+}
+
+// describeCertificateFile summarises the user certificate the session
+// authenticated with, as it reads on disk now.
+func describeCertificateFile(path string, now time.Time) string {
+	cert, err := remote.ReadCertificate(path)
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	return fmt.Sprintf("%s (%s)", path, describeCertificate(cert, now))
+}
+
+func describeCertificate(cert *ssh.Certificate, now time.Time) string {
+	principals := "any principal"
+	if len(cert.ValidPrincipals) > 0 {
+		principals = "principals " + strings.Join(cert.ValidPrincipals, ", ")
+	}
+
+	expiry := "never expires"
+	if validBefore := remote.CertValidBefore(cert); !validBefore.IsZero() {
+		if validBefore.After(now) {
+			expiry = fmt.Sprintf("expires %s, in %s", validBefore.Format(time.RFC1123), formatTTL(validBefore.Sub(now)))
+		} else {
+			expiry = fmt.Sprintf("expired %s", validBefore.Format(time.RFC1123))
+		}
+	}
+
+	parts := []string{principals, expiry}
+	if cert.KeyId != "" {
+		parts = append(parts, fmt.Sprintf("key ID %q", cert.KeyId))
+	}
+	return strings.Join(parts, "; ")
+}
+
 func formatTTL(ttl time.Duration) string {
 	if ttl <= 0 {
 		return "expired"
@@ -106,8 +268,8 @@ func formatTTL(ttl time.Duration) string {
 	return strings.Join(parts, " ")
 }
 
-func dropSession() error {
-	if err := remote.DeleteSession(); err != nil {
+func dropSession(name string) error {
+	if err := remote.DeleteSession(name); err != nil {
 		return fmt.Errorf("delete cached session: %w", err)
 	}
 	return nil
@@ -117,6 +279,9 @@ func init() {
 	rootCmd.AddCommand(sessionCmd)
 	sessionCmd.AddCommand(sessionStatusCmd)
 	sessionCmd.AddCommand(sessionDropCmd)
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionExtendCmd)
 
 	sessionStatusCmd.Flags().Bool("drop", false, "drop the cached session after showing its details")
+	sessionExtendCmd.Flags().Duration("by", 0, "how much longer to keep the session (default: its TTL)")
 }
@@ -1,26 +1,37 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/tinotenda-alfaneti/labman/internal/config"
 	"github.com/tinotenda-alfaneti/labman/internal/remote"
 	"github.com/spf13/cobra"
 )
 
 // requireSession ensures remote.Current() holds a live SSH session before commands run.
 func requireSession(cmd *cobra.Command, args []string) error {
+	remote.SetAuditCommand(cmd.CommandPath())
+	if err := checkDryRun(cmd); err != nil {
+		return err
+	}
 	if shouldSkipSession(cmd) {
 		return nil
 	}
 
+	name := selectedSession()
 	current := remote.Current()
-	if current != nil && current.IsConnected() {
+	if current != nil && (name == "" || current.Name == name) && current.IsConnected() {
+		current.CommandTimeout = commandTimeout
 		return nil
 	}
 
-	client, err := remote.LoadSession()
+	client, err := remote.LoadSession(name)
 	if err != nil {
+		if errors.Is(err, remote.ErrNoActiveSession) {
+			return fmt.Errorf("failed to load session: %w; run 'labman login <host>' or 'labman use <alias>' first", err)
+		}
 		return fmt.Errorf("failed to load session: %w", err)
 	}
 
@@ -30,10 +41,90 @@ func requireSession(cmd *cobra.Command, args []string) error {
 		return errors.New("not connected to any server; run 'labman login' first")
 	}
 
+	configureSession(cmd, client)
 	remote.SetCurrent(client)
 	return nil
 }
 
+// selectedSession is the session named by --host, or "" for the active one.
+func selectedSession() string {
+	if sessionHost == "" {
+		return ""
+	}
+	return remote.SessionName(sessionHost)
+}
+
+// selectSessionFor makes a host named on the command line pick its own cached
+// session, as if it had been passed with --host. Without --host and without a
+// session cached under that name the active session is used as before.
+func selectSessionFor(cmd *cobra.Command, identifier string) error {
+	if sessionHost != "" || identifier == "" {
+		return nil
+	}
+	if _, err := remote.SessionMetadata(remote.SessionName(identifier)); err != nil {
+		return nil
+	}
+	return cmd.Flags().Set("host", identifier)
+}
+
+// configureSession applies --timeout and, when reconnect_attempts is set,
+// enables reconnects that are reported on stderr.
+func configureSession(cmd *cobra.Command, client *remote.SSHSession) {
+	client.CommandTimeout = commandTimeout
+
+	cfg, err := config.Load()
+	if err != nil || cfg.Defaults.ReconnectAttempts <= 0 {
+		return
+	}
+
+	client.Reconnect = &remote.ReconnectPolicy{
+		MaxAttempts:    cfg.Defaults.ReconnectAttempts,
+		InitialBackoff: cfg.Defaults.ReconnectBackoff,
+	}
+	client.OnReconnect = func(event remote.ReconnectEvent) {
+		fmt.Fprintln(cmd.ErrOrStderr(), describeReconnect(event))
+	}
+}
+
+// commandContext returns the context the root command cancels on Ctrl-C.
+// Commands invoked from the interactive shell may not have one.
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+func describeReconnect(event remote.ReconnectEvent) string {
+	if event.Reconnected {
+		return fmt.Sprintf("Reconnected after %d attempt(s).", event.Attempt)
+	}
+	return fmt.Sprintf("Connection lost (%v); reconnecting in %s (attempt %d/%d)...",
+		event.Err, event.Delay, event.Attempt, event.MaxAttempts)
+}
+
+// checkSessionHost makes sure a host named on the command line (an alias or
+// address, optionally with a user) is the server the session is logged in to.
+func checkSessionHost(client *remote.SSHSession, identifier, user string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	host, _, port, _, err := cfg.ResolveHost(identifier)
+	if err != nil {
+		return fmt.Errorf("resolve host: %w", err)
+	}
+
+	sameHost := host == client.Host && (client.Port == 0 || port == client.Port)
+	sameUser := user == "" || user == client.User
+	if !sameHost || !sameUser {
+		return fmt.Errorf("%s is not the server of session %s (%s@%s); pass --host %s or run 'labman login %s' first",
+			identifier, client.Name, client.User, client.Host, identifier, identifier)
+	}
+	return nil
+}
+
 // cleanupSession closes any shared session after the command finishes.
 func cleanupSession(cmd *cobra.Command, args []string) {
 	if shouldSkipSession(cmd) {
@@ -45,10 +136,20 @@ func cleanupSession(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	touchSession(current)
 	_ = current.Close()
 	remote.SetCurrent(nil)
 }
 
+// touchSession renews a sliding session after a successful command. It is
+// best effort: a session that cannot be renewed simply expires on time.
+func touchSession(session *remote.SSHSession) {
+	if session.Name == "" || !session.Expiry.Sliding {
+		return
+	}
+	_ = remote.TouchSession(session.Name)
+}
+
 func shouldSkipSession(cmd *cobra.Command) bool {
 	if cmd == nil {
 		return false
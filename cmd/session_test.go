@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tinotenda-alfaneti/labman/internal/config"
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestFormatTTL(t *testing.T) {
@@ -257,3 +263,206 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDescribeAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		meta remote.SSHSessionConfig
+		want string
+	}{
+		{
+			name: "legacy session without method",
+			meta: remote.SSHSessionConfig{},
+			want: "password",
+		},
+		{
+			name: "password",
+			meta: remote.SSHSessionConfig{AuthMethod: remote.AuthPassword},
+			want: "password",
+		},
+		{
+			name: "public key shows key file",
+			meta: remote.SSHSessionConfig{AuthMethod: remote.AuthPublicKey, KeyFile: "/home/me/.ssh/id_ed25519"},
+			want: "publickey (/home/me/.ssh/id_ed25519)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeAuth(tt.meta); got != tt.want {
+				t.Errorf("describeAuth() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeCertificate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(90 * time.Minute)
+
+	tests := []struct {
+		name string
+		cert *ssh.Certificate
+		want string
+	}{
+		{
+			name: "principals and expiry",
+			cert: &ssh.Certificate{ValidPrincipals: []string{"admin", "ops"}, ValidBefore: uint64(expires.Unix()), KeyId: "admin@laptop"},
+			want: `principals admin, ops; expires ` + expires.Local().Format(time.RFC1123) + `, in 1h 30m; key ID "admin@laptop"`,
+		},
+		{
+			name: "expired",
+			cert: &ssh.Certificate{ValidPrincipals: []string{"admin"}, ValidBefore: uint64(now.Add(-time.Hour).Unix())},
+			want: "principals admin; expired " + now.Add(-time.Hour).Local().Format(time.RFC1123),
+		},
+		{
+			name: "no principals and no expiry",
+			cert: &ssh.Certificate{ValidBefore: ssh.CertTimeInfinity},
+			want: "any principal; never expires",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeCertificate(tt.cert, now); got != tt.want {
+				t.Errorf("describeCertificate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		meta remote.SSHSessionConfig
+		want string
+	}{
+		{name: "legacy session without port", meta: remote.SSHSessionConfig{Host: "lab"}, want: "lab"},
+		{name: "default port", meta: remote.SSHSessionConfig{Host: "lab", Port: 22}, want: "lab"},
+		{name: "custom port", meta: remote.SSHSessionConfig{Host: "lab", Port: 2222}, want: "lab:2222"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeEndpoint(tt.meta); got != tt.want {
+				t.Errorf("describeEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSessionList(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []remote.SSHSessionConfig{
+		{Name: "homelab-prod", Host: "192.168.1.10", User: "admin", Timeout: now.Add(45 * time.Minute)},
+		{Name: "nas", Host: "10.0.0.9", Port: 2222, User: "root", Timeout: now.Add(-time.Minute)},
+	}
+
+	got := formatSessionList(sessions, "nas", now)
+	want := "" +
+		"  NAME          ENDPOINT            TTL\n" +
+		"  homelab-prod  admin@192.168.1.10  45m\n" +
+		"* nas           root@10.0.0.9:2222  expired"
+	if got != want {
+		t.Errorf("formatSessionList() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDescribeExpiry(t *testing.T) {
+	login := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		meta remote.SSHSessionConfig
+		want string
+	}{
+		{
+			name: "fixed with defaults",
+			meta: remote.SSHSessionConfig{LoginAt: login, Timeout: login.Add(time.Hour)},
+			want: "fixed, extendable until Mon, 02 Jun 2025 08:00:00 UTC",
+		},
+		{
+			name: "sliding",
+			meta: remote.SSHSessionConfig{LoginAt: login, TTL: 2 * time.Hour, Sliding: true, MaxTTL: 10 * time.Hour},
+			want: "sliding, 2h after each command until Sun, 01 Jun 2025 18:00:00 UTC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeExpiry(tt.meta); got != tt.want {
+				t.Errorf("describeExpiry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	host := config.Host{SessionTTL: 8 * time.Hour, SessionExpiry: "sliding", SessionMaxTTL: 24 * time.Hour}
+	want := remote.SessionExpiry{TTL: 8 * time.Hour, Sliding: true, MaxTTL: 24 * time.Hour}
+	if got := sessionExpiry(host); got != want {
+		t.Errorf("sessionExpiry() = %+v, want %+v", got, want)
+	}
+	if got := sessionExpiry(config.Host{SessionExpiry: "fixed"}); got.Sliding {
+		t.Errorf("sessionExpiry() with fixed expiry should not slide")
+	}
+}
+
+func TestSelectedSession(t *testing.T) {
+	original := sessionHost
+	t.Cleanup(func() { sessionHost = original })
+
+	sessionHost = ""
+	if got := selectedSession(); got != "" {
+		t.Errorf("selectedSession() without --host = %q, want the active session", got)
+	}
+	sessionHost = "fe80::1"
+	if got := selectedSession(); got != "fe80__1" {
+		t.Errorf("selectedSession() = %q, want %q", got, "fe80__1")
+	}
+}
+
+func TestDescribeReconnect(t *testing.T) {
+	tests := []struct {
+		name  string
+		event remote.ReconnectEvent
+		want  string
+	}{
+		{
+			name:  "attempt",
+			event: remote.ReconnectEvent{Attempt: 2, MaxAttempts: 5, Delay: 2 * time.Second, Err: remote.ErrConnectionLost},
+			want:  "Connection lost (ssh connection lost); reconnecting in 2s (attempt 2/5)...",
+		},
+		{
+			name:  "reconnected",
+			event: remote.ReconnectEvent{Attempt: 2, Reconnected: true},
+			want:  "Reconnected after 2 attempt(s).",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeReconnect(tt.event); got != tt.want {
+				t.Errorf("describeReconnect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	t.Run("falls back to background without a context", func(t *testing.T) {
+		if ctx := commandContext(&cobra.Command{}); ctx == nil || ctx.Err() != nil {
+			t.Fatalf("expected usable background context, got %v", ctx)
+		}
+	})
+
+	t.Run("uses the command context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		cmd := &cobra.Command{}
+		cmd.SetContext(ctx)
+		if got := commandContext(cmd); got.Err() == nil {
+			t.Fatalf("expected the cancelled command context")
+		}
+	})
+}
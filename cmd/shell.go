@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -48,7 +50,11 @@ Examples:
 }
 
 func ensureSession(cmd *cobra.Command, args []string) (*remote.SSHSession, error) {
-	session, err := remote.LoadSession()
+	name := selectedSession()
+	if len(args) > 0 {
+		name = remote.SessionName(args[0])
+	}
+	session, err := remote.LoadSession(name)
 	if err == nil {
 		return session, nil
 	}
@@ -72,10 +78,8 @@ func ensureSession(cmd *cobra.Command, args []string) (*remote.SSHSession, error
 		fmt.Printf("No active session. Using configured host: %s\n", hostIdentifier)
 	}
 
-	serverIP, defaultUsername, port, keyFile, resolveErr := cfg.ResolveHost(hostIdentifier)
-	if resolveErr != nil {
-		return nil, fmt.Errorf("resolve host: %w", resolveErr)
-	}
+	hostConfig := cfg.Lookup(hostIdentifier)
+	serverIP, defaultUsername, port, keyFile := hostConfig.Host, hostConfig.Username, hostConfig.Port, hostConfig.KeyFile
 
 	user, _ := cmd.Flags().GetString("username")
 	if user == "" {
@@ -85,12 +89,14 @@ func ensureSession(cmd *cobra.Command, args []string) (*remote.SSHSession, error
 		return nil, fmt.Errorf("username is required (specify with -u or set in config)")
 	}
 
-	password, passErr := getShellPassword(cmd)
-	if passErr != nil {
-		return nil, fmt.Errorf("read password: %w", passErr)
+	auth, authErr := authOptions(cmd, hostConfig, getShellPassword)
+	if authErr != nil {
+		return nil, authErr
 	}
-	if password == "" {
-		return nil, fmt.Errorf("password is required")
+
+	opts, err := sessionOptions(cfg, hostConfig, user, auth)
+	if err != nil {
+		return nil, err
 	}
 
 	connectionInfo := fmt.Sprintf("Connecting to %s as %s", serverIP, user)
@@ -100,12 +106,22 @@ func ensureSession(cmd *cobra.Command, args []string) (*remote.SSHSession, error
 	if keyFile != "" {
 		connectionInfo += fmt.Sprintf(" (with key: %s)", keyFile)
 	}
+	if via := describeJumps(opts); via != "" {
+		connectionInfo += " " + via
+	}
 	fmt.Println(connectionInfo)
 
-	session, err = remote.NewSSHSession(serverIP, user, password)
+	session, err = remote.NewSSHSession(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
+	session.Name = remote.SessionName(hostIdentifier)
+	session.Expiry = sessionExpiry(hostConfig)
+
+	if err := ensureSudoPassword(session); err != nil {
+		session.Close()
+		return nil, err
+	}
 
 	if saveErr := remote.SaveSession(session); saveErr != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", saveErr)
@@ -164,6 +180,8 @@ func runInteractiveShell(session *remote.SSHSession) error {
 		// Execute the command
 		if err := executeShellCommand(parts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		} else {
+			touchSession(session)
 		}
 	}
 
@@ -176,6 +194,7 @@ func printShellHelp() {
 	fmt.Println("  diag <subcommand>     - Diagnostics (bundle, connectivity, dns)")
 	fmt.Println("  self <subcommand>     - Server maintenance (update, reboot)")
 	fmt.Println("  session status        - Show session information")
+	fmt.Println("  cp <src> <dst>        - Copy files over SFTP (host:path for remote)")
 	fmt.Println("  help                  - Show this help")
 	fmt.Println("  exit                  - Exit the shell")
 }
@@ -195,10 +214,20 @@ func executeShellCommand(parts []string) error {
 		targetCmd = selfCmd
 	case "session":
 		targetCmd = sessionCmd
+	case "cp":
+		targetCmd = cpCmd
 	default:
 		return fmt.Errorf("unknown command: %s (type 'help' for available commands)", cmdName)
 	}
 
+	// Ctrl-C interrupts the running command, not the shell
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	targetCmd.SetContext(ctx)
+	if current := remote.Current(); current != nil {
+		current.CommandTimeout = commandTimeout
+	}
+
 	// Set args and execute directly without going through root
 	targetCmd.SetArgs(cmdArgs)
 	targetCmd.SetOut(os.Stdout)
@@ -222,6 +251,7 @@ func executeShellCommand(parts []string) error {
 		}
 
 		// Set remaining args for subcommand
+		subCmd.SetContext(ctx)
 		subCmd.SetArgs(actualArgs[1:])
 		subCmd.SetOut(os.Stdout)
 		subCmd.SetErr(os.Stderr)
@@ -231,6 +261,7 @@ func executeShellCommand(parts []string) error {
 			subCmd.SetArgs(nil)
 			return err
 		}
+		remote.SetAuditCommand(subCmd.CommandPath())
 
 		if subCmd.RunE != nil {
 			err = subCmd.RunE(subCmd, subCmd.Flags().Args())
@@ -246,6 +277,11 @@ func executeShellCommand(parts []string) error {
 	}
 
 	// Execute the command directly
+	if err := targetCmd.ValidateArgs(actualArgs); err != nil {
+		targetCmd.SetArgs(nil)
+		return err
+	}
+	remote.SetAuditCommand(targetCmd.CommandPath())
 	var err error
 	if targetCmd.RunE != nil {
 		err = targetCmd.RunE(targetCmd, actualArgs)
@@ -2,79 +2,6 @@ package cmd
 
 import "testing"
 
-func TestShellQuote(t *testing.T) {
-	tests := []struct {
-		name  string
-		input string
-		want  string
-	}{
-		{
-			name:  "empty string",
-			input: "",
-			want:  "''",
-		},
-		{
-			name:  "simple string",
-			input: "hello",
-			want:  "'hello'",
-		},
-		{
-			name:  "string with spaces",
-			input: "hello world",
-			want:  "'hello world'",
-		},
-		{
-			name:  "string with single quote",
-			input: "it's",
-			want:  "'it'\\''s'",
-		},
-		{
-			name:  "string with multiple single quotes",
-			input: "can't won't don't",
-			want:  "'can'\\''t won'\\''t don'\\''t'",
-		},
-		{
-			name:  "string with special characters",
-			input: "hello$world",
-			want:  "'hello$world'",
-		},
-		{
-			name:  "string with backticks",
-			input: "hello`world`",
-			want:  "'hello`world`'",
-		},
-		{
-			name:  "string with semicolons",
-			input: "hello; rm -rf /",
-			want:  "'hello; rm -rf /'",
-		},
-		{
-			name:  "string with pipes",
-			input: "hello | cat",
-			want:  "'hello | cat'",
-		},
-		{
-			name:  "string with newlines",
-			input: "hello\nworld",
-			want:  "'hello\nworld'",
-		},
-		{
-			name:  "only single quotes",
-			input: "'''",
-			want:  "''\\'''\\'''\\'''",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := shellQuote(tt.input)
-			if got != tt.want {
-				t.Errorf("shellQuote(%q) = %q, want %q", tt.input, got, tt.want)
-			}
-		})
-	}
-}
-
 func TestJoinCommand(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+var sshCmd = &cobra.Command{
+	Use:   "ssh [host] [-- command...]",
+	Short: "Open an interactive shell on the server",
+	Long: `Opens a terminal on the logged-in server over the cached SSH session, so no
+password or host key prompt is repeated. When stdin is a terminal a PTY is
+requested with the local size, the local terminal is put in raw mode and
+resizes are passed on. Everything after -- runs instead of the login shell.
+
+A host picks the session cached for that alias, like --host. A host with no
+session of its own must be the server of the active session.
+
+labman exits with the remote exit status.
+
+Examples:
+  labman ssh
+  labman ssh homelab-prod
+  labman ssh homelab-prod -- sudo journalctl -fu microk8s`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if hosts := sshHostArgs(cmd, args); len(hosts) > 1 {
+			return fmt.Errorf("accepts at most one host, received %d; put the remote command after --", len(hosts))
+		}
+		return nil
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if hosts := sshHostArgs(cmd, args); len(hosts) == 1 {
+			_, host := splitSSHHost(hosts[0])
+			if err := selectSessionFor(cmd, host); err != nil {
+				return err
+			}
+		}
+		return requireSession(cmd, args)
+	},
+	PersistentPostRun: cleanupSession,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := remote.Current()
+		if client == nil {
+			return fmt.Errorf("not connected to any server. Run 'labman login' first")
+		}
+
+		if hosts := sshHostArgs(cmd, args); len(hosts) == 1 {
+			user, host := splitSSHHost(hosts[0])
+			if err := checkSessionHost(client, host, user); err != nil {
+				return err
+			}
+		}
+
+		noTTY, _ := cmd.Flags().GetBool("no-tty")
+		opts := remote.TerminalOptions{
+			Command: strings.Join(args[len(sshHostArgs(cmd, args)):], " "),
+			Stdin:   cmd.InOrStdin(),
+			Stdout:  cmd.OutOrStdout(),
+			Stderr:  cmd.ErrOrStderr(),
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !noTTY && term.IsTerminal(fd) {
+			width, height, err := term.GetSize(int(os.Stdout.Fd()))
+			if err != nil {
+				width, height = 80, 24
+			}
+			opts.PTY = true
+			opts.Term = os.Getenv("TERM")
+			opts.Size = remote.TerminalSize{Width: width, Height: height}
+
+			oldState, err := term.MakeRaw(fd)
+			if err != nil {
+				return fmt.Errorf("put terminal in raw mode: %w", err)
+			}
+			defer term.Restore(fd, oldState)
+
+			resize, stop := watchTerminalSize(int(os.Stdout.Fd()))
+			defer stop()
+			opts.Resize = resize
+		}
+
+		status, err := client.Terminal(commandContext(cmd), opts)
+		if err != nil {
+			return fmt.Errorf("ssh failed: %w", err)
+		}
+		if status != 0 {
+			cleanupSession(cmd, args)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			return &exitError{code: status}
+		}
+		return nil
+	},
+}
+
+// sshHostArgs returns the arguments before --, which name the host.
+func sshHostArgs(cmd *cobra.Command, args []string) []string {
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		return args[:dash]
+	}
+	return args
+}
+
+// splitSSHHost splits [user@]host; user is "" when none is given.
+func splitSSHHost(arg string) (user, host string) {
+	if user, host, ok := strings.Cut(arg, "@"); ok {
+		return user, host
+	}
+	return "", arg
+}
+
+func init() {
+	rootCmd.AddCommand(sshCmd)
+
+	sshCmd.Flags().BoolP("no-tty", "T", false, "Do not request a PTY, even when stdin is a terminal")
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// watchTerminalSize reports the size of the terminal on fd after every
+// SIGWINCH until stop is called.
+func watchTerminalSize(fd int) (<-chan remote.TerminalSize, func()) {
+	sizes := make(chan remote.TerminalSize, 1)
+	winch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(winch, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-winch:
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				select {
+				case sizes <- remote.TerminalSize{Width: width, Height: height}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return sizes, func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
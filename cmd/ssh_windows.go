@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// terminalPollInterval is how often the console size is checked, since
+// Windows has no SIGWINCH.
+const terminalPollInterval = 250 * time.Millisecond
+
+// watchTerminalSize reports the size of the console on fd whenever it
+// changes until stop is called.
+func watchTerminalSize(fd int) (<-chan remote.TerminalSize, func()) {
+	sizes := make(chan remote.TerminalSize, 1)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(terminalPollInterval)
+		defer ticker.Stop()
+		lastWidth, lastHeight, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-ticker.C:
+				width, height, err := term.GetSize(fd)
+				if err != nil || (width == lastWidth && height == lastHeight) {
+					continue
+				}
+				lastWidth, lastHeight = width, height
+				select {
+				case sizes <- remote.TerminalSize{Width: width, Height: height}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return sizes, func() { close(done) }
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+var useCmd = &cobra.Command{
+	Use:   "use <alias>",
+	Short: "Make a cached session the active one",
+	Long: `Selects which cached session commands use when --host is not given. The
+alias is the name you logged in with; 'labman session list' shows them all.
+
+Examples:
+  labman use k8s-master
+  labman self info                       # runs against k8s-master
+  labman self info --host homelab-prod   # one-off override`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printBanner(cmd)
+
+		name := remote.SessionName(args[0])
+		meta, err := remote.SessionMetadata(name)
+		if err != nil {
+			return fmt.Errorf("no cached session for %s; run 'labman login %s' first", args[0], args[0])
+		}
+		if err := remote.SetActiveSession(name); err != nil {
+			return err
+		}
+
+		printSection(cmd, "ACTIVE SESSION", fmt.Sprintf("%s (%s@%s), %s remaining.", name, meta.User, describeEndpoint(meta), formatTTL(time.Until(meta.Timeout))))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(useCmd)
+}
@@ -3,7 +3,9 @@ module github.com/tinotenda-alfaneti/labman
 go 1.24.0
 
 require (
+	github.com/pkg/sftp v1.13.10
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/sys v0.39.0
 	golang.org/x/term v0.38.0
 )
 
@@ -11,12 +13,12 @@ require (
 	al.essio.dev/pkg/shellescape v1.5.1 // indirect
 	github.com/danieljoos/wincred v1.2.2 // indirect
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.9 // indirect
+	github.com/spf13/pflag v1.0.9
 	github.com/zalando/go-keyring v0.2.6
 	golang.org/x/crypto v0.43.0
 	gopkg.in/yaml.v2 v2.4.0
@@ -2,8 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -21,6 +25,30 @@ type Defaults struct {
 	Username          string        `yaml:"username,omitempty"`
 	Port              int           `yaml:"port,omitempty"`
 	ConnectionTimeout time.Duration `yaml:"connection_timeout,omitempty"`
+	AuthMethods       []string      `yaml:"auth_methods,omitempty"`
+	HostKeyPolicy     string        `yaml:"host_key_policy,omitempty"`
+	// KeepaliveInterval between keepalive@openssh.com requests (0 = 30s, negative disables)
+	KeepaliveInterval time.Duration `yaml:"keepalive_interval,omitempty"`
+	// ReconnectAttempts re-dials a dropped session this many times (0 = never)
+	ReconnectAttempts int `yaml:"reconnect_attempts,omitempty"`
+	// ReconnectBackoff is the first delay between attempts, doubled up to 30s
+	ReconnectBackoff time.Duration `yaml:"reconnect_backoff,omitempty"`
+	// Sudo picks how root commands run: nopasswd, password, or none
+	Sudo string `yaml:"sudo,omitempty"`
+	// SessionTTL is how long a login stays cached (0 = 1h)
+	SessionTTL time.Duration `yaml:"session_ttl,omitempty"`
+	// SessionExpiry is fixed (SessionTTL after login) or sliding (renewed by every successful command)
+	SessionExpiry string `yaml:"session_expiry,omitempty"`
+	// SessionMaxTTL caps sliding renewals and session extend, counted from login (0 = 24h)
+	SessionMaxTTL time.Duration `yaml:"session_max_ttl,omitempty"`
+	// CredentialStore keeps session secrets in the OS keyring, an encrypted file, or auto (keyring, then file)
+	CredentialStore string `yaml:"credential_store,omitempty"`
+	// CredentialFile is the encrypted file used by the file and auto stores (default ~/.labman/credentials.enc)
+	CredentialFile string `yaml:"credential_file,omitempty"`
+	// SSHConfig is the OpenSSH client config consulted for aliases not under hosts (default ~/.ssh/config, none to skip it)
+	SSHConfig string `yaml:"ssh_config,omitempty"`
+	// AuditLog is the JSONL file every remote command is recorded in (default ~/.labman/audit.log, none to disable)
+	AuditLog string `yaml:"audit_log,omitempty"`
 }
 
 // Host represents a single host configuration
@@ -29,6 +57,67 @@ type Host struct {
 	Username string `yaml:"username,omitempty"`
 	Port     int    `yaml:"port,omitempty"`
 	KeyFile  string `yaml:"key_file,omitempty"`
+	// CertFile is an OpenSSH user certificate for key_file (default key_file-cert.pub when present)
+	CertFile string `yaml:"cert_file,omitempty"`
+	// AuthMethods orders the auth methods to try: agent, publickey, password
+	AuthMethods []string `yaml:"auth_methods,omitempty"`
+	// HostKeyPolicy decides how unknown host keys are handled: ask, strict, accept-new
+	HostKeyPolicy string `yaml:"host_key_policy,omitempty"`
+	// ProxyJump names bastions to dial through: aliases or user@host:port, comma separated
+	ProxyJump string `yaml:"proxy_jump,omitempty"`
+	// Sudo picks how root commands run: nopasswd, password, or none
+	Sudo string `yaml:"sudo,omitempty"`
+	// ProxyAllow limits labman proxy destinations: hostnames (* wildcards), IPs or CIDRs, each optionally with :port
+	ProxyAllow []string `yaml:"proxy_allow,omitempty"`
+	// SessionTTL is how long a login stays cached (0 = 1h)
+	SessionTTL time.Duration `yaml:"session_ttl,omitempty"`
+	// SessionExpiry is fixed (SessionTTL after login) or sliding (renewed by every successful command)
+	SessionExpiry string `yaml:"session_expiry,omitempty"`
+	// SessionMaxTTL caps sliding renewals and session extend, counted from login (0 = 24h)
+	SessionMaxTTL time.Duration `yaml:"session_max_ttl,omitempty"`
+}
+
+// LocalHost is the host value that runs workflows on this machine instead of over SSH
+const LocalHost = "localhost"
+
+// IsLocal reports whether the host is this machine (host: localhost), which
+// workflows reach without an SSH session.
+func (h Host) IsLocal() bool {
+	return h.Host == LocalHost
+}
+
+// authMethodNames lists the values accepted in auth_methods
+var authMethodNames = map[string]bool{
+	"agent":     true,
+	"publickey": true,
+	"password":  true,
+}
+
+// hostKeyPolicies lists the values accepted in host_key_policy
+var hostKeyPolicies = map[string]bool{
+	"ask":        true,
+	"strict":     true,
+	"accept-new": true,
+}
+
+// sessionExpiryModes lists the values accepted in session_expiry
+var sessionExpiryModes = map[string]bool{
+	"fixed":   true,
+	"sliding": true,
+}
+
+// credentialStores lists the values accepted in credential_store
+var credentialStores = map[string]bool{
+	"keyring": true,
+	"file":    true,
+	"auto":    true,
+}
+
+// sudoModes lists the values accepted in sudo
+var sudoModes = map[string]bool{
+	"nopasswd": true,
+	"password": true,
+	"none":     true,
 }
 
 var configCache *Config
@@ -130,33 +219,244 @@ func GetConfigPath() (string, error) {
 
 // ResolveHost resolves a host identifier (alias or IP) to connection details
 func (c *Config) ResolveHost(identifier string) (host, username string, port int, keyFile string, err error) {
-	// Check if identifier is a configured host alias
-	if hostConfig, exists := c.Hosts[identifier]; exists {
-		username = hostConfig.Username
-		if username == "" {
-			username = c.Defaults.Username
+	resolved := c.Lookup(identifier)
+	return resolved.Host, resolved.Username, resolved.Port, resolved.KeyFile, nil
+}
+
+// Lookup returns the settings for a host identifier with defaults applied.
+// Identifiers that are not configured aliases are looked up in the OpenSSH
+// client config, and otherwise treated as a direct IP or hostname.
+func (c *Config) Lookup(identifier string) Host {
+	resolved, _ := c.Effective(identifier)
+	return resolved
+}
+
+// Setting is one resolved host setting and where its value came from
+type Setting struct {
+	// Name is the setting's key in the config file, e.g. key_file
+	Name  string
+	Value string
+	// Source is hosts.<alias>, defaults, the file:line of an OpenSSH config
+	// option, or "identifier" when the host is used as typed
+	Source string
+}
+
+// Effective resolves identifier like Lookup and also reports, for every
+// setting that ends up with a value, where that value came from.
+func (c *Config) Effective(identifier string) (Host, []Setting) {
+	sources := map[string]string{}
+	resolved, exists := c.Hosts[identifier]
+	if exists {
+		for _, name := range setFields(resolved) {
+			sources[name] = "hosts." + identifier
+		}
+	} else {
+		resolved = Host{Host: identifier}
+		sources["host"] = "identifier"
+		if ssh := c.sshConfig(); ssh != nil {
+			ssh.apply(identifier, &resolved, sources)
+		}
+	}
+
+	if resolved.Username == "" && c.Defaults.Username != "" {
+		resolved.Username = c.Defaults.Username
+		sources["username"] = "defaults"
+	}
+	if resolved.Port == 0 {
+		resolved.Port = c.Defaults.Port
+		sources["port"] = "defaults"
+	}
+	if resolved.Port == 0 {
+		resolved.Port = 22
+		sources["port"] = "built-in default"
+	}
+	if len(resolved.AuthMethods) == 0 && len(c.Defaults.AuthMethods) > 0 {
+		resolved.AuthMethods = c.Defaults.AuthMethods
+		sources["auth_methods"] = "defaults"
+	}
+	if resolved.HostKeyPolicy == "" && c.Defaults.HostKeyPolicy != "" {
+		resolved.HostKeyPolicy = c.Defaults.HostKeyPolicy
+		sources["host_key_policy"] = "defaults"
+	}
+	if resolved.Sudo == "" && c.Defaults.Sudo != "" {
+		resolved.Sudo = c.Defaults.Sudo
+		sources["sudo"] = "defaults"
+	}
+	if resolved.SessionTTL == 0 && c.Defaults.SessionTTL != 0 {
+		resolved.SessionTTL = c.Defaults.SessionTTL
+		sources["session_ttl"] = "defaults"
+	}
+	if resolved.SessionExpiry == "" && c.Defaults.SessionExpiry != "" {
+		resolved.SessionExpiry = c.Defaults.SessionExpiry
+		sources["session_expiry"] = "defaults"
+	}
+	if resolved.SessionMaxTTL == 0 && c.Defaults.SessionMaxTTL != 0 {
+		resolved.SessionMaxTTL = c.Defaults.SessionMaxTTL
+		sources["session_max_ttl"] = "defaults"
+	}
+
+	var settings []Setting
+	value := reflect.ValueOf(resolved)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		name := yamlName(value.Type().Field(i))
+		text := fmt.Sprint(field.Interface())
+		if list, ok := field.Interface().([]string); ok {
+			text = strings.Join(list, ", ")
+		}
+		settings = append(settings, Setting{Name: name, Value: text, Source: sources[name]})
+	}
+	return resolved, settings
+}
+
+// setFields lists the config keys of the fields set in h
+func setFields(h Host) []string {
+	value := reflect.ValueOf(h)
+	var names []string
+	for i := 0; i < value.NumField(); i++ {
+		if !value.Field(i).IsZero() {
+			names = append(names, yamlName(value.Type().Field(i)))
+		}
+	}
+	return names
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
+
+// JumpChain expands a host's proxy_jump into the bastions to dial, outermost
+// first. Each entry is a configured alias or user@host:port. The first hop's
+// own proxy_jump is expanded as well, so chains can be built from aliases.
+func (c *Config) JumpChain(target Host) ([]Host, error) {
+	return c.jumpChain(target, map[string]bool{})
+}
+
+func (c *Config) jumpChain(target Host, visiting map[string]bool) ([]Host, error) {
+	if strings.TrimSpace(target.ProxyJump) == "" {
+		return nil, nil
+	}
+	if visiting[target.ProxyJump] {
+		return nil, fmt.Errorf("proxy_jump loop detected at '%s'", target.ProxyJump)
+	}
+	visiting[target.ProxyJump] = true
+
+	var hops []Host
+	for i, spec := range strings.Split(target.ProxyJump, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
 		}
 
-		port = hostConfig.Port
-		if port == 0 {
-			port = c.Defaults.Port
+		hop, err := c.jumpHost(spec)
+		if err != nil {
+			return nil, err
 		}
 
-		return hostConfig.Host, username, port, hostConfig.KeyFile, nil
+		if i == 0 {
+			outer, err := c.jumpChain(hop, visiting)
+			if err != nil {
+				return nil, err
+			}
+			hops = append(hops, outer...)
+		}
+		hop.ProxyJump = ""
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// jumpHost resolves a single proxy_jump entry: an alias or [user@]host[:port].
+// Hosts that are not aliases pick up their OpenSSH config settings, with the
+// user and port in the entry taking precedence.
+func (c *Config) jumpHost(spec string) (Host, error) {
+	if _, exists := c.Hosts[spec]; exists {
+		return c.Lookup(spec), nil
+	}
+
+	hop := Host{}
+	address := spec
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		hop.Username = spec[:at]
+		address = spec[at+1:]
 	}
 
-	// Treat as direct IP/hostname
-	username = c.Defaults.Username
-	port = c.Defaults.Port
-	if port == 0 {
-		port = 22
+	hop.Host = address
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		portNum, err := strconv.Atoi(port)
+		if err != nil || portNum < 1 || portNum > 65535 {
+			return Host{}, fmt.Errorf("proxy_jump '%s' has invalid port", spec)
+		}
+		hop.Host = host
+		hop.Port = portNum
+	}
+	if hop.Host == "" {
+		return Host{}, fmt.Errorf("proxy_jump '%s' is missing a host", spec)
+	}
+	if ssh := c.sshConfig(); ssh != nil {
+		fromSSH := Host{Host: hop.Host}
+		ssh.apply(hop.Host, &fromSSH, map[string]string{})
+		hop.Host = fromSSH.Host
+		if hop.Username == "" {
+			hop.Username = fromSSH.Username
+		}
+		if hop.Port == 0 {
+			hop.Port = fromSSH.Port
+		}
+		hop.KeyFile = fromSSH.KeyFile
+		hop.ProxyJump = fromSSH.ProxyJump
 	}
 
-	return identifier, username, port, "", nil
+	if hop.Username == "" {
+		hop.Username = c.Defaults.Username
+	}
+	if hop.Port == 0 {
+		hop.Port = c.Defaults.Port
+	}
+	if hop.Port == 0 {
+		hop.Port = 22
+	}
+	hop.AuthMethods = c.Defaults.AuthMethods
+	hop.HostKeyPolicy = c.Defaults.HostKeyPolicy
+	return hop, nil
 }
 
 // Validate checks the configuration for errors
 func (c *Config) Validate() error {
+	for _, method := range c.Defaults.AuthMethods {
+		if !authMethodNames[method] {
+			return fmt.Errorf("defaults has unknown auth method '%s' (use agent, publickey, or password)", method)
+		}
+	}
+
+	if c.Defaults.HostKeyPolicy != "" && !hostKeyPolicies[c.Defaults.HostKeyPolicy] {
+		return fmt.Errorf("defaults has invalid host_key_policy '%s' (use ask, strict, or accept-new)", c.Defaults.HostKeyPolicy)
+	}
+
+	if c.Defaults.Sudo != "" && !sudoModes[c.Defaults.Sudo] {
+		return fmt.Errorf("defaults has invalid sudo mode '%s' (use nopasswd, password, or none)", c.Defaults.Sudo)
+	}
+
+	if c.Defaults.CredentialStore != "" && !credentialStores[c.Defaults.CredentialStore] {
+		return fmt.Errorf("defaults has invalid credential_store '%s' (use keyring, file, or auto)", c.Defaults.CredentialStore)
+	}
+
+	if c.Defaults.ReconnectAttempts < 0 {
+		return fmt.Errorf("defaults has negative reconnect_attempts: %d", c.Defaults.ReconnectAttempts)
+	}
+
+	if err := validateSessionExpiry(c.Defaults.SessionTTL, c.Defaults.SessionExpiry, c.Defaults.SessionMaxTTL); err != nil {
+		return fmt.Errorf("defaults %w", err)
+	}
+
+	if _, err := c.loadSSHConfig(); err != nil {
+		return fmt.Errorf("ssh_config: %w", err)
+	}
+
 	// Validate hosts
 	for alias, host := range c.Hosts {
 		if host.Host == "" {
@@ -166,11 +466,43 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("host '%s' has invalid port: %d", alias, host.Port)
 		}
 		if host.KeyFile != "" {
-			expandedPath := os.ExpandEnv(host.KeyFile)
+			expandedPath := ExpandPath(host.KeyFile)
 			if _, err := os.Stat(expandedPath); err != nil {
 				return fmt.Errorf("host '%s' key file not found: %s", alias, expandedPath)
 			}
 		}
+		if host.CertFile != "" {
+			if host.KeyFile == "" {
+				return fmt.Errorf("host '%s' sets cert_file without key_file", alias)
+			}
+			expandedPath := ExpandPath(host.CertFile)
+			if _, err := os.Stat(expandedPath); err != nil {
+				return fmt.Errorf("host '%s' certificate file not found: %s", alias, expandedPath)
+			}
+		}
+		for _, method := range host.AuthMethods {
+			if !authMethodNames[method] {
+				return fmt.Errorf("host '%s' has unknown auth method '%s' (use agent, publickey, or password)", alias, method)
+			}
+		}
+		if host.HostKeyPolicy != "" && !hostKeyPolicies[host.HostKeyPolicy] {
+			return fmt.Errorf("host '%s' has invalid host_key_policy '%s' (use ask, strict, or accept-new)", alias, host.HostKeyPolicy)
+		}
+		if host.Sudo != "" && !sudoModes[host.Sudo] {
+			return fmt.Errorf("host '%s' has invalid sudo mode '%s' (use nopasswd, password, or none)", alias, host.Sudo)
+		}
+		resolved := c.Lookup(alias)
+		if err := validateSessionExpiry(resolved.SessionTTL, resolved.SessionExpiry, resolved.SessionMaxTTL); err != nil {
+			return fmt.Errorf("host '%s' %w", alias, err)
+		}
+		if _, err := c.JumpChain(host); err != nil {
+			return fmt.Errorf("host '%s': %w", alias, err)
+		}
+		for _, entry := range host.ProxyAllow {
+			if err := validateProxyAllow(entry); err != nil {
+				return fmt.Errorf("host '%s' has invalid proxy_allow entry '%s': %w", alias, entry, err)
+			}
+		}
 	}
 
 	// Validate groups
@@ -185,6 +517,57 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateSessionExpiry checks one set of session_* settings. Errors read
+// after "defaults" or "host 'x'".
+func validateSessionExpiry(ttl time.Duration, mode string, maxTTL time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("has negative session_ttl: %s", ttl)
+	}
+	if maxTTL < 0 {
+		return fmt.Errorf("has negative session_max_ttl: %s", maxTTL)
+	}
+	if mode != "" && !sessionExpiryModes[mode] {
+		return fmt.Errorf("has invalid session_expiry '%s' (use fixed or sliding)", mode)
+	}
+	if ttl > 0 && maxTTL > 0 && maxTTL < ttl {
+		return fmt.Errorf("has session_max_ttl %s shorter than session_ttl %s", maxTTL, ttl)
+	}
+	return nil
+}
+
+// validateProxyAllow checks the parts of a proxy_allow entry that can be
+// checked without resolving names: the optional port and CIDR ranges.
+func validateProxyAllow(entry string) error {
+	host := entry
+	if h, portText, err := net.SplitHostPort(entry); err == nil {
+		port, err := strconv.Atoi(portText)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %q", portText)
+		}
+		host = h
+	}
+	if host == "" {
+		return fmt.Errorf("empty host")
+	}
+	if strings.Contains(host, "/") {
+		if _, _, err := net.ParseCIDR(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpandPath expands environment variables and a leading ~ in a file path
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
 // CreateDefaultConfig creates a sample configuration file
 func CreateDefaultConfig() error {
 	configPath, err := GetConfigPath()
@@ -210,6 +593,17 @@ defaults:
   username: ubuntu
   port: 22
   connection_timeout: 30s
+  # host_key_policy: ask  # ask, strict, or accept-new for unknown host keys
+  # keepalive_interval: 30s  # negative disables keepalives
+  # reconnect_attempts: 5    # re-dial dropped sessions with backoff (off by default)
+  # reconnect_backoff: 1s
+  # session_ttl: 8h          # how long a login stays cached (default 1h)
+  # session_expiry: sliding  # fixed, or sliding: every successful command renews the TTL
+  # session_max_ttl: 24h     # hard limit for sliding renewals and 'labman session extend'
+  # credential_store: auto   # keyring, file (passphrase-encrypted), or auto (file when no keyring is reachable)
+  # credential_file: ~/.labman/credentials.enc
+  # ssh_config: ~/.ssh/config  # consulted for aliases not listed under hosts; none to skip
+  # audit_log: ~/.labman/audit.log  # every remote command, see 'labman audit'; none to disable
 
 hosts:
   homelab-prod:
@@ -217,15 +611,29 @@ hosts:
     username: admin
     # port: 22  # optional, defaults to 22
     # key_file: ~/.ssh/id_homelab  # optional, for SSH key auth
+    # cert_file: ~/.ssh/id_homelab-cert.pub  # optional, OpenSSH user certificate for key_file
+    # auth_methods: [agent, publickey, password]  # optional, order to try
+    # sudo: password  # nopasswd (sudo -n), password (cached password on stdin), or none
 
   k8s-master:
     host: 192.168.1.20
     username: ubuntu
 
+  # Reach a host through a bastion (alias or user@host:port, comma separated for multiple hops)
+  # internal-node:
+  #   host: 10.0.0.5
+  #   proxy_jump: homelab-prod
+  #   proxy_allow: [192.168.1.0/24, "*.lan", "grafana.internal:3000"]  # labman proxy destinations
+
+  # Run cluster, self and diag workflows on this machine, without SSH
+  # this-box:
+  #   host: localhost
+  #   sudo: nopasswd
+
   # Add more hosts as needed
   # my-server:
   #   host: example.com
-  #   port: 2222
+  #   port: 2222  # port and connection_timeout are used for every dial
 
 groups:
   production:
@@ -253,4 +661,5 @@ groups:
 // ClearCache clears the cached configuration (useful for testing)
 func ClearCache() {
 	configCache = nil
+	sshConfigCache = nil
 }
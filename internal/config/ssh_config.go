@@ -0,0 +1,345 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxSSHConfigIncludeDepth matches the nesting limit of OpenSSH.
+const maxSSHConfigIncludeDepth = 16
+
+// sshConfig holds the parts of an OpenSSH client config labman uses to
+// resolve aliases that are not under hosts.
+type sshConfig struct {
+	path   string
+	blocks []sshConfigBlock
+}
+
+// sshConfigBlock is a Host (or Match) section. Options before the first Host
+// line form a block matching every host.
+type sshConfigBlock struct {
+	patterns []string
+	// within holds the Host patterns around the Include that pulled this
+	// block in; the block only applies when they match as well.
+	within [][]string
+	// match marks a Match section, which labman does not evaluate and
+	// never applies.
+	match   bool
+	options []sshConfigOption
+}
+
+type sshConfigOption struct {
+	key   string
+	value string
+	file  string
+	line  int
+}
+
+// source names the line an option was read from.
+func (o sshConfigOption) source() string {
+	return fmt.Sprintf("%s:%d", o.file, o.line)
+}
+
+var sshConfigCache *sshConfig
+
+// sshConfigPath returns the OpenSSH config consulted for unknown aliases, or
+// "" when the config turns the lookup off.
+func (c *Config) sshConfigPath() (string, error) {
+	switch c.Defaults.SSHConfig {
+	case "none":
+		return "", nil
+	case "":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("resolve home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".ssh", "config"), nil
+	default:
+		return ExpandPath(c.Defaults.SSHConfig), nil
+	}
+}
+
+// loadSSHConfig parses the OpenSSH config once per path. A missing file is
+// not an error and yields nil.
+func (c *Config) loadSSHConfig() (*sshConfig, error) {
+	configPath, err := c.sshConfigPath()
+	if err != nil || configPath == "" {
+		return nil, err
+	}
+	if sshConfigCache != nil && sshConfigCache.path == configPath {
+		return sshConfigCache, nil
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	parsed := &sshConfig{path: configPath}
+	if err := parsed.parseFile(configPath, nil, 0); err != nil {
+		return nil, err
+	}
+	sshConfigCache = parsed
+	return parsed, nil
+}
+
+// sshConfig is loadSSHConfig for lookups, which skip a config that does not
+// parse; Validate reports the error instead.
+func (c *Config) sshConfig() *sshConfig {
+	parsed, err := c.loadSSHConfig()
+	if err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// SSHConfigHosts lists the literal Host names in the OpenSSH config, leaving
+// out wildcard and negated patterns.
+func (c *Config) SSHConfigHosts() []string {
+	parsed := c.sshConfig()
+	if parsed == nil {
+		return nil
+	}
+
+	var hosts []string
+	seen := map[string]bool{}
+	for _, block := range parsed.blocks {
+		if block.match {
+			continue
+		}
+		for _, pattern := range block.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			hosts = append(hosts, pattern)
+		}
+	}
+	return hosts
+}
+
+func (s *sshConfig) parseFile(file string, within [][]string, depth int) error {
+	if depth > maxSSHConfigIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read ssh config: %w", err)
+	}
+
+	current := sshConfigBlock{patterns: []string{"*"}, within: within}
+	for number, line := range strings.Split(string(data), "\n") {
+		key, value := splitSSHConfigLine(line)
+		if key == "" {
+			continue
+		}
+		if value == "" {
+			return fmt.Errorf("%s:%d: %s has no value", file, number+1, key)
+		}
+
+		switch key {
+		case "host":
+			s.blocks = append(s.blocks, current)
+			current = sshConfigBlock{patterns: strings.Fields(strings.ToLower(value)), within: within}
+		case "match":
+			s.blocks = append(s.blocks, current)
+			current = sshConfigBlock{match: true, within: within}
+		case "include":
+			s.blocks = append(s.blocks, current)
+			nested := append(append([][]string(nil), within...), current.patterns)
+			for _, pattern := range strings.Fields(value) {
+				if err := s.include(pattern, nested, current.match, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", file, number+1, err)
+				}
+			}
+			current = sshConfigBlock{patterns: current.patterns, within: within, match: current.match}
+		default:
+			current.options = append(current.options, sshConfigOption{key: key, value: unquote(value), file: file, line: number + 1})
+		}
+	}
+	s.blocks = append(s.blocks, current)
+	return nil
+}
+
+// include parses the files matching pattern, which is relative to the
+// directory of the top-level config unless absolute.
+func (s *sshConfig) include(pattern string, within [][]string, match bool, depth int) error {
+	if match {
+		// The surrounding Match section never applies, so neither does
+		// anything it includes.
+		return nil
+	}
+	pattern = ExpandPath(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(s.path), pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("include %s: %w", pattern, err)
+	}
+	for _, file := range files {
+		if err := s.parseFile(file, within, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine returns a line's lower-cased keyword and its value,
+// accepting both "Key value" and "Key=value". Blank and comment lines have
+// no keyword.
+func splitSSHConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), ""
+	}
+	value := strings.TrimSpace(line[end:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	return strings.ToLower(line[:end]), value
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// lookup returns the values of each option that apply to alias, in file
+// order. As in ssh, the first one wins, except that every IdentityFile is a
+// candidate key.
+func (s *sshConfig) lookup(alias string) map[string][]sshConfigOption {
+	alias = strings.ToLower(alias)
+	options := map[string][]sshConfigOption{}
+	for _, block := range s.blocks {
+		if !block.appliesTo(alias) {
+			continue
+		}
+		for _, option := range block.options {
+			options[option.key] = append(options[option.key], option)
+		}
+	}
+	return options
+}
+
+func (b sshConfigBlock) appliesTo(alias string) bool {
+	if b.match || !sshPatternsMatch(b.patterns, alias) {
+		return false
+	}
+	for _, patterns := range b.within {
+		if !sshPatternsMatch(patterns, alias) {
+			return false
+		}
+	}
+	return true
+}
+
+// sshPatternsMatch applies a Host line: any pattern may match, but a
+// matching !pattern rules the host out.
+func sshPatternsMatch(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), alias); !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// apply fills the settings of h that the OpenSSH config provides for alias,
+// recording each one's file and line in sources.
+func (s *sshConfig) apply(alias string, h *Host, sources map[string]string) {
+	options := s.lookup(alias)
+	first := func(key string) (sshConfigOption, bool) {
+		if values := options[key]; len(values) > 0 {
+			return values[0], true
+		}
+		return sshConfigOption{}, false
+	}
+
+	if option, ok := first("hostname"); ok {
+		h.Host = expandSSHTokens(option.value, alias, "", "")
+		sources["host"] = option.source()
+	}
+	if option, ok := first("user"); ok {
+		h.Username = expandSSHTokens(option.value, alias, "", "")
+		sources["username"] = option.source()
+	}
+	if option, ok := first("port"); ok {
+		if port, err := strconv.Atoi(option.value); err == nil && port > 0 && port <= 65535 {
+			h.Port = port
+			sources["port"] = option.source()
+		}
+	}
+	// ssh skips identity files that do not exist, so only the first one
+	// present is used.
+	for _, option := range options["identityfile"] {
+		if strings.EqualFold(option.value, "none") {
+			break
+		}
+		keyFile := ExpandPath(expandSSHTokens(option.value, h.Host, h.Username, alias))
+		if _, err := os.Stat(keyFile); err == nil {
+			h.KeyFile = keyFile
+			sources["key_file"] = option.source()
+			break
+		}
+	}
+	if option, ok := first("proxyjump"); ok && !strings.EqualFold(option.value, "none") {
+		h.ProxyJump = option.value
+		sources["proxy_jump"] = option.source()
+	}
+}
+
+// expandSSHTokens replaces the ssh_config tokens labman can know: %h (the
+// host), %r (the remote user), %n (the alias as typed), %d (the home
+// directory), %u (the local user) and %%.
+func expandSSHTokens(value, host, remoteUser, alias string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	if alias == "" {
+		alias = host
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' || i == len(value)-1 {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'h':
+			out.WriteString(host)
+		case 'r':
+			out.WriteString(remoteUser)
+		case 'n':
+			out.WriteString(alias)
+		case 'd':
+			homeDir, _ := os.UserHomeDir()
+			out.WriteString(homeDir)
+		case 'u':
+			if current, err := user.Current(); err == nil {
+				out.WriteString(current.Username)
+			}
+		case '%':
+			out.WriteByte('%')
+		default:
+			out.WriteByte('%')
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String()
+}
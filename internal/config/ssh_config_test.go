@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSSHConfig writes files (name -> contents) into a temporary ~/.ssh and
+// returns a config that reads its "config" file.
+func writeSSHConfig(t *testing.T, files map[string]string) (*Config, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	ClearCache()
+	t.Cleanup(ClearCache)
+
+	cfg := &Config{
+		Defaults: Defaults{Username: "ubuntu", Port: 22, Sudo: "password", SSHConfig: filepath.Join(dir, "config")},
+		Hosts: map[string]Host{
+			"prod": {Host: "192.168.1.10", Username: "admin"},
+		},
+	}
+	return cfg, dir
+}
+
+func TestEffectiveSSHConfig(t *testing.T) {
+	cfg, dir := writeSSHConfig(t, map[string]string{
+		"config": `# homelab
+Include config.d/*
+
+Host nas
+    HostName 192.168.1.40
+    User admin
+    IdentityFile ~/.ssh/missing
+    IdentityFile %d/id_nas
+
+Host *.lab !vault.lab
+    User=ops
+    ProxyJump bastion
+
+Host prod
+    HostName ignored.example
+
+Host bastion
+    HostName "bastion.example.com"
+    Port 2222
+
+Match host nas
+    User nobody
+
+Host *
+    User fallback
+`,
+		"config.d/k8s": "Host k8s\n  HostName %h.lab.example\n  Port 2200\n",
+		"id_nas":       "",
+	})
+	t.Setenv("HOME", dir)
+	sshConfig := filepath.Join(dir, "config")
+
+	tests := []struct {
+		identifier string
+		want       []Setting
+	}{
+		{
+			identifier: "nas",
+			want: []Setting{
+				{Name: "host", Value: "192.168.1.40", Source: sshConfig + ":5"},
+				{Name: "username", Value: "admin", Source: sshConfig + ":6"},
+				{Name: "port", Value: "22", Source: "defaults"},
+				{Name: "key_file", Value: filepath.Join(dir, "id_nas"), Source: sshConfig + ":8"},
+				{Name: "sudo", Value: "password", Source: "defaults"},
+			},
+		},
+		{
+			identifier: "node1.lab",
+			want: []Setting{
+				{Name: "host", Value: "node1.lab", Source: "identifier"},
+				{Name: "username", Value: "ops", Source: sshConfig + ":11"},
+				{Name: "port", Value: "22", Source: "defaults"},
+				{Name: "proxy_jump", Value: "bastion", Source: sshConfig + ":12"},
+				{Name: "sudo", Value: "password", Source: "defaults"},
+			},
+		},
+		{
+			identifier: "vault.lab",
+			want: []Setting{
+				{Name: "host", Value: "vault.lab", Source: "identifier"},
+				{Name: "username", Value: "fallback", Source: sshConfig + ":25"},
+				{Name: "port", Value: "22", Source: "defaults"},
+				{Name: "sudo", Value: "password", Source: "defaults"},
+			},
+		},
+		{
+			identifier: "k8s",
+			want: []Setting{
+				{Name: "host", Value: "k8s.lab.example", Source: filepath.Join(dir, "config.d", "k8s") + ":2"},
+				{Name: "username", Value: "fallback", Source: sshConfig + ":25"},
+				{Name: "port", Value: "2200", Source: filepath.Join(dir, "config.d", "k8s") + ":3"},
+				{Name: "sudo", Value: "password", Source: "defaults"},
+			},
+		},
+		{
+			identifier: "prod",
+			want: []Setting{
+				{Name: "host", Value: "192.168.1.10", Source: "hosts.prod"},
+				{Name: "username", Value: "admin", Source: "hosts.prod"},
+				{Name: "port", Value: "22", Source: "defaults"},
+				{Name: "sudo", Value: "password", Source: "defaults"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identifier, func(t *testing.T) {
+			_, got := cfg.Effective(tt.identifier)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Effective(%q) = %+v, want %+v", tt.identifier, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("setting %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("ResolveHost uses the ssh config", func(t *testing.T) {
+		host, username, port, keyFile, err := cfg.ResolveHost("nas")
+		if err != nil || host != "192.168.1.40" || username != "admin" || port != 22 || keyFile != filepath.Join(dir, "id_nas") {
+			t.Fatalf("ResolveHost = %s %s %d %s %v", host, username, port, keyFile, err)
+		}
+	})
+
+	t.Run("jump hosts resolve through the ssh config", func(t *testing.T) {
+		chain, err := cfg.JumpChain(cfg.Lookup("node1.lab"))
+		if err != nil {
+			t.Fatalf("JumpChain: %v", err)
+		}
+		if len(chain) != 1 || chain[0].Host != "bastion.example.com" || chain[0].Port != 2222 || chain[0].Username != "fallback" {
+			t.Fatalf("unexpected chain: %+v", chain)
+		}
+	})
+
+	t.Run("lists literal hosts", func(t *testing.T) {
+		got := strings.Join(cfg.SSHConfigHosts(), ",")
+		if got != "k8s,nas,prod,bastion" {
+			t.Fatalf("SSHConfigHosts = %s", got)
+		}
+	})
+}
+
+func TestSSHConfigDisabledOrBroken(t *testing.T) {
+	cfg, dir := writeSSHConfig(t, map[string]string{"config": "Host nas\n  HostName 192.168.1.40\n  User\n"})
+
+	if got := cfg.Lookup("nas"); got.Host != "nas" {
+		t.Fatalf("expected a config that does not parse to be skipped, got %+v", got)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "config:3") {
+		t.Fatalf("expected Validate to report the bad line, got %v", err)
+	}
+
+	cfg.Defaults.SSHConfig = "none"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected no error with ssh_config: none, got %v", err)
+	}
+
+	cfg.Defaults.SSHConfig = filepath.Join(dir, "missing")
+	if got := cfg.Lookup("nas"); got.Host != "nas" || got.Username != "ubuntu" {
+		t.Fatalf("expected plain defaults without an ssh config, got %+v", got)
+	}
+}
@@ -0,0 +1,273 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuditMaxSize is the size at which the audit log is rotated.
+	DefaultAuditMaxSize = 10 << 20
+	// DefaultAuditBackups is how many rotated audit logs are kept.
+	DefaultAuditBackups = 5
+)
+
+// AuditRecord is one remote execution, stored as a line of JSON.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	LocalUser string    `json:"local_user"`
+	// Session is the alias the session was cached under
+	Session    string `json:"session,omitempty"`
+	Host       string `json:"host"`
+	Port       int    `json:"port,omitempty"`
+	RemoteUser string `json:"remote_user"`
+	// Labman is the labman command that ran it, e.g. "labman self clean"
+	Labman string `json:"labman_command"`
+	// Command is the remote command as labman issued it, before sudo
+	// wrapping; "" for an interactive shell
+	Command string `json:"command"`
+	Sudo    bool   `json:"sudo,omitempty"`
+	// ExitCode is -1 when the command never reported a status
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Failed reports whether the command exited non-zero or did not finish.
+func (r AuditRecord) Failed() bool {
+	return r.ExitCode != 0 || r.Error != ""
+}
+
+// Duration returns how long the command ran.
+func (r AuditRecord) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// AuditLog appends AuditRecords to a JSONL file and rotates it by size:
+// when the next record would take it past MaxSize, path becomes path.1,
+// path.1 becomes path.2 and so on, keeping Backups old files.
+type AuditLog struct {
+	Path    string
+	MaxSize int64
+	Backups int
+	// OnError, if set, is told when a record cannot be written. Commands
+	// are never failed because of the audit log.
+	OnError func(error)
+
+	mu sync.Mutex
+}
+
+// NewAuditLog returns a log at path with the default rotation settings.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path, MaxSize: DefaultAuditMaxSize, Backups: DefaultAuditBackups}
+}
+
+// DefaultAuditLogPath returns ~/.labman/audit.log.
+func DefaultAuditLogPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".labman", "audit.log"), nil
+}
+
+var (
+	auditMu      sync.Mutex
+	auditLog     *AuditLog
+	auditCommand string
+)
+
+// SetAuditLog selects where remote executions are recorded; nil turns
+// auditing off.
+func SetAuditLog(log *AuditLog) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = log
+}
+
+// SetAuditCommand names the labman command that following executions are
+// made for, e.g. "labman self clean".
+func SetAuditCommand(path string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditCommand = path
+}
+
+func currentAudit() (*AuditLog, string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return auditLog, auditCommand
+}
+
+// Append writes record as one line, rotating the file first if needed.
+func (l *AuditLog) Append(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return fmt.Errorf("create audit log directory: %w", err)
+	}
+	if err := l.rotate(int64(len(line))); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+
+	file, err := os.OpenFile(l.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the log aside when adding next bytes would exceed MaxSize.
+func (l *AuditLog) rotate(next int64) error {
+	info, err := os.Stat(l.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if l.MaxSize <= 0 || info.Size() == 0 || info.Size()+next <= l.MaxSize {
+		return nil
+	}
+
+	if l.Backups <= 0 {
+		return os.Remove(l.Path)
+	}
+	for i := l.Backups - 1; i >= 1; i-- {
+		err := os.Rename(l.backup(i), l.backup(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.Path, l.backup(1))
+}
+
+func (l *AuditLog) backup(n int) string {
+	return fmt.Sprintf("%s.%d", l.Path, n)
+}
+
+// Records reads the rotated files and the current log, oldest first. Lines
+// that are not valid JSON, such as one torn by a crash, are skipped.
+func (l *AuditLog) Records() ([]AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []AuditRecord
+	for i := l.Backups; i >= 0; i-- {
+		name := l.Path
+		if i > 0 {
+			name = l.backup(i)
+		}
+		file, err := os.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+		for scanner.Scan() {
+			var record AuditRecord
+			if json.Unmarshal(scanner.Bytes(), &record) == nil {
+				records = append(records, record)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+	}
+	return records, nil
+}
+
+var (
+	localUserOnce sync.Once
+	localUserName string
+)
+
+// localUser names the user running labman.
+func localUser() string {
+	localUserOnce.Do(func() {
+		if current, err := user.Current(); err == nil {
+			localUserName = current.Username
+			return
+		}
+		localUserName = os.Getenv("USER")
+	})
+	return localUserName
+}
+
+// audit records one execution on the session, unless it is made by the
+// daemon on a client's behalf: the client records those itself.
+func (s *SSHSession) audit(cmd string, sudo bool, start time.Time, result *RunResult, err error) {
+	log, labman := currentAudit()
+	if log == nil || s.daemonServed {
+		return
+	}
+
+	record := AuditRecord{
+		Time:       start,
+		LocalUser:  localUser(),
+		Session:    s.Name,
+		Host:       s.Host,
+		RemoteUser: s.User,
+		Labman:     labman,
+		Command:    cmd,
+		Sudo:       sudo,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if s.Port != 0 && s.Port != 22 {
+		record.Port = s.Port
+	}
+	if result != nil {
+		record.ExitCode = result.ExitCode
+	}
+	if err != nil {
+		record.Error = err.Error()
+		if result == nil {
+			record.ExitCode = -1
+		}
+	}
+
+	if appendErr := log.Append(record); appendErr != nil && log.OnError != nil {
+		log.OnError(appendErr)
+	}
+}
+
+// auditStream records a streamed command, whose result only survives in a
+// *CommandError.
+func (s *SSHSession) auditStream(cmd string, sudo bool, start time.Time, err error) {
+	var result *RunResult
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		result = cmdErr.Result
+	} else if err == nil {
+		result = &RunResult{}
+	}
+	s.audit(cmd, sudo, start, result, err)
+}
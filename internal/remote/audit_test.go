@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labman", "audit.log")
+	log := &AuditLog{Path: path, MaxSize: 400, Backups: 2}
+
+	for i := 0; i < 12; i++ {
+		record := AuditRecord{Time: time.Unix(int64(i), 0).UTC(), Host: "nas", Command: "uptime", ExitCode: i}
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+		if info.Size() > log.MaxSize {
+			t.Errorf("%s is %d bytes, over the %d limit", name, info.Size(), log.MaxSize)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has mode %v", name, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups, got %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString(`{"time": "torn`)
+	f.Close()
+
+	records, err := log.Records()
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	if len(records) == 0 || records[len(records)-1].ExitCode != 11 {
+		t.Fatalf("expected the newest record last, got %+v", records)
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].ExitCode != records[i-1].ExitCode+1 {
+			t.Fatalf("records out of order: %+v", records)
+		}
+	}
+}
+
+func TestAuditRecordFailed(t *testing.T) {
+	tests := []struct {
+		record AuditRecord
+		want   bool
+	}{
+		{AuditRecord{ExitCode: 0}, false},
+		{AuditRecord{ExitCode: 1}, true},
+		{AuditRecord{ExitCode: -1, Error: "connection lost"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.record.Failed(); got != tt.want {
+			t.Errorf("%+v.Failed() = %v, want %v", tt.record, got, tt.want)
+		}
+	}
+}
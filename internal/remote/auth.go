@@ -0,0 +1,354 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Auth method names recorded in the session cache and accepted in
+// auth_methods in the config file.
+const (
+	AuthAgent     = "agent"
+	AuthPublicKey = "publickey"
+	AuthPassword  = "password"
+)
+
+// DefaultAuthOrder is used when a host does not configure auth_methods.
+var DefaultAuthOrder = []string{AuthPublicKey, AuthAgent, AuthPassword}
+
+// AuthOptions describes the credentials offered when dialing a host.
+type AuthOptions struct {
+	// Methods lists the auth methods in the order they are tried. Empty
+	// means DefaultAuthOrder.
+	Methods  []string
+	Password string
+	// PasswordPrompt is called lazily when password auth is needed and
+	// Password is empty.
+	PasswordPrompt func() (string, error)
+	KeyFile        string
+	Passphrase     string
+	// CertFile is an OpenSSH user certificate for KeyFile. Empty means
+	// KeyFile-cert.pub when that file exists, as ssh does.
+	CertFile string
+}
+
+// PassphrasePrompt is consulted when KeyFile is encrypted and no passphrase
+// was supplied. A nil prompt makes encrypted keys unusable.
+var PassphrasePrompt func(keyFile string) (string, error)
+
+// dialAgent connects to the ssh-agent named by SSH_AUTH_SOCK.
+var dialAgent = func() (agent.ExtendedAgent, io.Closer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to ssh-agent: %w", err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+// AgentAvailable reports whether an ssh-agent socket is configured.
+func AgentAvailable() bool {
+	return os.Getenv("SSH_AUTH_SOCK") != ""
+}
+
+// authState tracks which credentials were actually used during a handshake.
+type authState struct {
+	opts       AuthOptions
+	used       string
+	passphrase string
+	password   string
+	certFile   string
+	problems   []error
+	closers    []io.Closer
+}
+
+// method reports the auth method that completed the handshake.
+func (a *authState) method() string {
+	if a.used == "" {
+		return AuthPassword
+	}
+	return a.used
+}
+
+// unavailable explains why configured methods could not be offered.
+func (a *authState) unavailable() error {
+	return errors.Join(a.problems...)
+}
+
+func (a *authState) close() {
+	for _, closer := range a.closers {
+		closer.Close()
+	}
+	a.closers = nil
+}
+
+// authMethods builds the ssh auth methods in the configured order. The agent
+// and the key file are both "publickey" to the server, and the client only
+// tries one method per name, so their signers share a single callback.
+func (a *authState) authMethods() []ssh.AuthMethod {
+	order := a.opts.Methods
+	if len(order) == 0 {
+		order = DefaultAuthOrder
+	}
+
+	var methods []ssh.AuthMethod
+	var signers []ssh.Signer
+	publicKeyAdded := false
+	passwordAdded := false
+
+	for _, name := range order {
+		switch name {
+		case AuthAgent:
+			if len(a.opts.Methods) == 0 && !AgentAvailable() {
+				continue
+			}
+			signers = append(signers, a.agentSigners()...)
+		case AuthPublicKey:
+			if a.opts.KeyFile == "" {
+				continue
+			}
+			signer, passphrase, err := loadKeySigner(a.opts.KeyFile, a.opts.Passphrase)
+			if err != nil {
+				a.problems = append(a.problems, err)
+				continue
+			}
+			a.passphrase = passphrase
+			if certFile := userCertFile(a.opts); certFile != "" {
+				signer, err = loadCertSigner(signer, certFile)
+				if err != nil {
+					a.problems = append(a.problems, err)
+					continue
+				}
+				a.certFile = certFile
+			}
+			signers = append(signers, a.track(signer, AuthPublicKey))
+		case AuthPassword:
+			if passwordAdded || (a.opts.Password == "" && a.opts.PasswordPrompt == nil) {
+				continue
+			}
+			passwordAdded = true
+			methods = append(methods, ssh.PasswordCallback(a.passwordCallback))
+			continue
+		default:
+			a.problems = append(a.problems, fmt.Errorf("unknown auth method %q", name))
+			continue
+		}
+
+		if !publicKeyAdded {
+			publicKeyAdded = true
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return signers, nil
+			}))
+		}
+	}
+
+	if len(signers) == 0 && !passwordAdded {
+		return nil
+	}
+	return methods
+}
+
+func (a *authState) agentSigners() []ssh.Signer {
+	client, closer, err := dialAgent()
+	if err != nil {
+		a.problems = append(a.problems, err)
+		return nil
+	}
+	a.closers = append(a.closers, closer)
+
+	agentSigners, err := client.Signers()
+	if err != nil {
+		a.problems = append(a.problems, fmt.Errorf("list ssh-agent keys: %w", err))
+		return nil
+	}
+	if len(agentSigners) == 0 {
+		a.problems = append(a.problems, errors.New("ssh-agent has no keys"))
+		return nil
+	}
+
+	tracked := make([]ssh.Signer, 0, len(agentSigners))
+	for _, signer := range agentSigners {
+		tracked = append(tracked, a.track(signer, AuthAgent))
+	}
+	return tracked
+}
+
+func (a *authState) passwordCallback() (string, error) {
+	password := a.opts.Password
+	if password == "" {
+		var err error
+		password, err = a.opts.PasswordPrompt()
+		if err != nil {
+			return "", err
+		}
+	}
+	a.password = password
+	a.used = AuthPassword
+	return password, nil
+}
+
+func (a *authState) track(signer ssh.Signer, source string) ssh.Signer {
+	return &trackedSigner{Signer: signer, onSign: func() { a.used = source }}
+}
+
+// trackedSigner records that its key signed the auth request. The client
+// only signs once the server has accepted the public key, so the last signer
+// used is the one that authenticated the session.
+type trackedSigner struct {
+	ssh.Signer
+	onSign func()
+}
+
+func (t *trackedSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	t.onSign()
+	return t.Signer.Sign(rand, data)
+}
+
+func (t *trackedSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	t.onSign()
+	if as, ok := t.Signer.(ssh.AlgorithmSigner); ok {
+		return as.SignWithAlgorithm(rand, data, algorithm)
+	}
+	return t.Signer.Sign(rand, data)
+}
+
+func (t *trackedSigner) Algorithms() []string {
+	if ms, ok := t.Signer.(ssh.MultiAlgorithmSigner); ok {
+		return ms.Algorithms()
+	}
+	keyType := t.PublicKey().Type()
+	if cert, ok := t.PublicKey().(*ssh.Certificate); ok {
+		// Certificates are signed with their key's algorithms.
+		keyType = cert.Key.Type()
+	}
+	if _, ok := t.Signer.(ssh.AlgorithmSigner); ok && keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// loadKeySigner reads a private key, asking for a passphrase when the key is
+// encrypted and none was given. It returns the passphrase that unlocked it.
+func loadKeySigner(path, passphrase string) (ssh.Signer, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("read key file: %w", err)
+	}
+
+	if passphrase == "" {
+		signer, err := ssh.ParsePrivateKey(data)
+		if err == nil {
+			return signer, "", nil
+		}
+
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return nil, "", fmt.Errorf("parse key file %s: %w", path, err)
+		}
+		if PassphrasePrompt == nil {
+			return nil, "", fmt.Errorf("key file %s is encrypted and no passphrase was provided (run 'labman login' to store it)", path)
+		}
+
+		passphrase, err = PassphrasePrompt(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("read passphrase: %w", err)
+		}
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	if err != nil {
+		return nil, "", fmt.Errorf("decrypt key file %s: %w", path, err)
+	}
+	return signer, passphrase, nil
+}
+
+// userCertFile returns the certificate to present with the key file, if any.
+func userCertFile(opts AuthOptions) string {
+	if opts.CertFile != "" {
+		return opts.CertFile
+	}
+	candidate := opts.KeyFile + "-cert.pub"
+	if _, err := os.Stat(candidate); err == nil {
+		return candidate
+	}
+	return ""
+}
+
+// loadCertSigner pairs signer with the user certificate in path, which must
+// certify signer's key and be valid now.
+func loadCertSigner(signer ssh.Signer, path string) (ssh.Signer, error) {
+	cert, err := ReadCertificate(path)
+	if err != nil {
+		return nil, err
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("certificate %s is a host certificate, not a user certificate", path)
+	}
+	if err := certValidNow(cert, time.Now()); err != nil {
+		return nil, fmt.Errorf("certificate %s %w", path, err)
+	}
+
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s does not match its key: %w", path, err)
+	}
+	return certSigner, nil
+}
+
+// ReadCertificate parses an OpenSSH certificate file such as id_ed25519-cert.pub.
+func ReadCertificate(path string) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s: %w", path, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %s public key, not a certificate", path, key.Type())
+	}
+	return cert, nil
+}
+
+// certValidNow reports why cert is not valid at now, if it is not.
+func certValidNow(cert *ssh.Certificate, now time.Time) error {
+	unix := uint64(now.Unix())
+	if unix < cert.ValidAfter {
+		return fmt.Errorf("is not valid until %s", CertValidAfter(cert).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore {
+		return fmt.Errorf("expired at %s", CertValidBefore(cert).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CertValidAfter is the start of cert's validity period.
+func CertValidAfter(cert *ssh.Certificate) time.Time {
+	return time.Unix(int64(cert.ValidAfter), 0)
+}
+
+// CertValidBefore is the end of cert's validity period, or the zero time
+// when it never expires.
+func CertValidBefore(cert *ssh.Certificate) time.Time {
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+	return time.Unix(int64(cert.ValidBefore), 0)
+}
+
+func passphraseKey(keyFile string) string {
+	return "key:" + keyFile
+}
@@ -0,0 +1,414 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestLoadKeySigner(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+
+	writeKey := func(t *testing.T, passphrase string) string {
+		t.Helper()
+
+		var block *pem.Block
+		if passphrase == "" {
+			block, err = ssh.MarshalPrivateKey(priv, "")
+		} else {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+		}
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "id_ed25519")
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("write key file: %v", err)
+		}
+		return path
+	}
+
+	stubPrompt := func(t *testing.T, prompt func(string) (string, error)) {
+		t.Helper()
+		original := PassphrasePrompt
+		PassphrasePrompt = prompt
+		t.Cleanup(func() { PassphrasePrompt = original })
+	}
+
+	t.Run("loads unencrypted key without prompting", func(t *testing.T) {
+		path := writeKey(t, "")
+		stubPrompt(t, func(string) (string, error) {
+			t.Fatalf("prompt must not run for unencrypted keys")
+			return "", nil
+		})
+
+		signer, passphrase, err := loadKeySigner(path, "")
+		if err != nil {
+			t.Fatalf("loadKeySigner: %v", err)
+		}
+		if signer == nil || passphrase != "" {
+			t.Fatalf("expected signer and empty passphrase, got %v/%q", signer, passphrase)
+		}
+	})
+
+	t.Run("prompts for passphrase of encrypted key", func(t *testing.T) {
+		path := writeKey(t, "hunter2")
+		prompted := ""
+		stubPrompt(t, func(keyFile string) (string, error) {
+			prompted = keyFile
+			return "hunter2", nil
+		})
+
+		_, passphrase, err := loadKeySigner(path, "")
+		if err != nil {
+			t.Fatalf("loadKeySigner: %v", err)
+		}
+		if prompted != path || passphrase != "hunter2" {
+			t.Fatalf("expected prompt for %s returning passphrase, got %q/%q", path, prompted, passphrase)
+		}
+	})
+
+	t.Run("uses supplied passphrase", func(t *testing.T) {
+		path := writeKey(t, "hunter2")
+		stubPrompt(t, nil)
+
+		if _, _, err := loadKeySigner(path, "hunter2"); err != nil {
+			t.Fatalf("loadKeySigner: %v", err)
+		}
+	})
+
+	t.Run("fails on encrypted key without prompt", func(t *testing.T) {
+		path := writeKey(t, "hunter2")
+		stubPrompt(t, nil)
+
+		_, _, err := loadKeySigner(path, "")
+		if err == nil || !strings.Contains(err.Error(), "encrypted") || !strings.Contains(err.Error(), "labman login") {
+			t.Fatalf("expected encrypted key error pointing at login, got %v", err)
+		}
+	})
+}
+
+func TestAuthStateMethods(t *testing.T) {
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate agent key: %v", err)
+	}
+	agentSigner, err := ssh.NewSignerFromKey(agentKey)
+	if err != nil {
+		t.Fatalf("agent signer: %v", err)
+	}
+
+	stubAgent := func(t *testing.T, keys ...ed25519.PrivateKey) {
+		t.Helper()
+
+		keyring := agent.NewKeyring()
+		for _, key := range keys {
+			if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+				t.Fatalf("add key to agent: %v", err)
+			}
+		}
+
+		original := dialAgent
+		dialAgent = func() (agent.ExtendedAgent, io.Closer, error) {
+			return keyring.(agent.ExtendedAgent), io.NopCloser(nil), nil
+		}
+		t.Cleanup(func() { dialAgent = original })
+	}
+
+	t.Run("authenticates with an in-process agent keyring", func(t *testing.T) {
+		stubAgent(t, agentKey)
+
+		state := &authState{opts: AuthOptions{Methods: []string{AuthAgent, AuthPassword}, Password: "secret"}}
+		defer state.close()
+
+		if err := testHandshake(t, state.authMethods(), agentSigner.PublicKey(), ""); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		if got := state.method(); got != AuthAgent {
+			t.Fatalf("expected %s, got %s", AuthAgent, got)
+		}
+	})
+
+	t.Run("falls back to password when agent key is rejected", func(t *testing.T) {
+		stubAgent(t, agentKey)
+
+		state := &authState{opts: AuthOptions{Methods: []string{AuthAgent, AuthPassword}, Password: "secret"}}
+		defer state.close()
+
+		if err := testHandshake(t, state.authMethods(), nil, "secret"); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		if got := state.method(); got != AuthPassword {
+			t.Fatalf("expected %s, got %s", AuthPassword, got)
+		}
+	})
+
+	t.Run("honors configured order", func(t *testing.T) {
+		stubAgent(t, agentKey)
+
+		prompted := false
+		state := &authState{opts: AuthOptions{
+			Methods:        []string{AuthPassword, AuthAgent},
+			PasswordPrompt: func() (string, error) { prompted = true; return "secret", nil },
+		}}
+		defer state.close()
+
+		if err := testHandshake(t, state.authMethods(), agentSigner.PublicKey(), "secret"); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		if !prompted || state.method() != AuthPassword {
+			t.Fatalf("expected password to be tried first, prompted=%v method=%s", prompted, state.method())
+		}
+	})
+
+	t.Run("reports empty agent", func(t *testing.T) {
+		stubAgent(t)
+
+		state := &authState{opts: AuthOptions{Methods: []string{AuthAgent}}}
+		defer state.close()
+
+		if methods := state.authMethods(); methods != nil {
+			t.Fatalf("expected no auth methods, got %d", len(methods))
+		}
+		if err := state.unavailable(); err == nil || !strings.Contains(err.Error(), "no keys") {
+			t.Fatalf("expected empty agent error, got %v", err)
+		}
+	})
+}
+
+// testHandshake runs an SSH handshake against a server on a loopback port. The server
+// accepts authorizedKey (if set) and password (if set).
+func testHandshake(t *testing.T, methods []ssh.AuthMethod, authorizedKey ssh.PublicKey, password string) error {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("host signer: %v", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorizedKey != nil && bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if password != "" && string(given) == password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn, chans, reqs, err := ssh.NewServerConn(serverConn, serverConfig)
+		if err != nil {
+			serverConn.Close()
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			for ch := range chans {
+				ch.Reject(ssh.Prohibited, "no channels")
+			}
+		}()
+		conn.Wait()
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            methods,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+func TestAuthStateMethod(t *testing.T) {
+	t.Run("key signed", func(t *testing.T) {
+		state := &authState{opts: AuthOptions{KeyFile: "id"}, used: AuthPublicKey}
+		if got := state.method(); got != AuthPublicKey {
+			t.Fatalf("expected %s, got %s", AuthPublicKey, got)
+		}
+	})
+
+	t.Run("agent signed", func(t *testing.T) {
+		state := &authState{used: AuthAgent}
+		if got := state.method(); got != AuthAgent {
+			t.Fatalf("expected %s, got %s", AuthAgent, got)
+		}
+	})
+
+	t.Run("nothing recorded defaults to password", func(t *testing.T) {
+		state := &authState{opts: AuthOptions{Password: "secret"}}
+		if got := state.method(); got != AuthPassword {
+			t.Fatalf("expected %s, got %s", AuthPassword, got)
+		}
+	})
+}
+
+func TestUserCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("key signer: %v", err)
+	}
+
+	writeKeyAndCert := func(t *testing.T, cert *ssh.Certificate) string {
+		t.Helper()
+
+		block, err := ssh.MarshalPrivateKey(priv, "")
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+		keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("write key file: %v", err)
+		}
+		if err := os.WriteFile(keyFile+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0o644); err != nil {
+			t.Fatalf("write certificate: %v", err)
+		}
+		return keyFile
+	}
+
+	t.Run("presents key_file-cert.pub alongside the key", func(t *testing.T) {
+		cert := newTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, []string{"admin"}, time.Now().Add(time.Hour))
+		keyFile := writeKeyAndCert(t, cert)
+
+		state := &authState{opts: AuthOptions{Methods: []string{AuthPublicKey}, KeyFile: keyFile}}
+		if err := testHandshake(t, state.authMethods(), cert, ""); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		if state.method() != AuthPublicKey || state.certFile != keyFile+"-cert.pub" {
+			t.Fatalf("expected certificate auth, got method %s cert %q", state.method(), state.certFile)
+		}
+	})
+
+	t.Run("uses an explicit cert_file", func(t *testing.T) {
+		keyFile := writeKeyAndCert(t, newTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, nil, time.Now().Add(time.Hour)))
+		renewed := newTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, []string{"admin"}, time.Now().Add(2*time.Hour))
+		certFile := filepath.Join(t.TempDir(), "renewed-cert.pub")
+		if err := os.WriteFile(certFile, ssh.MarshalAuthorizedKey(renewed), 0o644); err != nil {
+			t.Fatalf("write certificate: %v", err)
+		}
+
+		state := &authState{opts: AuthOptions{Methods: []string{AuthPublicKey}, KeyFile: keyFile, CertFile: certFile}}
+		if err := testHandshake(t, state.authMethods(), renewed, ""); err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		if state.certFile != certFile {
+			t.Fatalf("expected %s to be used, got %q", certFile, state.certFile)
+		}
+	})
+
+	rejected := []struct {
+		name string
+		cert func() *ssh.Certificate
+		want string
+	}{
+		{
+			name: "expired",
+			cert: func() *ssh.Certificate {
+				return newTestCertificate(t, ca, signer.PublicKey(), ssh.UserCert, nil, time.Now().Add(-time.Minute))
+			},
+			want: "expired",
+		},
+		{
+			name: "host certificate",
+			cert: func() *ssh.Certificate {
+				return newTestCertificate(t, ca, signer.PublicKey(), ssh.HostCert, nil, time.Now().Add(time.Hour))
+			},
+			want: "not a user certificate",
+		},
+		{
+			name: "certificate for another key",
+			cert: func() *ssh.Certificate {
+				return newTestCertificate(t, ca, newTestPublicKey(t), ssh.UserCert, nil, time.Now().Add(time.Hour))
+			},
+			want: "does not match",
+		},
+	}
+	for _, tt := range rejected {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			keyFile := writeKeyAndCert(t, tt.cert())
+
+			state := &authState{opts: AuthOptions{Methods: []string{AuthPublicKey}, KeyFile: keyFile}}
+			if methods := state.authMethods(); methods != nil {
+				t.Fatalf("expected no auth methods, got %d", len(methods))
+			}
+			if err := state.unavailable(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer
+}
+
+// newTestCertificate has ca certify key for principals until validBefore.
+func newTestCertificate(t *testing.T, ca ssh.Signer, key ssh.PublicKey, certType uint32, principals []string, validBefore time.Time) *ssh.Certificate {
+	t.Helper()
+
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		KeyId:           "test",
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("sign certificate: %v", err)
+	}
+	return cert
+}
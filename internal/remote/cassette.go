@@ -0,0 +1,434 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CassetteVersion is the cassette format written by Recorder. Replayer
+// refuses cassettes from a newer labman.
+const CassetteVersion = 1
+
+// ErrNotInCassette reports that a replayed workflow ran a command the
+// cassette holds no response for.
+var ErrNotInCassette = errors.New("command not in cassette")
+
+// Cassette is a transcript of the commands a workflow ran and what they
+// returned. It is stored as JSON when the file name ends in .json and as
+// YAML otherwise.
+type Cassette struct {
+	Version    int       `json:"version" yaml:"version"`
+	RecordedAt time.Time `json:"recorded_at" yaml:"recorded_at"`
+	// Interactions are in the order they ran.
+	Interactions []Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Interaction is one recorded command or upload.
+type Interaction struct {
+	// Command is the command as the workflow passed it, before any sudo
+	// wrapping, so no password ends up in the cassette.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	Sudo    bool   `json:"sudo,omitempty" yaml:"sudo,omitempty"`
+	// Stream marks commands whose output was copied to the terminal as it
+	// arrived; Output holds everything that was written.
+	Stream bool `json:"stream,omitempty" yaml:"stream,omitempty"`
+	// Upload is set instead of Command for file copies.
+	Upload *UploadRecord `json:"upload,omitempty" yaml:"upload,omitempty"`
+
+	Stdout string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+	// Output is the interleaved stdout and stderr when it differs from
+	// Stdout followed by Stderr.
+	Output   string `json:"output,omitempty" yaml:"output,omitempty"`
+	ExitCode int    `json:"exit_code" yaml:"exit_code"`
+	// Error is the message the workflow saw if the command failed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	StartedAt time.Time     `json:"started_at" yaml:"started_at"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+}
+
+// UploadRecord describes a recorded Upload.
+type UploadRecord struct {
+	LocalPath  string `json:"local_path" yaml:"local_path"`
+	RemotePath string `json:"remote_path" yaml:"remote_path"`
+	Files      int    `json:"files" yaml:"files"`
+	Bytes      int64  `json:"bytes" yaml:"bytes"`
+}
+
+// combined is what RunContext returned for the interaction.
+func (in Interaction) combined() string {
+	if in.Stream || in.Output != "" {
+		return in.Output
+	}
+	return in.Stdout + in.Stderr
+}
+
+// result rebuilds the RunResult the workflow saw, or nil if the command
+// never started.
+func (in Interaction) result() *RunResult {
+	if in.Error != "" && in.ExitCode == 0 {
+		return nil
+	}
+	return &RunResult{
+		Command:  in.Command,
+		Stdout:   in.Stdout,
+		Stderr:   in.Stderr,
+		Output:   in.combined(),
+		ExitCode: in.ExitCode,
+		Duration: in.Duration,
+	}
+}
+
+// err rebuilds the error the workflow saw. Its message is the recorded one,
+// and a failed command still unwraps to a *CommandError.
+func (in Interaction) err(result *RunResult) error {
+	if in.Error == "" {
+		return nil
+	}
+	if result == nil {
+		return errors.New(in.Error)
+	}
+	return &replayedError{msg: in.Error, cause: &CommandError{Result: result, Err: fmt.Errorf("exit status %d", in.ExitCode)}}
+}
+
+type replayedError struct {
+	msg   string
+	cause *CommandError
+}
+
+func (e *replayedError) Error() string { return e.msg }
+func (e *replayedError) Unwrap() error { return e.cause }
+
+// LoadCassette reads a cassette written by Recorder.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if isJSONCassette(path) {
+		err = json.Unmarshal(data, &cassette)
+	} else {
+		err = yaml.Unmarshal(data, &cassette)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	if cassette.Version < 1 || cassette.Version > CassetteVersion {
+		return nil, fmt.Errorf("cassette %s has version %d; this labman reads version %d", path, cassette.Version, CassetteVersion)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to path, as JSON for a .json name and as YAML
+// otherwise. Recorded output may hold secrets, so the file is private.
+func (c *Cassette) Save(path string) error {
+	var data []byte
+	var err error
+	if isJSONCassette(path) {
+		data, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		data, err = yaml.Marshal(c)
+	}
+	if err != nil {
+		return fmt.Errorf("encode cassette: %w", err)
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func isJSONCassette(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Recorder captures every command run through the executors it wraps. The
+// cassette is rewritten after each command, so the transcript of a workflow
+// that fails half way is still complete.
+type Recorder struct {
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+	err      error
+}
+
+// NewRecorder starts an empty cassette at path, failing early if it cannot
+// be written.
+func NewRecorder(path string) (*Recorder, error) {
+	r := &Recorder{
+		path:     path,
+		cassette: Cassette{Version: CassetteVersion, RecordedAt: time.Now().UTC(), Interactions: []Interaction{}},
+	}
+	if err := r.cassette.Save(path); err != nil {
+		return nil, fmt.Errorf("write cassette: %w", err)
+	}
+	return r, nil
+}
+
+// Wrap returns an executor that runs commands with inner and records them.
+func (r *Recorder) Wrap(inner Executor) Executor {
+	return &recordingExecutor{recorder: r, inner: inner}
+}
+
+// Len reports how many interactions have been recorded.
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cassette.Interactions)
+}
+
+// Err returns the first error writing the cassette, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(in Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	if err := r.cassette.Save(r.path); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+type recordingExecutor struct {
+	recorder *Recorder
+	inner    Executor
+}
+
+func (e *recordingExecutor) exec(ctx context.Context, cmd string, sudo bool, run func(context.Context, string) (*RunResult, error)) (*RunResult, error) {
+	start := time.Now()
+	result, err := run(ctx, cmd)
+
+	in := Interaction{Command: cmd, Sudo: sudo, StartedAt: start.UTC(), Duration: time.Since(start)}
+	if result != nil {
+		in.Stdout, in.Stderr, in.ExitCode = result.Stdout, result.Stderr, result.ExitCode
+		if result.Output != result.Stdout+result.Stderr {
+			in.Output = result.Output
+		}
+	}
+	if err != nil {
+		in.Error = err.Error()
+	}
+	e.recorder.record(in)
+	return result, err
+}
+
+func (e *recordingExecutor) Exec(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, false, e.inner.Exec)
+}
+
+func (e *recordingExecutor) ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, false, e.inner.ExecIdempotent)
+}
+
+func (e *recordingExecutor) ExecSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, true, e.inner.ExecSudo)
+}
+
+func (e *recordingExecutor) RunContext(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.Exec(ctx, cmd))
+}
+
+func (e *recordingExecutor) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.ExecIdempotent(ctx, cmd))
+}
+
+func (e *recordingExecutor) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.ExecSudo(ctx, cmd))
+}
+
+func (e *recordingExecutor) stream(ctx context.Context, cmd string, sudo bool, w io.Writer, run func(context.Context, string, io.Writer) error) error {
+	var output syncBuffer
+	start := time.Now()
+	err := run(ctx, cmd, io.MultiWriter(w, &output))
+
+	in := Interaction{Command: cmd, Sudo: sudo, Stream: true, Output: output.String(), StartedAt: start.UTC(), Duration: time.Since(start)}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		in.Stderr, in.ExitCode = cmdErr.Result.Stderr, cmdErr.Result.ExitCode
+	}
+	if err != nil {
+		in.Error = err.Error()
+	}
+	e.recorder.record(in)
+	return err
+}
+
+func (e *recordingExecutor) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	return e.stream(ctx, cmd, false, w, e.inner.RunStreamContext)
+}
+
+func (e *recordingExecutor) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	return e.stream(ctx, cmd, true, w, e.inner.RunStreamSudo)
+}
+
+func (e *recordingExecutor) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error) {
+	start := time.Now()
+	stats, err := e.inner.Upload(ctx, localPath, remotePath, opts)
+
+	record := &UploadRecord{LocalPath: localPath, RemotePath: remotePath}
+	if stats != nil {
+		record.Files, record.Bytes = stats.Files, stats.Bytes
+	}
+	in := Interaction{Upload: record, StartedAt: start.UTC(), Duration: time.Since(start)}
+	if err != nil {
+		in.Error = err.Error()
+	}
+	e.recorder.record(in)
+	return stats, err
+}
+
+func (e *recordingExecutor) Close() error {
+	return e.inner.Close()
+}
+
+// Replayer is an Executor that answers from a cassette instead of a host.
+// A command recorded several times is answered in recorded order, and with
+// its last response once those run out; one that was never recorded fails
+// with ErrNotInCassette.
+type Replayer struct {
+	path string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+var _ Executor = (*Replayer)(nil)
+
+// NewReplayer loads the cassette at path.
+func NewReplayer(path string) (*Replayer, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{path: path, cassette: cassette, used: make([]bool, len(cassette.Interactions))}, nil
+}
+
+// next finds the response for the first interaction that matches.
+func (r *Replayer) next(matches func(Interaction) bool, describe string) (Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last := -1
+	for i, in := range r.cassette.Interactions {
+		if !matches(in) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return in, nil
+		}
+		last = i
+	}
+	if last >= 0 {
+		return r.cassette.Interactions[last], nil
+	}
+	return Interaction{}, fmt.Errorf("replay %s: %w: %s", r.path, ErrNotInCassette, describe)
+}
+
+func (r *Replayer) command(ctx context.Context, cmd string, sudo bool) (Interaction, error) {
+	if err := ctx.Err(); err != nil {
+		return Interaction{}, context.Cause(ctx)
+	}
+	describe := fmt.Sprintf("%q", cmd)
+	if sudo {
+		describe += " (sudo)"
+	}
+	return r.next(func(in Interaction) bool {
+		return in.Upload == nil && in.Command == cmd && in.Sudo == sudo
+	}, describe)
+}
+
+func (r *Replayer) exec(ctx context.Context, cmd string, sudo bool) (*RunResult, error) {
+	in, err := r.command(ctx, cmd, sudo)
+	if err != nil {
+		return nil, err
+	}
+	result := in.result()
+	return result, in.err(result)
+}
+
+// Exec answers cmd with its recorded result.
+func (r *Replayer) Exec(ctx context.Context, cmd string) (*RunResult, error) {
+	return r.exec(ctx, cmd, false)
+}
+
+// ExecIdempotent is Exec.
+func (r *Replayer) ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error) {
+	return r.exec(ctx, cmd, false)
+}
+
+// ExecSudo answers cmd with the result it had when recorded as root.
+func (r *Replayer) ExecSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	return r.exec(ctx, cmd, true)
+}
+
+// RunContext answers cmd with its recorded combined output.
+func (r *Replayer) RunContext(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(r.Exec(ctx, cmd))
+}
+
+// RunIdempotent is RunContext.
+func (r *Replayer) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(r.ExecIdempotent(ctx, cmd))
+}
+
+// RunSudo is RunContext for a command recorded as root.
+func (r *Replayer) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(r.ExecSudo(ctx, cmd))
+}
+
+func (r *Replayer) stream(ctx context.Context, cmd string, sudo bool, w io.Writer) error {
+	in, err := r.command(ctx, cmd, sudo)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, in.combined()); err != nil {
+		return err
+	}
+	return in.err(in.result())
+}
+
+// RunStreamContext writes cmd's recorded output to w.
+func (r *Replayer) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	return r.stream(ctx, cmd, false, w)
+}
+
+// RunStreamSudo is RunStreamContext for a command recorded as root.
+func (r *Replayer) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	return r.stream(ctx, cmd, true, w)
+}
+
+// Upload reports the recorded copy to remotePath without touching any file.
+func (r *Replayer) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error) {
+	in, err := r.next(func(in Interaction) bool {
+		return in.Upload != nil && in.Upload.RemotePath == remotePath
+	}, "upload to "+remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if in.Error != "" {
+		return nil, errors.New(in.Error)
+	}
+	return &TransferStats{Files: in.Upload.Files, Bytes: in.Upload.Bytes}, nil
+}
+
+// Close does nothing.
+func (r *Replayer) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("records the local executor, which runs commands with sh")
+	}
+	ctx := context.Background()
+
+	for _, name := range []string{"node.yaml", "node.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			recorder, err := NewRecorder(path)
+			if err != nil {
+				t.Fatalf("NewRecorder: %v", err)
+			}
+			recorded := recorder.Wrap(NewLocalExecutor(SudoNone))
+
+			wantOutput, _ := recorded.RunContext(ctx, "echo first; echo warning >&2")
+			_, wantErr := recorded.RunSudo(ctx, "echo broken >&2; exit 3")
+			var wantStream bytes.Buffer
+			if err := recorded.RunStreamContext(ctx, "printf 'line 1\\nline 2'", &wantStream); err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+			recorded.RunContext(ctx, "echo again")
+			if recorder.Err() != nil || recorder.Len() != 4 {
+				t.Fatalf("recorded %d interactions, err %v", recorder.Len(), recorder.Err())
+			}
+
+			replayer, err := NewReplayer(path)
+			if err != nil {
+				t.Fatalf("NewReplayer: %v", err)
+			}
+
+			if output, err := replayer.RunContext(ctx, "echo first; echo warning >&2"); err != nil || output != wantOutput {
+				t.Errorf("RunContext = %q, %v; recorded %q", output, err, wantOutput)
+			}
+
+			result, err := replayer.ExecSudo(ctx, "echo broken >&2; exit 3")
+			var cmdErr *CommandError
+			if !errors.As(err, &cmdErr) || result.ExitCode != 3 || result.Stderr != "broken\n" {
+				t.Errorf("ExecSudo = %+v, %v", result, err)
+			}
+			if err == nil || err.Error() != wantErr.Error() {
+				t.Errorf("error %q, recorded %q", err, wantErr)
+			}
+
+			var stream bytes.Buffer
+			if err := replayer.RunStreamContext(ctx, "printf 'line 1\\nline 2'", &stream); err != nil || stream.String() != wantStream.String() {
+				t.Errorf("stream = %q, %v; recorded %q", stream.String(), err, wantStream.String())
+			}
+
+			for i := 0; i < 2; i++ {
+				if output, err := replayer.RunContext(ctx, "echo again"); err != nil || output != "again\n" {
+					t.Errorf("repeat %d = %q, %v", i, output, err)
+				}
+			}
+
+			_, err = replayer.RunContext(ctx, "echo broken >&2; exit 3")
+			if !errors.Is(err, ErrNotInCassette) || !strings.Contains(err.Error(), path) {
+				t.Errorf("expected a command recorded only under sudo to be missing, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadCassette(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "ok.yaml", contents: "version: 1\ninteractions:\n- command: uptime\n  stdout: up\n  exit_code: 0\n  duration: 1.5s\n"},
+		{name: "future.yaml", contents: "version: 2\ninteractions: []\n", wantErr: "version 2"},
+		{name: "unversioned.json", contents: `{"interactions": []}`, wantErr: "version 0"},
+		{name: "broken.json", contents: `{"version": 1,`, wantErr: "parse cassette"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			cassette, err := LoadCassette(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCassette: %v", err)
+			}
+			if in := cassette.Interactions[0]; in.Command != "uptime" || in.Stdout != "up" || in.Duration.Seconds() != 1.5 {
+				t.Fatalf("unexpected interaction %+v", in)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package remote
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Credential store backends accepted by NewCredentialStore.
+const (
+	// CredentialStoreKeyring uses the OS keyring (default).
+	CredentialStoreKeyring = "keyring"
+	// CredentialStoreFile uses a passphrase-encrypted file.
+	CredentialStoreFile = "file"
+	// CredentialStoreAuto uses the keyring and switches to the encrypted
+	// file when the keyring cannot be reached, e.g. without a Secret
+	// Service on a headless box.
+	CredentialStoreAuto = "auto"
+)
+
+// CredentialPassphraseEnv supplies the encrypted file's passphrase without a
+// prompt, e.g. on CI runners and for the daemon.
+const CredentialPassphraseEnv = "LABMAN_CREDENTIAL_PASSPHRASE"
+
+// ErrCredentialNotFound is returned by Get when no secret is stored under
+// the key. It is keyring.ErrNotFound, so every backend reports it the same.
+var ErrCredentialNotFound = keyring.ErrNotFound
+
+// ErrCredentialPassphrase is returned when the credential file cannot be
+// decrypted with the given passphrase.
+var ErrCredentialPassphrase = errors.New("wrong passphrase for the credential file")
+
+// CredentialPassphrasePrompt is consulted for the credential file's
+// passphrase when CredentialPassphraseEnv is not set. create is true when
+// the file does not exist yet, so the prompt can ask for confirmation.
+var CredentialPassphrasePrompt func(path string, create bool) (string, error)
+
+// CredentialStore keeps the secrets cached sessions are re-dialed with.
+type CredentialStore interface {
+	Set(service, key, secret string) error
+	// Get returns ErrCredentialNotFound when nothing is stored under key.
+	Get(service, key string) (string, error)
+	Delete(service, key string) error
+}
+
+// credentials backs keyringSet, keyringGet and keyringDelete.
+var (
+	credentialsMu sync.Mutex
+	credentials   CredentialStore = KeyringStore{}
+)
+
+// SetCredentialStore selects where session secrets are kept from now on.
+func SetCredentialStore(store CredentialStore) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	credentials = store
+}
+
+func credentialStore() CredentialStore {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	return credentials
+}
+
+// NewCredentialStore returns the backend named kind. file is the encrypted
+// file to use for the file and auto backends; empty means
+// DefaultCredentialFile.
+func NewCredentialStore(kind, file string) (CredentialStore, error) {
+	if kind == "" {
+		kind = CredentialStoreKeyring
+	}
+	if kind == CredentialStoreKeyring {
+		return KeyringStore{}, nil
+	}
+
+	if file == "" {
+		path, err := DefaultCredentialFile()
+		if err != nil {
+			return nil, err
+		}
+		file = path
+	}
+	fileStore := NewFileStore(file)
+
+	switch kind {
+	case CredentialStoreFile:
+		return fileStore, nil
+	case CredentialStoreAuto:
+		return &fallbackStore{primary: KeyringStore{}, fallback: fileStore}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q (use keyring, file, or auto)", kind)
+	}
+}
+
+// DefaultCredentialFile is ~/.labman/credentials.enc.
+func DefaultCredentialFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".labman", "credentials.enc"), nil
+}
+
+// KeyringStore keeps secrets in the OS keyring: the macOS Keychain, the
+// Windows Credential Manager or the Secret Service on Linux.
+type KeyringStore struct{}
+
+func (KeyringStore) Set(service, key, secret string) error {
+	return keyring.Set(service, key, secret)
+}
+
+func (KeyringStore) Get(service, key string) (string, error) {
+	return keyring.Get(service, key)
+}
+
+func (KeyringStore) Delete(service, key string) error {
+	return keyring.Delete(service, key)
+}
+
+// FileStore keeps secrets in one file encrypted with AES-256-GCM under a
+// key derived from a passphrase with scrypt. The passphrase comes from
+// CredentialPassphraseEnv or CredentialPassphrasePrompt and is asked for at
+// most once per process.
+type FileStore struct {
+	path string
+
+	mu         sync.Mutex
+	passphrase string
+}
+
+// NewFileStore returns a store for the encrypted file at path, which is
+// created on the first Set.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Path is the encrypted file the store reads and writes.
+func (f *FileStore) Path() string {
+	return f.path
+}
+
+func (f *FileStore) Set(service, key, secret string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	secrets, err := f.load(true)
+	if err != nil {
+		return err
+	}
+	secrets[credentialEntry(service, key)] = secret
+	return f.save(secrets)
+}
+
+func (f *FileStore) Get(service, key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := os.Stat(f.path); errors.Is(err, os.ErrNotExist) {
+		return "", ErrCredentialNotFound
+	}
+	secrets, err := f.load(false)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[credentialEntry(service, key)]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+	return secret, nil
+}
+
+func (f *FileStore) Delete(service, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := os.Stat(f.path); errors.Is(err, os.ErrNotExist) {
+		return ErrCredentialNotFound
+	}
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	secrets, err := f.load(false)
+	if err != nil {
+		return err
+	}
+	entry := credentialEntry(service, key)
+	if _, ok := secrets[entry]; !ok {
+		return ErrCredentialNotFound
+	}
+	delete(secrets, entry)
+	return f.save(secrets)
+}
+
+// lock holds the sibling lock file from load to save, so that two labman
+// processes writing at once do not each save a copy missing the other's
+// secret. Get needs no lock because save replaces the file atomically.
+func (f *FileStore) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return nil, fmt.Errorf("create credential directory: %w", err)
+	}
+	file, err := os.OpenFile(f.path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open credential lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock credential file: %w", err)
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// credentialFile is the on-disk format. Salt and nonce are fresh on every
+// write.
+type credentialFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// scrypt parameters for new files, as recommended for interactive logins.
+const (
+	credentialScryptN = 1 << 15
+	credentialScryptR = 8
+	credentialScryptP = 1
+)
+
+// load decrypts the file. A missing file is an empty store when create is
+// set, so the first Set asks for a new passphrase.
+func (f *FileStore) load(create bool) (map[string]string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		if _, err := f.passphraseFor(true); err != nil {
+			return nil, err
+		}
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credential file: %w", err)
+	}
+
+	var file credentialFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse credential file %s: %w", f.path, err)
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("credential file %s has unsupported format %d/%s", f.path, file.Version, file.KDF)
+	}
+
+	passphrase, err := f.passphraseFor(false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := credentialCipher(passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		f.passphrase = ""
+		return nil, fmt.Errorf("%w %s", ErrCredentialPassphrase, f.path)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("decode credential file: %w", err)
+	}
+	return secrets, nil
+}
+
+// save encrypts secrets and replaces the file, which only the user can read.
+func (f *FileStore) save(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("encode credentials: %w", err)
+	}
+
+	file := credentialFile{Version: 1, KDF: "scrypt", N: credentialScryptN, R: credentialScryptR, P: credentialScryptP,
+		Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+	aead, err := credentialCipher(f.passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode credential file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return fmt.Errorf("create credential directory: %w", err)
+	}
+	// CreateTemp makes the file 0600 and gives each writer its own name.
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write credential file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write credential file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("replace credential file: %w", err)
+	}
+	return nil
+}
+
+// passphraseFor returns the cached passphrase, or reads it from the
+// environment or the prompt.
+func (f *FileStore) passphraseFor(create bool) (string, error) {
+	if f.passphrase != "" {
+		return f.passphrase, nil
+	}
+
+	passphrase := os.Getenv(CredentialPassphraseEnv)
+	if passphrase == "" {
+		if CredentialPassphrasePrompt == nil {
+			return "", fmt.Errorf("the credential file %s needs a passphrase; set %s", f.path, CredentialPassphraseEnv)
+		}
+		var err error
+		passphrase, err = CredentialPassphrasePrompt(f.path, create)
+		if err != nil {
+			return "", err
+		}
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the credential file passphrase must not be empty")
+	}
+	f.passphrase = passphrase
+	return passphrase, nil
+}
+
+func credentialCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive credential key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("credential cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func credentialEntry(service, key string) string {
+	return service + "/" + key
+}
+
+// fallbackStore uses primary until it fails with anything other than a
+// missing secret, then uses fallback for the rest of the process. Secrets
+// missing from a working primary are still looked up in fallback, in case
+// they were saved while the primary was down.
+type fallbackStore struct {
+	primary  CredentialStore
+	fallback *FileStore
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (s *fallbackStore) Set(service, key, secret string) error {
+	if s.usePrimary() {
+		err := s.primary.Set(service, key, secret)
+		if !s.failed(err) {
+			return err
+		}
+	}
+	return s.fallback.Set(service, key, secret)
+}
+
+func (s *fallbackStore) Get(service, key string) (string, error) {
+	if s.usePrimary() {
+		secret, err := s.primary.Get(service, key)
+		if err == nil {
+			return secret, nil
+		}
+		s.failed(err)
+	}
+	return s.fallback.Get(service, key)
+}
+
+func (s *fallbackStore) Delete(service, key string) error {
+	var primaryErr error = ErrCredentialNotFound
+	if s.usePrimary() {
+		primaryErr = s.primary.Delete(service, key)
+		if s.failed(primaryErr) {
+			primaryErr = ErrCredentialNotFound
+		}
+	}
+	fallbackErr := s.fallback.Delete(service, key)
+	if primaryErr == nil || fallbackErr == nil {
+		return nil
+	}
+	if !errors.Is(primaryErr, ErrCredentialNotFound) {
+		return primaryErr
+	}
+	return fallbackErr
+}
+
+func (s *fallbackStore) usePrimary() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.down
+}
+
+// failed reports whether err means the primary is unreachable, and stops
+// using it if so.
+func (s *fallbackStore) failed(err error) bool {
+	if err == nil || errors.Is(err, ErrCredentialNotFound) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = true
+	return true
+}
@@ -0,0 +1,282 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryStore is a CredentialStore that fails every call with err when set,
+// like a keyring without a Secret Service.
+type memoryStore struct {
+	secrets map[string]string
+	err     error
+	calls   int
+}
+
+func (m *memoryStore) Set(service, key, secret string) error {
+	m.calls++
+	if m.err != nil {
+		return m.err
+	}
+	m.secrets[credentialEntry(service, key)] = secret
+	return nil
+}
+
+func (m *memoryStore) Get(service, key string) (string, error) {
+	m.calls++
+	if m.err != nil {
+		return "", m.err
+	}
+	secret, ok := m.secrets[credentialEntry(service, key)]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+	return secret, nil
+}
+
+func (m *memoryStore) Delete(service, key string) error {
+	m.calls++
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.secrets, credentialEntry(service, key))
+	return nil
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	t.Setenv(CredentialPassphraseEnv, "correct horse")
+
+	store := NewFileStore(path)
+	if _, err := store.Get(keyringService, "admin@nas"); !errors.Is(err, ErrCredentialNotFound) {
+		t.Fatalf("expected ErrCredentialNotFound before the file exists, got %v", err)
+	}
+	if err := store.Set(keyringService, "admin@nas", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set(keyringService, "sudo:admin@nas", "s3cret"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	t.Run("file is private and encrypted", func(t *testing.T) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("expected mode 0600, got %o", perm)
+		}
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "admin@nas") {
+			t.Fatalf("credential file contains plaintext: %s", data)
+		}
+	})
+
+	t.Run("a new store reads the secrets back", func(t *testing.T) {
+		secret, err := NewFileStore(path).Get(keyringService, "admin@nas")
+		if err != nil || secret != "hunter2" {
+			t.Fatalf("Get = %q, %v", secret, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(keyringService, "sudo:admin@nas"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Get(keyringService, "sudo:admin@nas"); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected ErrCredentialNotFound after delete, got %v", err)
+		}
+		if err := store.Delete(keyringService, "sudo:admin@nas"); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected ErrCredentialNotFound deleting twice, got %v", err)
+		}
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		t.Setenv(CredentialPassphraseEnv, "battery staple")
+		if _, err := NewFileStore(path).Get(keyringService, "admin@nas"); !errors.Is(err, ErrCredentialPassphrase) {
+			t.Fatalf("expected ErrCredentialPassphrase, got %v", err)
+		}
+	})
+}
+
+func TestFileStoreConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	t.Setenv(CredentialPassphraseEnv, "correct horse")
+
+	// Each writer has its own store, as separate labman processes would.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- NewFileStore(path).Set(keyringService, fmt.Sprintf("admin@nas%d", i), "hunter2")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	store := NewFileStore(path)
+	for i := range 4 {
+		if _, err := store.Get(keyringService, fmt.Sprintf("admin@nas%d", i)); err != nil {
+			t.Fatalf("admin@nas%d was lost: %v", i, err)
+		}
+	}
+	leftovers, _ := filepath.Glob(path + ".*.tmp")
+	if len(leftovers) > 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestFileStorePrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	t.Setenv(CredentialPassphraseEnv, "")
+
+	var prompts []bool
+	original := CredentialPassphrasePrompt
+	CredentialPassphrasePrompt = func(file string, create bool) (string, error) {
+		if file != path {
+			t.Errorf("prompted for %s, want %s", file, path)
+		}
+		prompts = append(prompts, create)
+		return "prompted", nil
+	}
+	t.Cleanup(func() { CredentialPassphrasePrompt = original })
+
+	store := NewFileStore(path)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := store.Set(keyringService, key, "secret-"+key); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if len(prompts) != 1 || !prompts[0] {
+		t.Fatalf("expected one prompt to create the file, got %v", prompts)
+	}
+
+	if secret, err := NewFileStore(path).Get(keyringService, "b"); err != nil || secret != "secret-b" {
+		t.Fatalf("Get = %q, %v", secret, err)
+	}
+	if len(prompts) != 2 || prompts[1] {
+		t.Fatalf("expected an unlock prompt for the existing file, got %v", prompts)
+	}
+
+	CredentialPassphrasePrompt = nil
+	if _, err := NewFileStore(path).Get(keyringService, "b"); err == nil || !strings.Contains(err.Error(), CredentialPassphraseEnv) {
+		t.Fatalf("expected an error naming %s without a prompt, got %v", CredentialPassphraseEnv, err)
+	}
+}
+
+func TestFallbackStore(t *testing.T) {
+	t.Setenv(CredentialPassphraseEnv, "correct horse")
+
+	t.Run("falls back when the keyring is unreachable", func(t *testing.T) {
+		primary := &memoryStore{secrets: map[string]string{}, err: errors.New("The name org.freedesktop.secrets was not provided")}
+		store := &fallbackStore{primary: primary, fallback: NewFileStore(filepath.Join(t.TempDir(), "credentials.enc"))}
+
+		if err := store.Set(keyringService, "admin@nas", "hunter2"); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if secret, err := store.Get(keyringService, "admin@nas"); err != nil || secret != "hunter2" {
+			t.Fatalf("Get = %q, %v", secret, err)
+		}
+		if err := store.Delete(keyringService, "admin@nas"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if primary.calls != 1 {
+			t.Fatalf("expected the keyring to be tried once, got %d calls", primary.calls)
+		}
+	})
+
+	t.Run("uses the keyring when it works", func(t *testing.T) {
+		primary := &memoryStore{secrets: map[string]string{}}
+		fallback := NewFileStore(filepath.Join(t.TempDir(), "credentials.enc"))
+		store := &fallbackStore{primary: primary, fallback: fallback}
+
+		if err := store.Set(keyringService, "admin@nas", "hunter2"); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if _, err := os.Stat(fallback.Path()); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected no credential file, got %v", err)
+		}
+		if primary.secrets[credentialEntry(keyringService, "admin@nas")] != "hunter2" {
+			t.Fatalf("expected the secret in the keyring")
+		}
+	})
+
+	t.Run("finds secrets saved while the keyring was down", func(t *testing.T) {
+		fallback := NewFileStore(filepath.Join(t.TempDir(), "credentials.enc"))
+		if err := fallback.Set(keyringService, "admin@nas", "hunter2"); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		store := &fallbackStore{primary: &memoryStore{secrets: map[string]string{}}, fallback: fallback}
+
+		if secret, err := store.Get(keyringService, "admin@nas"); err != nil || secret != "hunter2" {
+			t.Fatalf("Get = %q, %v", secret, err)
+		}
+		if _, err := store.Get(keyringService, "root@nas"); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected ErrCredentialNotFound, got %v", err)
+		}
+	})
+}
+
+func TestNewCredentialStore(t *testing.T) {
+	setTempHome(t)
+
+	tests := []struct {
+		kind    string
+		want    string
+		wantErr bool
+	}{
+		{kind: "", want: "remote.KeyringStore"},
+		{kind: CredentialStoreKeyring, want: "remote.KeyringStore"},
+		{kind: CredentialStoreFile, want: "*remote.FileStore"},
+		{kind: CredentialStoreAuto, want: "*remote.fallbackStore"},
+		{kind: "vault", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			store, err := NewCredentialStore(tt.kind, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCredentialStore(%q) error = %v, wantErr %v", tt.kind, err, tt.wantErr)
+			}
+			if got := fmt.Sprintf("%T", store); !tt.wantErr && got != tt.want {
+				t.Fatalf("NewCredentialStore(%q) = %s, want %s", tt.kind, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("session secrets go to the selected store", func(t *testing.T) {
+		t.Setenv(CredentialPassphraseEnv, "correct horse")
+		store, err := NewCredentialStore(CredentialStoreFile, "")
+		if err != nil {
+			t.Fatalf("NewCredentialStore: %v", err)
+		}
+		SetCredentialStore(store)
+		t.Cleanup(func() { SetCredentialStore(KeyringStore{}) })
+
+		session := &SSHSession{Name: "nas", Host: "nas.lan", User: "admin", Password: "hunter2"}
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("SaveSession: %v", err)
+		}
+		secret, err := store.Get(keyringService, credentialsKey("nas.lan", 0, "admin"))
+		if err != nil || secret != "hunter2" {
+			t.Fatalf("expected the password in the file store, got %q, %v", secret, err)
+		}
+		if err := DeleteSession("nas"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := store.Get(keyringService, credentialsKey("nas.lan", 0, "admin")); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected the password removed, got %v", err)
+		}
+	})
+}
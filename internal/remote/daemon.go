@@ -0,0 +1,507 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDaemonIdleTimeout is how long the daemon waits for a request before
+// exiting.
+const DefaultDaemonIdleTimeout = 15 * time.Minute
+
+// ErrDaemonNotRunning is returned when no daemon answers on the socket.
+var ErrDaemonNotRunning = errors.New("labman daemon is not running")
+
+// errSessionDial marks a daemon that could not dial a cached session, e.g.
+// because it cannot prompt for an unknown host key or a passphrase.
+// LoadSession then dials the host itself.
+var errSessionDial = errors.New("could not connect")
+
+// DaemonOptions configures ServeDaemon.
+type DaemonOptions struct {
+	// Socket defaults to DaemonSocketPath.
+	Socket string
+	// IdleTimeout stops the daemon after this long without a request. Zero
+	// means DefaultDaemonIdleTimeout.
+	IdleTimeout time.Duration
+	// Configure is applied to every session the daemon dials, e.g. to set a
+	// reconnect policy.
+	Configure func(*SSHSession)
+	// Logf reports connections and errors; nil discards them.
+	Logf func(format string, args ...any)
+}
+
+// DaemonStatus describes a running daemon.
+type DaemonStatus struct {
+	PID         int
+	Socket      string
+	Started     time.Time
+	LastRequest time.Time
+	IdleTimeout time.Duration
+	// Sessions names the cached sessions the daemon holds connections for.
+	Sessions []string
+}
+
+// DaemonSocketPath is where the daemon listens: ~/.labman/daemon.sock.
+func DaemonSocketPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".labman", "daemon.sock"), nil
+}
+
+// daemonRequest is sent by a client; each connection carries one request.
+type daemonRequest struct {
+	Op      string        `json:"op"`
+	Session string        `json:"session,omitempty"`
+	Command string        `json:"command,omitempty"`
+	Sudo    bool          `json:"sudo,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// daemonResponse answers a request. A stream sends Output frames first and
+// every request ends with a frame that has Done set.
+type daemonResponse struct {
+	Output  string            `json:"output,omitempty"`
+	Done    bool              `json:"done,omitempty"`
+	Session *SSHSessionConfig `json:"session,omitempty"`
+	Result  *RunResult        `json:"result,omitempty"`
+	Status  *DaemonStatus     `json:"status,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	// Cause is a failed command's error without the stderr tail that
+	// CommandError adds.
+	Cause string `json:"cause,omitempty"`
+	// Kinds names the sentinel errors Error wraps, see daemonErrorKinds.
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+const (
+	daemonOpOpen   = "open"
+	daemonOpPing   = "ping"
+	daemonOpExec   = "exec"
+	daemonOpStream = "stream"
+	daemonOpStatus = "status"
+	daemonOpStop   = "stop"
+)
+
+// daemonErrorKinds lets errors.Is keep working for errors that crossed the
+// socket.
+var daemonErrorKinds = map[string]error{
+	"connection_lost":        ErrConnectionLost,
+	"sudo_password":          ErrSudoPassword,
+	"sudo_password_required": ErrSudoPasswordRequired,
+	"max_ttl":                ErrSessionMaxTTL,
+	"no_active_session":      ErrNoActiveSession,
+	"session_dial":           errSessionDial,
+}
+
+// ServeDaemon holds authenticated connections for cached sessions and runs
+// commands for other labman processes over a unix socket that only the
+// current user can open. Sessions are dialed on first use and re-dialed
+// when their connection drops or the session is logged in again; expired
+// and dropped sessions are closed. ServeDaemon returns when ctx is
+// cancelled, a stop request arrives or IdleTimeout passes without requests.
+func ServeDaemon(ctx context.Context, opts DaemonOptions) error {
+	socket := opts.Socket
+	if socket == "" {
+		path, err := DaemonSocketPath()
+		if err != nil {
+			return err
+		}
+		socket = path
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultDaemonIdleTimeout
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...any) {}
+	}
+
+	listener, err := listenDaemonSocket(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := &daemon{
+		opts:     opts,
+		ctx:      ctx,
+		stop:     cancel,
+		sessions: map[string]*daemonSession{},
+		dialing:  map[string]*daemonDial{},
+		status: DaemonStatus{
+			PID:         os.Getpid(),
+			Socket:      socket,
+			Started:     time.Now(),
+			LastRequest: time.Now(),
+			IdleTimeout: opts.IdleTimeout,
+		},
+	}
+	defer d.closeAll()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go d.watchIdle()
+
+	opts.Logf("listening on %s (idle timeout %s)", socket, opts.IdleTimeout)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				d.wg.Wait()
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.handle(conn)
+		}()
+	}
+}
+
+// listenDaemonSocket creates the socket with 0600 permissions, replacing a
+// stale one left by a daemon that did not exit cleanly.
+func listenDaemonSocket(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, fmt.Errorf("create socket directory: %w", err)
+	}
+	if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", socket, err)
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+type daemon struct {
+	opts DaemonOptions
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[string]*daemonSession
+	dialing  map[string]*daemonDial
+	active   int
+	status   DaemonStatus
+}
+
+// daemonSession is a connection held for one cached session. loginAt tells
+// a new login of the same name apart.
+type daemonSession struct {
+	session *SSHSession
+	loginAt time.Time
+}
+
+// daemonDial is a dial in progress. Requests for the same session wait for
+// done and share its result instead of dialing again.
+type daemonDial struct {
+	done    chan struct{}
+	session *SSHSession
+	err     error
+}
+
+// watchIdle stops the daemon once no request has arrived for IdleTimeout,
+// and closes sessions that have expired or been dropped in the meantime.
+func (d *daemon) watchIdle() {
+	interval := max(d.opts.IdleTimeout/4, 10*time.Millisecond)
+	ticker := time.NewTicker(min(interval, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.prune()
+		d.mu.Lock()
+		idle := d.active == 0 && time.Since(d.status.LastRequest) >= d.opts.IdleTimeout
+		d.mu.Unlock()
+		if idle {
+			d.opts.Logf("idle for %s, exiting", d.opts.IdleTimeout)
+			d.stop()
+			return
+		}
+	}
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+
+	d.mu.Lock()
+	d.active++
+	d.status.LastRequest = time.Now()
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.active--
+		d.status.LastRequest = time.Now()
+		d.mu.Unlock()
+	}()
+
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		d.opts.Logf("bad request: %v", err)
+		return
+	}
+
+	// The client closes its end to cancel, which also interrupts the
+	// remote command.
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	out := &daemonWriter{enc: json.NewEncoder(conn)}
+	out.send(d.serve(ctx, req, out))
+}
+
+// serve runs one request and returns its final frame.
+func (d *daemon) serve(ctx context.Context, req daemonRequest, out *daemonWriter) daemonResponse {
+	switch req.Op {
+	case daemonOpStatus:
+		return daemonResponse{Status: d.snapshot()}
+	case daemonOpStop:
+		d.opts.Logf("stop requested")
+		d.stop()
+		return daemonResponse{}
+	}
+
+	session, err := d.session(ctx, req.Session)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	switch req.Op {
+	case daemonOpOpen:
+		meta, err := SessionMetadata(session.Name)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return daemonResponse{Session: &meta}
+	case daemonOpPing:
+		if !session.IsConnected() {
+			return errorResponse(ErrConnectionLost)
+		}
+		return daemonResponse{}
+	case daemonOpExec:
+		ctx, cancel := withCommandTimeout(ctx, req.Timeout)
+		defer cancel()
+		exec := session.Exec
+		if req.Sudo {
+			exec = session.ExecSudo
+		}
+		result, err := exec(ctx, req.Command)
+		response := errorResponse(err)
+		response.Result = result
+		return response
+	case daemonOpStream:
+		ctx, cancel := withCommandTimeout(ctx, req.Timeout)
+		defer cancel()
+		stream := session.RunStreamContext
+		if req.Sudo {
+			stream = session.RunStreamSudo
+		}
+		err := stream(ctx, req.Command, out)
+		response := errorResponse(err)
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			response.Result = cmdErr.Result
+		}
+		return response
+	default:
+		return errorResponse(fmt.Errorf("unknown daemon request %q", req.Op))
+	}
+}
+
+// session returns the connection for a cached session (the active one when
+// name is empty), dialing it if it is new, dead or from an older login. The
+// dial runs without d.mu held, so a slow or unreachable host only holds up
+// the requests for that session.
+func (d *daemon) session(ctx context.Context, name string) (*SSHSession, error) {
+	meta, err := SessionMetadata(name)
+	if err != nil {
+		if name != "" {
+			d.forget(name)
+		}
+		return nil, err
+	}
+	if meta.Timeout.Before(time.Now()) {
+		d.forget(meta.Name)
+		return nil, fmt.Errorf("session has expired at %s", meta.Timeout.Format(time.RFC3339))
+	}
+
+	d.mu.Lock()
+	var stale *SSHSession
+	if held := d.sessions[meta.Name]; held != nil {
+		if held.loginAt.Equal(meta.LoginAt) && held.session.Alive() {
+			d.mu.Unlock()
+			return held.session, nil
+		}
+		stale = held.session
+		delete(d.sessions, meta.Name)
+	}
+	if dial := d.dialing[meta.Name]; dial != nil {
+		d.mu.Unlock()
+		select {
+		case <-dial.done:
+			return dial.session, dial.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	dial := &daemonDial{done: make(chan struct{})}
+	d.dialing[meta.Name] = dial
+	d.mu.Unlock()
+
+	if stale != nil {
+		stale.Close()
+	}
+	session, err := loadSessionDirect(meta.Name)
+	if err != nil {
+		err = fmt.Errorf("%w to %s: %w", errSessionDial, meta.Name, err)
+	} else {
+		session.daemonServed = true
+		if d.opts.Configure != nil {
+			d.opts.Configure(session)
+		}
+	}
+
+	d.mu.Lock()
+	delete(d.dialing, meta.Name)
+	if err == nil {
+		d.sessions[meta.Name] = &daemonSession{session: session, loginAt: meta.LoginAt}
+	}
+	dial.session, dial.err = session, err
+	close(dial.done)
+	d.mu.Unlock()
+
+	if err != nil {
+		d.opts.Logf("%v", err)
+		return nil, err
+	}
+	d.opts.Logf("connected %s (%s@%s)", meta.Name, session.User, session.Host)
+	return session, nil
+}
+
+// prune closes sessions whose cache entry has expired or been removed.
+func (d *daemon) prune() {
+	d.mu.Lock()
+	names := make([]string, 0, len(d.sessions))
+	for name := range d.sessions {
+		names = append(names, name)
+	}
+	d.mu.Unlock()
+
+	for _, name := range names {
+		meta, err := SessionMetadata(name)
+		if err != nil || meta.Timeout.Before(time.Now()) {
+			d.forget(name)
+		}
+	}
+}
+
+func (d *daemon) forget(name string) {
+	d.mu.Lock()
+	held := d.sessions[name]
+	delete(d.sessions, name)
+	d.mu.Unlock()
+	if held != nil {
+		held.session.Close()
+		d.opts.Logf("closed %s", name)
+	}
+}
+
+func (d *daemon) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, held := range d.sessions {
+		held.session.Close()
+		delete(d.sessions, name)
+	}
+}
+
+func (d *daemon) snapshot() *DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := d.status
+	status.Sessions = make([]string, 0, len(d.sessions))
+	for name := range d.sessions {
+		status.Sessions = append(status.Sessions, name)
+	}
+	sort.Strings(status.Sessions)
+	return &status
+}
+
+// daemonWriter sends streamed output as frames. The ssh package may write
+// from more than one goroutine.
+type daemonWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *daemonWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(daemonResponse{Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *daemonWriter) send(response daemonResponse) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	response.Done = true
+	w.enc.Encode(response)
+}
+
+func errorResponse(err error) daemonResponse {
+	if err == nil {
+		return daemonResponse{}
+	}
+	response := daemonResponse{Error: err.Error()}
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		response.Cause = cmdErr.Err.Error()
+	}
+	for kind, sentinel := range daemonErrorKinds {
+		if errors.Is(err, sentinel) {
+			response.Kinds = append(response.Kinds, kind)
+		}
+	}
+	sort.Strings(response.Kinds)
+	return response
+}
@@ -0,0 +1,173 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// daemonDialTimeout bounds connecting to the daemon socket, so a wedged
+// daemon costs little more than the handshake it was meant to save.
+const daemonDialTimeout = 2 * time.Second
+
+// daemonClient sends requests to a daemon listening on socket.
+type daemonClient struct {
+	socket string
+}
+
+// loadDaemonSession asks a running daemon for the session cached under name
+// and returns a session that runs its commands through the daemon. It
+// returns ErrDaemonNotRunning when nothing answers on the socket.
+func loadDaemonSession(name string) (*SSHSession, error) {
+	socket, err := DaemonSocketPath()
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+	client := &daemonClient{socket: socket}
+
+	response, err := client.call(context.Background(), daemonRequest{Op: daemonOpOpen, Session: name}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.Session == nil {
+		return nil, fmt.Errorf("daemon did not describe session %q", name)
+	}
+
+	meta := *response.Session
+	return &SSHSession{
+		Name:           meta.Name,
+		Host:           meta.Host,
+		Port:           meta.Port,
+		User:           meta.User,
+		AuthMethod:     meta.AuthMethod,
+		KeyFile:        meta.KeyFile,
+		CertFile:       meta.CertFile,
+		ConnectTimeout: meta.ConnectTimeout,
+		HostKeyPolicy:  meta.HostKeyPolicy,
+		Sudo:           meta.Sudo,
+		Expiry:         meta.Expiry(),
+		daemon:         client,
+		dialDirect: func() (*SSHSession, error) {
+			return loadSessionDirect(meta.Name)
+		},
+	}, nil
+}
+
+// QueryDaemon reports on the daemon listening on the default socket.
+func QueryDaemon() (*DaemonStatus, error) {
+	socket, err := DaemonSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	response, err := (&daemonClient{socket: socket}).call(context.Background(), daemonRequest{Op: daemonOpStatus}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Status, nil
+}
+
+// StopDaemon asks the daemon on the default socket to close its connections
+// and exit.
+func StopDaemon() error {
+	socket, err := DaemonSocketPath()
+	if err != nil {
+		return err
+	}
+	_, err = (&daemonClient{socket: socket}).call(context.Background(), daemonRequest{Op: daemonOpStop}, nil)
+	return err
+}
+
+func (c *daemonClient) ping(name string) error {
+	_, err := c.call(context.Background(), daemonRequest{Op: daemonOpPing, Session: name}, nil)
+	return err
+}
+
+// exec runs cmd on the daemon's connection for s.
+func (c *daemonClient) exec(ctx context.Context, s *SSHSession, cmd string, sudo bool) (*RunResult, error) {
+	response, err := c.call(ctx, daemonRequest{Op: daemonOpExec, Session: s.Name, Command: cmd, Sudo: sudo, Timeout: s.CommandTimeout}, nil)
+	if response != nil && response.Result != nil {
+		return response.Result, err
+	}
+	return nil, err
+}
+
+// stream runs cmd on the daemon's connection for s, copying its output to w
+// as it arrives.
+func (c *daemonClient) stream(ctx context.Context, s *SSHSession, cmd string, sudo bool, w io.Writer) error {
+	_, err := c.call(ctx, daemonRequest{Op: daemonOpStream, Session: s.Name, Command: cmd, Sudo: sudo, Timeout: s.CommandTimeout}, w)
+	return err
+}
+
+// call sends req and reads frames until the final one, writing any output to
+// w. Cancelling ctx closes the connection, which makes the daemon interrupt
+// the remote command.
+func (c *daemonClient) call(ctx context.Context, req daemonRequest, w io.Writer) (*daemonResponse, error) {
+	conn, err := net.DialTimeout("unix", c.socket, daemonDialTimeout)
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("send daemon request: %w", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var response daemonResponse
+		if err := decoder.Decode(&response); err != nil {
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			return nil, fmt.Errorf("%w: daemon closed the connection: %v", ErrConnectionLost, err)
+		}
+		if response.Output != "" && w != nil {
+			if _, err := io.WriteString(w, response.Output); err != nil {
+				return nil, err
+			}
+		}
+		if response.Done {
+			return &response, response.err()
+		}
+	}
+}
+
+// err rebuilds the error the daemon reported.
+func (r *daemonResponse) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	err := &daemonError{msg: r.Error}
+	for _, kind := range r.Kinds {
+		if sentinel, ok := daemonErrorKinds[kind]; ok {
+			err.wrapped = append(err.wrapped, sentinel)
+		}
+	}
+	if r.Result != nil {
+		err.wrapped = append(err.wrapped, &CommandError{Result: r.Result, Err: errors.New(r.Cause)})
+	}
+	return err
+}
+
+// daemonError carries an error across the socket. errors.Is and errors.As
+// see the sentinels it wrapped in the daemon and, for failed commands, a
+// *CommandError with the result.
+type daemonError struct {
+	msg     string
+	wrapped []error
+}
+
+func (e *daemonError) Error() string {
+	return e.msg
+}
+
+func (e *daemonError) Unwrap() []error {
+	return e.wrapped
+}
@@ -0,0 +1,339 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	setTempHome(t)
+
+	secrets, restoreKeyring := stubKeyring()
+	t.Cleanup(restoreKeyring)
+
+	server := startForwardingServer(t, "secret")
+	var dials, slowDials, lockedDials atomic.Int32
+	slowDialing := make(chan struct{}, 1)
+	releaseSlow := make(chan struct{})
+	original := newSSHSession
+	newSSHSession = func(opts SessionOptions) (*SSHSession, error) {
+		if opts.Host == "locked.example" && lockedDials.Add(1) == 1 {
+			return nil, errors.New("key file is encrypted and no passphrase was provided")
+		}
+		if opts.Host == "slow.example" {
+			slowDials.Add(1)
+			slowDialing <- struct{}{}
+			<-releaseSlow
+		} else {
+			dials.Add(1)
+		}
+		return NewSSHSession(testSessionOptions(t, server, opts.Auth.Password))
+	}
+	t.Cleanup(func() { newSSHSession = original })
+
+	now := time.Now()
+	file, err := sessionFilePath("lab")
+	if err != nil {
+		t.Fatalf("session file path: %v", err)
+	}
+	if err := writeSessionData(file, SSHSessionConfig{Name: "lab", Host: "lab.example", User: "admin",
+		LoginAt: now, Timeout: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+	if err := SetActiveSession("lab"); err != nil {
+		t.Fatalf("SetActiveSession: %v", err)
+	}
+	secrets[credentialsKey("lab.example", 0, "admin")] = "secret"
+
+	socket, err := DaemonSocketPath()
+	if err != nil {
+		t.Fatalf("DaemonSocketPath: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeDaemon(context.Background(), DaemonOptions{Socket: socket, IdleTimeout: time.Minute})
+	}()
+	waitFor(t, func() bool {
+		_, err := QueryDaemon()
+		return err == nil
+	})
+
+	t.Run("socket is private", func(t *testing.T) {
+		info, err := os.Stat(socket)
+		if err != nil {
+			t.Fatalf("stat socket: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0o600 {
+			t.Fatalf("expected socket mode 0600, got %o", perm)
+		}
+	})
+
+	t.Run("a second daemon refuses to start", func(t *testing.T) {
+		err := ServeDaemon(context.Background(), DaemonOptions{Socket: socket})
+		if err == nil || !strings.Contains(err.Error(), "already listening") {
+			t.Fatalf("expected already listening error, got %v", err)
+		}
+	})
+
+	t.Run("sessions share one connection", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			session, err := LoadSession("")
+			if err != nil {
+				t.Fatalf("LoadSession: %v", err)
+			}
+			if session.daemon == nil {
+				t.Fatalf("expected a daemon-backed session")
+			}
+			if session.Name != "lab" || session.Host != "lab.example" {
+				t.Fatalf("unexpected session %s (%s)", session.Name, session.Host)
+			}
+			output, err := session.Run("uptime")
+			if err != nil || output != "uptime" {
+				t.Fatalf("Run: %q, %v", output, err)
+			}
+			if !session.IsConnected() {
+				t.Fatalf("expected the session to report connected")
+			}
+			session.Close()
+		}
+		if got := dials.Load(); got != 1 {
+			t.Fatalf("expected one dial, got %d", got)
+		}
+
+		status, err := QueryDaemon()
+		if err != nil {
+			t.Fatalf("QueryDaemon: %v", err)
+		}
+		if !slices.Equal(status.Sessions, []string{"lab"}) || status.PID != os.Getpid() {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("command errors keep their result", func(t *testing.T) {
+		session, err := LoadSession("lab")
+		if err != nil {
+			t.Fatalf("LoadSession: %v", err)
+		}
+		defer session.Close()
+
+		result, err := session.Exec(context.Background(), "exit 3")
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Result.ExitCode != 3 {
+			t.Fatalf("expected a CommandError with exit code 3, got %v", err)
+		}
+		if result == nil || !strings.Contains(result.Stderr, "exit 3 failed") {
+			t.Fatalf("expected stderr in the result, got %+v", result)
+		}
+		if !strings.Contains(err.Error(), "exit 3 failed") {
+			t.Fatalf("expected the stderr tail in %q", err)
+		}
+	})
+
+	t.Run("streams output", func(t *testing.T) {
+		session, err := LoadSession("lab")
+		if err != nil {
+			t.Fatalf("LoadSession: %v", err)
+		}
+		defer session.Close()
+
+		var out strings.Builder
+		if err := session.RunStreamContext(context.Background(), "journalctl -f", &out); err != nil {
+			t.Fatalf("RunStreamContext: %v", err)
+		}
+		if out.String() != "journalctl -f\n" {
+			t.Fatalf("unexpected stream output %q", out.String())
+		}
+	})
+
+	t.Run("command timeout interrupts the remote command", func(t *testing.T) {
+		session, err := LoadSession("lab")
+		if err != nil {
+			t.Fatalf("LoadSession: %v", err)
+		}
+		defer session.Close()
+		session.CommandTimeout = 50 * time.Millisecond
+
+		_, err = session.Exec(context.Background(), "block")
+		if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+	})
+
+	t.Run("cancelling the caller interrupts the remote command", func(t *testing.T) {
+		session, err := LoadSession("lab")
+		if err != nil {
+			t.Fatalf("LoadSession: %v", err)
+		}
+		defer session.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := session.Exec(ctx, "block"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the caller's deadline, got %v", err)
+		}
+	})
+
+	t.Run("a slow dial holds up only its own session", func(t *testing.T) {
+		file, err := sessionFilePath("slow")
+		if err != nil {
+			t.Fatalf("session file path: %v", err)
+		}
+		if err := writeSessionData(file, SSHSessionConfig{Name: "slow", Host: "slow.example", User: "admin",
+			LoginAt: now, Timeout: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("write session: %v", err)
+		}
+		secrets[credentialsKey("slow.example", 0, "admin")] = "secret"
+
+		loaded := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				session, err := LoadSession("slow")
+				if err == nil {
+					session.Close()
+				}
+				loaded <- err
+			}()
+		}
+		<-slowDialing
+
+		// Other requests are answered while the dial is blocked.
+		answered := make(chan error, 1)
+		go func() {
+			if _, err := QueryDaemon(); err != nil {
+				answered <- err
+				return
+			}
+			session, err := LoadSession("lab")
+			if err != nil {
+				answered <- err
+				return
+			}
+			defer session.Close()
+			_, err = session.Run("uptime")
+			answered <- err
+		}()
+		select {
+		case err := <-answered:
+			if err != nil {
+				t.Fatalf("request during a slow dial: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("requests for other sessions waited on the slow dial")
+		}
+
+		close(releaseSlow)
+		for i := 0; i < 2; i++ {
+			if err := <-loaded; err != nil {
+				t.Fatalf("LoadSession(slow): %v", err)
+			}
+		}
+		if got := slowDials.Load(); got != 1 {
+			t.Fatalf("expected waiting requests to share one dial, got %d", got)
+		}
+
+		// Drop it again so that the daemon holds only lab.
+		if err := DeleteSession("slow"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := LoadSession("slow"); err == nil {
+			t.Fatalf("expected a dropped session to fail to load")
+		}
+	})
+
+	t.Run("a session the daemon cannot dial is dialed directly", func(t *testing.T) {
+		file, err := sessionFilePath("locked")
+		if err != nil {
+			t.Fatalf("session file path: %v", err)
+		}
+		if err := writeSessionData(file, SSHSessionConfig{Name: "locked", Host: "locked.example", User: "admin",
+			LoginAt: now, Timeout: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("write session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession("locked") })
+		secrets[credentialsKey("locked.example", 0, "admin")] = "secret"
+
+		session, err := LoadSession("locked")
+		if err != nil {
+			t.Fatalf("LoadSession: %v", err)
+		}
+		defer session.Close()
+		if session.daemon != nil || lockedDials.Load() != 2 {
+			t.Fatalf("expected a direct dial after the daemon's failed, got daemon=%v after %d dials", session.daemon != nil, lockedDials.Load())
+		}
+		if output, err := session.Run("uptime"); err != nil || output != "uptime" {
+			t.Fatalf("Run: %q, %v", output, err)
+		}
+	})
+
+	t.Run("dropped sessions are closed", func(t *testing.T) {
+		if err := DeleteSession("lab"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := LoadSession("lab"); err == nil {
+			t.Fatalf("expected a dropped session to fail to load")
+		}
+		if _, err := LoadSession(""); !errors.Is(err, ErrNoActiveSession) {
+			t.Fatalf("expected ErrNoActiveSession through the daemon, got %v", err)
+		}
+		status, err := QueryDaemon()
+		if err != nil {
+			t.Fatalf("QueryDaemon: %v", err)
+		}
+		if len(status.Sessions) != 0 {
+			t.Fatalf("expected no held sessions, got %v", status.Sessions)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		if err := StopDaemon(); err != nil {
+			t.Fatalf("StopDaemon: %v", err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ServeDaemon: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("daemon did not stop")
+		}
+		if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the socket removed, got %v", err)
+		}
+		if _, err := QueryDaemon(); !errors.Is(err, ErrDaemonNotRunning) {
+			t.Fatalf("expected ErrDaemonNotRunning, got %v", err)
+		}
+	})
+}
+
+func TestDaemonIdleTimeout(t *testing.T) {
+	setTempHome(t)
+
+	socket, err := DaemonSocketPath()
+	if err != nil {
+		t.Fatalf("DaemonSocketPath: %v", err)
+	}
+	// A stale socket from a daemon that crashed is replaced.
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatalf("write stale socket: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeDaemon(context.Background(), DaemonOptions{Socket: socket, IdleTimeout: 100 * time.Millisecond})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ServeDaemon: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("daemon did not exit when idle")
+	}
+}
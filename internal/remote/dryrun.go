@@ -0,0 +1,149 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type mutatingStepKey struct{}
+
+// Mutating marks the commands run with the returned context as the workflow
+// step named step, one that changes the host. A DryRun prints them instead of
+// running them; every other executor ignores the mark.
+func Mutating(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, mutatingStepKey{}, step)
+}
+
+// MutatingStep returns the step ctx was marked with by Mutating.
+func MutatingStep(ctx context.Context) (string, bool) {
+	step, ok := ctx.Value(mutatingStepKey{}).(string)
+	return step, ok
+}
+
+// PlannedStep is a mutating command a DryRun skipped.
+type PlannedStep struct {
+	Step    string
+	Command string
+	Sudo    bool
+}
+
+// Display is the command as it would be typed, with sudo in front when it
+// runs as root.
+func (p PlannedStep) Display() string {
+	if p.Sudo {
+		return "sudo " + p.Command
+	}
+	return p.Command
+}
+
+// DryRun lets read-only commands through to the executors it wraps, so later
+// steps see real output, and skips the ones marked with Mutating: each is
+// printed to Out and answered with an empty, successful result. Uploads
+// always change the host and are skipped too.
+type DryRun struct {
+	Out io.Writer
+
+	mu    sync.Mutex
+	steps []PlannedStep
+}
+
+// NewDryRun returns a DryRun that reports skipped commands to out.
+func NewDryRun(out io.Writer) *DryRun {
+	return &DryRun{Out: out}
+}
+
+// Wrap returns an executor that runs read-only commands with inner.
+func (d *DryRun) Wrap(inner Executor) Executor {
+	return &dryRunExecutor{plan: d, inner: inner}
+}
+
+// Steps returns the skipped commands in the order the workflow reached them.
+func (d *DryRun) Steps() []PlannedStep {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]PlannedStep(nil), d.steps...)
+}
+
+func (d *DryRun) skip(step PlannedStep) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.steps = append(d.steps, step)
+	if d.Out != nil {
+		fmt.Fprintf(d.Out, "[dry-run] %s: %s\n", step.Step, step.Display())
+	}
+}
+
+type dryRunExecutor struct {
+	plan  *DryRun
+	inner Executor
+}
+
+// skips reports whether cmd is a mutating step, recording it if so.
+func (e *dryRunExecutor) skips(ctx context.Context, cmd string, sudo bool) bool {
+	step, ok := MutatingStep(ctx)
+	if !ok {
+		return false
+	}
+	e.plan.skip(PlannedStep{Step: step, Command: cmd, Sudo: sudo})
+	return true
+}
+
+func (e *dryRunExecutor) exec(ctx context.Context, cmd string, sudo bool, run func(context.Context, string) (*RunResult, error)) (*RunResult, error) {
+	if e.skips(ctx, cmd, sudo) {
+		return &RunResult{}, nil
+	}
+	return run(ctx, cmd)
+}
+
+func (e *dryRunExecutor) Exec(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, false, e.inner.Exec)
+}
+
+func (e *dryRunExecutor) ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, false, e.inner.ExecIdempotent)
+}
+
+func (e *dryRunExecutor) ExecSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	return e.exec(ctx, cmd, true, e.inner.ExecSudo)
+}
+
+func (e *dryRunExecutor) RunContext(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.Exec(ctx, cmd))
+}
+
+func (e *dryRunExecutor) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.ExecIdempotent(ctx, cmd))
+}
+
+func (e *dryRunExecutor) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(e.ExecSudo(ctx, cmd))
+}
+
+func (e *dryRunExecutor) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	if e.skips(ctx, cmd, false) {
+		return nil
+	}
+	return e.inner.RunStreamContext(ctx, cmd, w)
+}
+
+func (e *dryRunExecutor) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	if e.skips(ctx, cmd, true) {
+		return nil
+	}
+	return e.inner.RunStreamSudo(ctx, cmd, w)
+}
+
+func (e *dryRunExecutor) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error) {
+	step, ok := MutatingStep(ctx)
+	if !ok {
+		step = "Upload"
+	}
+	e.plan.skip(PlannedStep{Step: step, Command: fmt.Sprintf("upload %s to %s", localPath, remotePath)})
+	return &TransferStats{}, nil
+}
+
+func (e *dryRunExecutor) Close() error {
+	return e.inner.Close()
+}
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("wraps the local executor, which runs commands with sh")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "changed")
+
+	var out bytes.Buffer
+	plan := NewDryRun(&out)
+	client := plan.Wrap(NewLocalExecutor(SudoNone))
+
+	if output, err := client.RunIdempotent(ctx, "echo node1"); err != nil || output != "node1\n" {
+		t.Fatalf("read-only command = %q, %v", output, err)
+	}
+	if output, err := client.RunSudo(Mutating(ctx, "Touch marker"), "touch "+marker); err != nil || output != "" {
+		t.Fatalf("mutating command = %q, %v", output, err)
+	}
+	if err := client.RunStreamContext(Mutating(ctx, "Append marker"), "echo x >> "+marker, &out); err != nil {
+		t.Fatalf("mutating stream: %v", err)
+	}
+	if _, err := client.Upload(ctx, filepath.Join(dir, "missing"), marker, TransferOptions{}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the dry run to leave %s alone, got %v", marker, err)
+	}
+
+	want := []PlannedStep{
+		{Step: "Touch marker", Command: "touch " + marker, Sudo: true},
+		{Step: "Append marker", Command: "echo x >> " + marker},
+		{Step: "Upload", Command: "upload " + filepath.Join(dir, "missing") + " to " + marker},
+	}
+	steps := plan.Steps()
+	if len(steps) != len(want) {
+		t.Fatalf("planned %+v, want %+v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+	wantOut := "[dry-run] Touch marker: sudo touch " + marker + "\n" +
+		"[dry-run] Append marker: echo x >> " + marker + "\n" +
+		"[dry-run] Upload: upload " + filepath.Join(dir, "missing") + " to " + marker + "\n"
+	if out.String() != wantOut {
+		t.Errorf("printed %q, want %q", out.String(), wantOut)
+	}
+}
@@ -0,0 +1,39 @@
+package remote
+
+import (
+	"context"
+	"io"
+)
+
+// Executor runs a workflow's commands on a host. *SSHSession runs them over
+// SSH, *LocalExecutor on the machine labman itself runs on, and tests can
+// substitute the scripted fake in remotetest.
+type Executor interface {
+	// RunContext runs cmd through a shell and returns its combined output,
+	// which is kept even when the command fails.
+	RunContext(ctx context.Context, cmd string) (string, error)
+	// RunIdempotent is RunContext for commands that are safe to repeat if
+	// the executor has to retry them.
+	RunIdempotent(ctx context.Context, cmd string) (string, error)
+	// RunSudo is RunContext for a command that must run as root.
+	RunSudo(ctx context.Context, cmd string) (string, error)
+	// Exec, ExecIdempotent and ExecSudo are the Run variants that report
+	// stdout, stderr and the exit status separately. A failed command
+	// returns both the result and a *CommandError.
+	Exec(ctx context.Context, cmd string) (*RunResult, error)
+	ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error)
+	ExecSudo(ctx context.Context, cmd string) (*RunResult, error)
+	// RunStreamContext runs cmd and copies its output to w as it arrives.
+	RunStreamContext(ctx context.Context, cmd string, w io.Writer) error
+	// RunStreamSudo is RunStreamContext for a command that must run as root.
+	RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error
+	// Upload copies localPath to remotePath on the host.
+	Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error)
+	// Close releases the executor's connection, if it has one.
+	Close() error
+}
+
+var (
+	_ Executor = (*SSHSession)(nil)
+	_ Executor = (*LocalExecutor)(nil)
+)
@@ -0,0 +1,291 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FactsTTL is how long SSHSession.Facts trusts a cached probe. Workflows that
+// change the platform forget it sooner, see SSHSession.ForgetFacts.
+var FactsTTL = 24 * time.Hour
+
+// ProbedCommands are the commands Facts records as present or absent.
+var ProbedCommands = []string{
+	"apt-get", "dnf", "yum", "pacman", "apk", "zypper",
+	"systemctl", "journalctl", "timedatectl",
+	"snap", "microk8s", "k3s", "kubectl", "docker",
+	"lsb_release", "lscpu", "do-release-upgrade",
+}
+
+// packageManagers maps the command that gives a package manager away to its
+// name, in order of preference: Fedora still ships yum next to dnf.
+var packageManagers = []struct {
+	command string
+	name    string
+}{
+	{"apt-get", "apt"},
+	{"dnf", "dnf"},
+	{"yum", "yum"},
+	{"pacman", "pacman"},
+	{"apk", "apk"},
+	{"zypper", "zypper"},
+}
+
+// FactsCommand prints what ProbeFacts needs in one round trip. It only reads,
+// and always exits 0 so a missing piece never hides the rest. sbin and
+// /snap/bin are searched too since non-interactive shells often leave them
+// off PATH.
+var FactsCommand = `PATH="$PATH:/usr/local/sbin:/usr/local/bin:/usr/sbin:/sbin:/snap/bin"
+echo '[os-release]'
+cat /etc/os-release 2>/dev/null || cat /usr/lib/os-release 2>/dev/null
+echo '[uname]'
+uname -s; uname -r; uname -m
+echo '[init]'
+if [ -d /run/systemd/system ]; then echo systemd
+elif [ -d /run/openrc ] || command -v openrc >/dev/null 2>&1; then echo openrc
+else cat /proc/1/comm 2>/dev/null || echo unknown
+fi
+echo '[commands]'
+for c in ` + strings.Join(ProbedCommands, " ") + `; do
+  command -v "$c" >/dev/null 2>&1 && echo "$c"
+done
+exit 0`
+
+// OSRelease is the part of /etc/os-release labman uses.
+type OSRelease struct {
+	// ID is the distribution, e.g. ubuntu, fedora, arch or alpine
+	ID string `yaml:"id,omitempty"`
+	// IDLike lists the distributions this one derives from, e.g. [debian]
+	IDLike     []string `yaml:"id_like,omitempty"`
+	Name       string   `yaml:"name,omitempty"`
+	PrettyName string   `yaml:"pretty_name,omitempty"`
+	VersionID  string   `yaml:"version_id,omitempty"`
+}
+
+// Facts describes a host's platform: which distribution and kernel it runs,
+// how it boots services and installs packages, and which tools labman's
+// workflows depend on are installed.
+type Facts struct {
+	OS OSRelease `yaml:"os"`
+	// Kernel, KernelRelease and Arch are uname -s, -r and -m
+	Kernel        string `yaml:"kernel,omitempty"`
+	KernelRelease string `yaml:"kernel_release,omitempty"`
+	Arch          string `yaml:"arch,omitempty"`
+	// Init is systemd, openrc, or the name of PID 1
+	Init string `yaml:"init,omitempty"`
+	// PackageManager is apt, dnf, yum, pacman, apk or zypper; "" when none
+	// of them is installed
+	PackageManager string `yaml:"package_manager,omitempty"`
+	// Commands lists which of ProbedCommands are installed
+	Commands []string `yaml:"commands,omitempty"`
+	// ProbedAt is when the probe ran
+	ProbedAt time.Time `yaml:"probed_at"`
+}
+
+// Has reports whether command, one of ProbedCommands, is installed.
+func (f *Facts) Has(command string) bool {
+	return slices.Contains(f.Commands, command)
+}
+
+// IsLike reports whether the distribution is id or derives from it, so
+// IsLike("debian") holds on Ubuntu and Raspberry Pi OS.
+func (f *Facts) IsLike(id string) bool {
+	return f.OS.ID == id || slices.Contains(f.OS.IDLike, id)
+}
+
+// Describe names the platform in one line, e.g.
+// "Alpine Linux v3.20 (x86_64, openrc, apk)".
+func (f *Facts) Describe() string {
+	name := f.OS.PrettyName
+	if name == "" {
+		name = strings.TrimSpace(f.OS.Name + " " + f.OS.VersionID)
+	}
+	if name == "" {
+		name = f.Kernel
+	}
+	if name == "" {
+		name = "unknown platform"
+	}
+
+	var details []string
+	for _, detail := range []string{f.Arch, f.Init, f.PackageManager} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
+}
+
+// ProbeFacts runs FactsCommand with e and parses what it printed. It does not
+// cache; see SSHSession.Facts.
+func ProbeFacts(ctx context.Context, e Executor) (*Facts, error) {
+	output, err := e.RunIdempotent(ctx, FactsCommand)
+	if err != nil {
+		return nil, fmt.Errorf("probe platform facts: %w", err)
+	}
+	facts, err := ParseFacts(output)
+	if err != nil {
+		return nil, fmt.Errorf("probe platform facts: %w", err)
+	}
+	facts.ProbedAt = time.Now().UTC()
+	return facts, nil
+}
+
+// ParseFacts reads the output of FactsCommand.
+func ParseFacts(output string) (*Facts, error) {
+	facts := &Facts{}
+	sections := map[string][]string{}
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			sections[section] = []string{}
+			continue
+		}
+		if section != "" && line != "" {
+			sections[section] = append(sections[section], line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := sections["commands"]; !ok {
+		return nil, fmt.Errorf("unexpected output, is the login shell POSIX compatible? %q", strings.TrimSpace(output))
+	}
+
+	for _, line := range sections["os-release"] {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = unquoteOSRelease(value)
+		switch key {
+		case "ID":
+			facts.OS.ID = value
+		case "ID_LIKE":
+			facts.OS.IDLike = strings.Fields(value)
+		case "NAME":
+			facts.OS.Name = value
+		case "PRETTY_NAME":
+			facts.OS.PrettyName = value
+		case "VERSION_ID":
+			facts.OS.VersionID = value
+		}
+	}
+
+	uname := sections["uname"]
+	for i, field := range []*string{&facts.Kernel, &facts.KernelRelease, &facts.Arch} {
+		if i < len(uname) {
+			*field = uname[i]
+		}
+	}
+	if init := sections["init"]; len(init) > 0 {
+		facts.Init = init[0]
+	}
+
+	for _, command := range sections["commands"] {
+		if slices.Contains(ProbedCommands, command) && !slices.Contains(facts.Commands, command) {
+			facts.Commands = append(facts.Commands, command)
+		}
+	}
+	for _, pm := range packageManagers {
+		if facts.Has(pm.command) {
+			facts.PackageManager = pm.name
+			break
+		}
+	}
+	return facts, nil
+}
+
+// unquoteOSRelease strips the shell quoting os-release values may carry.
+func unquoteOSRelease(value string) string {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1]
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+		var b strings.Builder
+		for i := 0; i < len(value); i++ {
+			if value[i] == '\\' && i+1 < len(value) && strings.ContainsRune("\"\\$`", rune(value[i+1])) {
+				i++
+			}
+			b.WriteByte(value[i])
+		}
+		return b.String()
+	}
+	return value
+}
+
+// Facts describes the host the session is connected to. The probe runs once
+// per session: its result is kept with the cached session until the next
+// login, FactsTTL passes or ForgetFacts is called, so later commands answer
+// from the cache.
+func (s *SSHSession) Facts(ctx context.Context) (*Facts, error) {
+	s.factsMu.Lock()
+	defer s.factsMu.Unlock()
+
+	if s.facts != nil && factsFresh(s.facts) {
+		return s.facts, nil
+	}
+	if s.Name != "" {
+		if data, err := SessionMetadata(s.Name); err == nil && data.Facts != nil && factsFresh(data.Facts) && data.Host == s.Host && data.User == s.User {
+			s.facts = data.Facts
+			return s.facts, nil
+		}
+	}
+
+	facts, err := ProbeFacts(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	s.facts = facts
+	if s.Name != "" {
+		// Best effort: the next command probes again if this fails.
+		_ = saveSessionFacts(s.Name, s.Host, s.User, facts)
+	}
+	return facts, nil
+}
+
+// ForgetFacts drops the cached probe so that the next call to Facts runs it
+// again, for workflows that upgrade the OS or change installed packages.
+func (s *SSHSession) ForgetFacts() error {
+	s.factsMu.Lock()
+	defer s.factsMu.Unlock()
+
+	s.facts = nil
+	if s.Name == "" {
+		return nil
+	}
+	return saveSessionFacts(s.Name, s.Host, s.User, nil)
+}
+
+func factsFresh(facts *Facts) bool {
+	return time.Since(facts.ProbedAt) < FactsTTL
+}
+
+// saveSessionFacts stores facts with the session cached under name, unless
+// it has since been replaced by a login to another host.
+func saveSessionFacts(name, host, user string, facts *Facts) error {
+	sessionFile, err := resolveSessionFile(name)
+	if err != nil {
+		return err
+	}
+	sessionData, err := loadSessionDataFromFile(sessionFile)
+	if err != nil {
+		return err
+	}
+	if sessionData.Host != host || sessionData.User != user {
+		return nil
+	}
+	sessionData.Facts = facts
+	return writeSessionData(sessionFile, sessionData)
+}
@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFacts(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Facts
+		wantErr bool
+	}{
+		{
+			name: "fedora prefers dnf over yum",
+			output: `[os-release]
+NAME="Fedora Linux"
+ID=fedora
+VERSION_ID=40
+PRETTY_NAME="Fedora Linux 40 (Server Edition)"
+[uname]
+Linux
+6.10.6-200.fc40.x86_64
+x86_64
+[init]
+systemd
+[commands]
+yum
+dnf
+systemctl
+docker
+`,
+			want: Facts{
+				OS:             OSRelease{ID: "fedora", Name: "Fedora Linux", PrettyName: "Fedora Linux 40 (Server Edition)", VersionID: "40"},
+				Kernel:         "Linux",
+				KernelRelease:  "6.10.6-200.fc40.x86_64",
+				Arch:           "x86_64",
+				Init:           "systemd",
+				PackageManager: "dnf",
+				Commands:       []string{"yum", "dnf", "systemctl", "docker"},
+			},
+		},
+		{
+			name: "raspberry pi os with shell quoting",
+			output: `[os-release]
+ID=debian
+ID_LIKE='debian raspbian'
+PRETTY_NAME="Raspbian \"bookworm\" \$HOME"
+[uname]
+Linux
+6.6.31+rpt-rpi-v8
+aarch64
+[init]
+systemd
+[commands]
+apt-get
+unknown-tool
+`,
+			want: Facts{
+				OS:             OSRelease{ID: "debian", IDLike: []string{"debian", "raspbian"}, PrettyName: `Raspbian "bookworm" $HOME`},
+				Kernel:         "Linux",
+				KernelRelease:  "6.6.31+rpt-rpi-v8",
+				Arch:           "aarch64",
+				Init:           "systemd",
+				PackageManager: "apt",
+				Commands:       []string{"apt-get"},
+			},
+		},
+		{
+			name:   "no os-release and no package manager",
+			output: "[os-release]\n[uname]\nLinux\n5.15.0\nx86_64\n[init]\ninit\n[commands]\n",
+			want:   Facts{Kernel: "Linux", KernelRelease: "5.15.0", Arch: "x86_64", Init: "init"},
+		},
+		{
+			name:    "not a POSIX shell",
+			output:  "fish: Unknown command: [os-release]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFacts(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFacts: %v", err)
+			}
+			if got.OS.ID != tt.want.OS.ID || !slices.Equal(got.OS.IDLike, tt.want.OS.IDLike) || got.OS.Name != tt.want.OS.Name ||
+				got.OS.PrettyName != tt.want.OS.PrettyName || got.OS.VersionID != tt.want.OS.VersionID {
+				t.Errorf("OS = %+v, want %+v", got.OS, tt.want.OS)
+			}
+			if got.Kernel != tt.want.Kernel || got.KernelRelease != tt.want.KernelRelease || got.Arch != tt.want.Arch || got.Init != tt.want.Init {
+				t.Errorf("uname/init = %+v, want %+v", got, tt.want)
+			}
+			if got.PackageManager != tt.want.PackageManager || !slices.Equal(got.Commands, tt.want.Commands) {
+				t.Errorf("packages = %q %q, want %q %q", got.PackageManager, got.Commands, tt.want.PackageManager, tt.want.Commands)
+			}
+		})
+	}
+}
+
+func TestFactsHelpers(t *testing.T) {
+	facts := &Facts{
+		OS:             OSRelease{ID: "ubuntu", IDLike: []string{"debian"}, PrettyName: "Ubuntu 24.04.1 LTS"},
+		Arch:           "x86_64",
+		Init:           "systemd",
+		PackageManager: "apt",
+		Commands:       []string{"apt-get", "microk8s"},
+	}
+	if !facts.IsLike("debian") || !facts.IsLike("ubuntu") || facts.IsLike("fedora") {
+		t.Error("IsLike should follow ID and ID_LIKE")
+	}
+	if !facts.Has("microk8s") || facts.Has("k3s") {
+		t.Error("Has should report probed commands")
+	}
+	if got := facts.Describe(); got != "Ubuntu 24.04.1 LTS (x86_64, systemd, apt)" {
+		t.Errorf("Describe = %q", got)
+	}
+	if got := (&Facts{}).Describe(); got != "unknown platform" {
+		t.Errorf("Describe of nothing = %q", got)
+	}
+}
+
+func TestProbeFactsLocally(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("probes with the local executor, which runs commands with sh")
+	}
+	facts, err := ProbeFacts(context.Background(), NewLocalExecutor(SudoNone))
+	if err != nil {
+		t.Fatalf("ProbeFacts: %v", err)
+	}
+	if facts.Kernel == "" || facts.Arch == "" || facts.Init == "" || facts.ProbedAt.IsZero() {
+		t.Errorf("incomplete facts %+v", facts)
+	}
+	if runtime.GOOS == "linux" && facts.Kernel != "Linux" {
+		t.Errorf("kernel = %q on linux", facts.Kernel)
+	}
+}
+
+func TestSessionFactsCache(t *testing.T) {
+	setTempHome(t)
+	file, err := sessionFilePath("lab")
+	if err != nil {
+		t.Fatalf("sessionFilePath: %v", err)
+	}
+	if err := writeSessionData(file, SSHSessionConfig{Name: "lab", Host: "lab.example", User: "admin"}); err != nil {
+		t.Fatalf("write session: %v", err)
+	}
+
+	alpine := &Facts{OS: OSRelease{ID: "alpine"}, PackageManager: "apk", ProbedAt: time.Now()}
+	if err := saveSessionFacts("lab", "other.example", "admin", alpine); err != nil {
+		t.Fatalf("saveSessionFacts: %v", err)
+	}
+	if data, _ := loadSessionDataFromFile(file); data.Facts != nil {
+		t.Fatal("facts probed on another host must not be cached with this session")
+	}
+
+	if err := saveSessionFacts("lab", "lab.example", "admin", alpine); err != nil {
+		t.Fatalf("saveSessionFacts: %v", err)
+	}
+
+	// Never connected: the facts can only come from the session cache.
+	session := &SSHSession{Name: "lab", Host: "lab.example", User: "admin"}
+	facts, err := session.Facts(context.Background())
+	if err != nil {
+		t.Fatalf("Facts: %v", err)
+	}
+	if facts.OS.ID != "alpine" || facts.PackageManager != "apk" {
+		t.Errorf("unexpected cached facts %+v", facts)
+	}
+
+	stranger := &SSHSession{Name: "lab", Host: "lab.example", User: "root"}
+	if _, err := stranger.Facts(context.Background()); err == nil || !strings.Contains(err.Error(), "probe platform facts") {
+		t.Errorf("expected another user to probe afresh, got %v", err)
+	}
+
+	if err := session.ForgetFacts(); err != nil {
+		t.Fatalf("ForgetFacts: %v", err)
+	}
+	if data, _ := loadSessionDataFromFile(file); data.Facts != nil {
+		t.Errorf("expected ForgetFacts to drop the cached facts, got %+v", data.Facts)
+	}
+	if _, err := session.Facts(context.Background()); err == nil || !strings.Contains(err.Error(), "probe platform facts") {
+		t.Errorf("expected forgotten facts to be probed again, got %v", err)
+	}
+
+	stale := *alpine
+	stale.ProbedAt = time.Now().Add(-FactsTTL - time.Minute)
+	if err := saveSessionFacts("lab", "lab.example", "admin", &stale); err != nil {
+		t.Fatalf("saveSessionFacts: %v", err)
+	}
+	later := &SSHSession{Name: "lab", Host: "lab.example", User: "admin"}
+	if _, err := later.Facts(context.Background()); err == nil || !strings.Contains(err.Error(), "probe platform facts") {
+		t.Errorf("expected facts older than FactsTTL to be probed again, got %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ForwardSpec is one local port forward: connections to LocalPort on this
+// machine are tunnelled to RemoteHost:RemotePort as seen from the server.
+type ForwardSpec struct {
+	// BindAddress defaults to 127.0.0.1 so forwards are not exposed to the LAN.
+	BindAddress string
+	LocalPort   int
+	RemoteHost  string
+	RemotePort  int
+}
+
+// ParseForwardSpec parses [bind_address:]localport:remotehost:remoteport, the
+// syntax of ssh -L. IPv6 addresses are written in brackets.
+func ParseForwardSpec(spec string) (ForwardSpec, error) {
+	parts, err := splitForwardSpec(spec)
+	if err != nil {
+		return ForwardSpec{}, err
+	}
+
+	var forward ForwardSpec
+	switch len(parts) {
+	case 3:
+	case 4:
+		forward.BindAddress = parts[0]
+		parts = parts[1:]
+	default:
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q (want localport:remotehost:remoteport)", spec)
+	}
+
+	if forward.LocalPort, err = parsePort(parts[0]); err != nil {
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: local %w", spec, err)
+	}
+	if forward.RemoteHost = parts[1]; forward.RemoteHost == "" {
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: remote host is empty", spec)
+	}
+	if forward.RemotePort, err = parsePort(parts[2]); err != nil {
+		return ForwardSpec{}, fmt.Errorf("invalid forward %q: remote %w", spec, err)
+	}
+	return forward, nil
+}
+
+// splitForwardSpec splits on colons outside of [brackets].
+func splitForwardSpec(spec string) ([]string, error) {
+	var parts []string
+	var current strings.Builder
+	bracketed := false
+	for _, r := range spec {
+		switch {
+		case r == '[' && !bracketed:
+			bracketed = true
+		case r == ']' && bracketed:
+			bracketed = false
+		case r == ':' && !bracketed:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if bracketed {
+		return nil, fmt.Errorf("invalid forward %q: unclosed [", spec)
+	}
+	return append(parts, current.String()), nil
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %q must be between 1 and 65535", value)
+	}
+	return port, nil
+}
+
+// LocalAddr is the address the forward listens on.
+func (f ForwardSpec) LocalAddr() string {
+	bind := f.BindAddress
+	if bind == "" {
+		bind = "127.0.0.1"
+	}
+	return net.JoinHostPort(bind, strconv.Itoa(f.LocalPort))
+}
+
+// RemoteAddr is the address the server dials for each connection.
+func (f ForwardSpec) RemoteAddr() string {
+	return net.JoinHostPort(f.RemoteHost, strconv.Itoa(f.RemotePort))
+}
+
+func (f ForwardSpec) String() string {
+	return f.LocalAddr() + " -> " + f.RemoteAddr()
+}
+
+// ForwardEvent is reported when a forwarded connection opens and again when
+// it closes, with the bytes copied in each direction.
+type ForwardEvent struct {
+	Spec ForwardSpec
+	// ID numbers connections across all forwards, starting at 1.
+	ID   int
+	Peer string
+	// Sent counts bytes from the local client to the remote service.
+	Sent     int64
+	Received int64
+	Closed   bool
+	// Err is set when the server could not reach the remote address.
+	Err error
+}
+
+// Forward listens on every spec and tunnels each accepted connection through
+// the session until ctx is cancelled. All listeners are bound before Forward
+// starts accepting, so a port that is already in use fails the whole call.
+// On cancellation the listeners are closed, open tunnels are torn down and
+// Forward returns nil once every connection has reported its close event.
+func (s *SSHSession) Forward(ctx context.Context, specs []ForwardSpec, onEvent func(ForwardEvent)) error {
+	if len(specs) == 0 {
+		return errors.New("no forwards given")
+	}
+
+	var listeners []net.Listener
+	for _, spec := range specs {
+		listener, err := net.Listen("tcp", spec.LocalAddr())
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("listen on %s: %w", spec.LocalAddr(), err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	f := newForwarder(ctx, s, onEvent)
+	handlers := make([]func(net.Conn), len(specs))
+	for i, spec := range specs {
+		handlers[i] = func(conn net.Conn) { f.tunnel(conn, spec) }
+	}
+	return f.run(listeners, handlers)
+}
+
+type forwarder struct {
+	session *SSHSession
+	ctx     context.Context
+	onEvent func(ForwardEvent)
+
+	nextID atomic.Int64
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	events sync.Mutex
+}
+
+func newForwarder(ctx context.Context, session *SSHSession, onEvent func(ForwardEvent)) *forwarder {
+	if onEvent == nil {
+		onEvent = func(ForwardEvent) {}
+	}
+	return &forwarder{session: session, ctx: ctx, onEvent: onEvent, conns: map[net.Conn]struct{}{}}
+}
+
+// run accepts on each listener, passing connections to the matching handler,
+// until ctx is cancelled or a listener fails. It then closes the listeners,
+// tears down open connections and waits for their handlers to return.
+func (f *forwarder) run(listeners []net.Listener, handlers []func(net.Conn)) error {
+	errs := make(chan error, len(listeners))
+	for i, listener := range listeners {
+		go func() { errs <- f.serve(listener, handlers[i]) }()
+	}
+
+	var err error
+	select {
+	case <-f.ctx.Done():
+	case err = <-errs:
+	}
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	f.closeAll()
+	f.wg.Wait()
+	return err
+}
+
+func (f *forwarder) serve(listener net.Listener, handle func(net.Conn)) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if f.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("accept on %s: %w", listener.Addr(), err)
+		}
+		if !f.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer f.untrack(conn)
+			handle(conn)
+		}()
+	}
+}
+
+func (f *forwarder) tunnel(local net.Conn, spec ForwardSpec) {
+	event := f.open(local, spec)
+	remote, err := f.dial(spec.RemoteAddr())
+	if err != nil {
+		f.fail(event, err)
+		return
+	}
+	f.relay(local, remote, event)
+}
+
+// open numbers a new connection and reports it.
+func (f *forwarder) open(local net.Conn, spec ForwardSpec) ForwardEvent {
+	event := f.event(local, spec)
+	f.report(event)
+	return event
+}
+
+func (f *forwarder) event(local net.Conn, spec ForwardSpec) ForwardEvent {
+	return ForwardEvent{Spec: spec, ID: int(f.nextID.Add(1)), Peer: local.RemoteAddr().String()}
+}
+
+func (f *forwarder) fail(event ForwardEvent, err error) {
+	event.Closed, event.Err = true, err
+	f.report(event)
+}
+
+// relay copies between local and remote until both directions are done,
+// then reports the byte counts.
+func (f *forwarder) relay(local, remote net.Conn, event ForwardEvent) {
+	if !f.track(remote) {
+		remote.Close()
+		event.Closed = true
+		f.report(event)
+		return
+	}
+	defer f.untrack(remote)
+
+	var sent, received atomic.Int64
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		defer copies.Done()
+		pipe(remote, local, &sent)
+	}()
+	go func() {
+		defer copies.Done()
+		pipe(local, remote, &received)
+	}()
+	copies.Wait()
+
+	event.Sent, event.Received, event.Closed = sent.Load(), received.Load(), true
+	f.report(event)
+}
+
+// dial opens a direct-tcpip channel from the server, re-dialing the session
+// first if it dropped and a reconnect policy is set.
+func (f *forwarder) dial(addr string) (net.Conn, error) {
+	if err := f.session.ensureConnected(f.ctx); err != nil {
+		return nil, err
+	}
+	client, err := f.session.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", addr)
+}
+
+// pipe copies src to dst, then half-closes dst so the other side sees EOF
+// while replies can still flow back.
+func pipe(dst, src net.Conn, counter *atomic.Int64) {
+	io.Copy(&countingWriter{w: dst, n: counter}, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// track registers an open connection so shutdown can close it. It reports
+// false once shutdown has started.
+func (f *forwarder) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *forwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+	conn.Close()
+}
+
+func (f *forwarder) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// report serialises events so callers need no locking of their own.
+func (f *forwarder) report(event ForwardEvent) {
+	f.events.Lock()
+	defer f.events.Unlock()
+	f.onEvent(event)
+}
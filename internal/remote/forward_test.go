@@ -0,0 +1,166 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ForwardSpec
+		wantErr bool
+	}{
+		{spec: "3000:localhost:3000", want: ForwardSpec{LocalPort: 3000, RemoteHost: "localhost", RemotePort: 3000}},
+		{spec: "0.0.0.0:8080:10.0.0.5:80", want: ForwardSpec{BindAddress: "0.0.0.0", LocalPort: 8080, RemoteHost: "10.0.0.5", RemotePort: 80}},
+		{spec: "9090:[::1]:9090", want: ForwardSpec{LocalPort: 9090, RemoteHost: "::1", RemotePort: 9090}},
+		{spec: "3000:localhost", wantErr: true},
+		{spec: "0:localhost:80", wantErr: true},
+		{spec: "3000::80", wantErr: true},
+		{spec: "3000:localhost:http", wantErr: true},
+		{spec: "3000:[::1:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseForwardSpec(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseForwardSpec: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("formats addresses", func(t *testing.T) {
+		spec := ForwardSpec{LocalPort: 9090, RemoteHost: "::1", RemotePort: 9090}
+		if got, want := spec.String(), "127.0.0.1:9090 -> [::1]:9090"; got != want {
+			t.Fatalf("String() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSessionForward(t *testing.T) {
+	session := newTestSession(t, startForwardingServer(t, "secret"))
+
+	// The service the server exposes on its loopback: echo with a prefix.
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				conn.Write(append([]byte("echo:"), data...))
+			}()
+		}
+	}()
+	servicePort := service.Addr().(*net.TCPAddr).Port
+
+	spec := ForwardSpec{LocalPort: freePort(t), RemoteHost: "127.0.0.1", RemotePort: servicePort}
+
+	var mu sync.Mutex
+	var closed []ForwardEvent
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Forward(ctx, []ForwardSpec{spec}, func(event ForwardEvent) {
+			if event.Closed {
+				mu.Lock()
+				closed = append(closed, event)
+				mu.Unlock()
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialWithRetry(spec.LocalAddr())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("ping"))
+			conn.(*net.TCPConn).CloseWrite()
+			reply, _ := io.ReadAll(conn)
+			if string(reply) != "echo:ping" {
+				t.Errorf("reply = %q, want %q", reply, "echo:ping")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A connection still open at shutdown is torn down, not leaked.
+	idle, err := dialWithRetry(spec.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Forward: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Forward did not stop after cancellation")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(closed) != 4 {
+		t.Fatalf("expected 4 close events, got %d: %+v", len(closed), closed)
+	}
+	for _, event := range closed[:3] {
+		if event.Sent != 4 || event.Received != 9 || event.Err != nil {
+			t.Fatalf("unexpected byte counts: %+v", event)
+		}
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// dialWithRetry waits for a forward's listener to come up.
+func dialWithRetry(addr string) (net.Conn, error) {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil || time.Now().After(deadline) {
+			return conn, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,312 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultKeepaliveInterval is used when a session does not configure one.
+const DefaultKeepaliveInterval = 30 * time.Second
+
+const (
+	keepaliveRequest   = "keepalive@openssh.com"
+	keepaliveMaxMissed = 3
+	// probeTimeout bounds the keepalive used to check a suspect connection.
+	probeTimeout = 5 * time.Second
+)
+
+// ErrConnectionLost reports that the SSH transport died and could not be restored.
+var ErrConnectionLost = errors.New("ssh connection lost")
+
+var errKeepaliveTimeout = errors.New("keepalive timed out")
+
+// reconnectSleep waits out the backoff between reconnect attempts.
+var reconnectSleep = time.Sleep
+
+// ReconnectPolicy enables re-dialing a dropped session with the credentials
+// it was opened with. Zero fields fall back to DefaultReconnectPolicy.
+type ReconnectPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultReconnectPolicy retries for roughly a minute before giving up.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultReconnectPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultReconnectPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	return p
+}
+
+// ReconnectEvent is passed to OnReconnect before each attempt, and once more
+// with Reconnected set when the session is back.
+type ReconnectEvent struct {
+	Attempt     int
+	MaxAttempts int
+	Delay       time.Duration
+	// Err is why the previous connection or attempt failed.
+	Err         error
+	Reconnected bool
+}
+
+// transport watches one ssh.Client: done closes when the connection dies.
+type transport struct {
+	done     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (t *transport) alive() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *transport) close() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
+
+// watchTransport tracks the lifetime of client and, when interval is
+// positive, sends keepalives. After keepaliveMaxMissed unanswered keepalives
+// the client is closed so pending calls fail instead of hanging.
+func watchTransport(client *ssh.Client, interval time.Duration) *transport {
+	t := &transport{done: make(chan struct{}), stop: make(chan struct{})}
+
+	go func() {
+		client.Wait()
+		close(t.done)
+	}()
+
+	if interval <= 0 {
+		return t
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		missed := 0
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-t.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if err := sendKeepalive(client, interval); err != nil {
+				missed++
+				if missed >= keepaliveMaxMissed {
+					client.Close()
+					return
+				}
+				continue
+			}
+			missed = 0
+		}
+	}()
+	return t
+}
+
+// sendKeepalive asks the server for a reply. Any reply, even a refusal,
+// proves the transport is alive.
+func sendKeepalive(client *ssh.Client, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest(keepaliveRequest, true, nil)
+		result <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return errKeepaliveTimeout
+	}
+}
+
+// Alive reports whether the transport is still up, without a round trip.
+func (s *SSHSession) Alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transport == nil {
+		// A daemon-backed session is as alive as the daemon's connection,
+		// which the daemon re-dials itself.
+		return s.Client != nil || s.daemon != nil
+	}
+	return s.transport.alive()
+}
+
+// connectionLost reports whether err came from a dead transport rather than
+// from the remote command. A suspect connection is probed and, if it does not
+// answer, closed.
+func (s *SSHSession) connectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+	if s.daemon != nil {
+		return errors.Is(err, ErrConnectionLost)
+	}
+	if !s.Alive() {
+		return true
+	}
+
+	client, err := s.client()
+	if err != nil {
+		return true
+	}
+	if probeErr := sendKeepalive(client, probeTimeout); probeErr != nil {
+		client.Close()
+		return true
+	}
+	return false
+}
+
+// ensureConnected re-dials a dead session before a command is started, when
+// a reconnect policy is set.
+func (s *SSHSession) ensureConnected(ctx context.Context) error {
+	if s.Reconnect == nil || s.Alive() {
+		return nil
+	}
+	return s.reconnect(ctx, ErrConnectionLost)
+}
+
+// reconnect re-dials the session with its cached credentials, backing off
+// between attempts, and swaps in the new connection.
+func (s *SSHSession) reconnect(ctx context.Context, cause error) error {
+	if s.Reconnect == nil {
+		return fmt.Errorf("%w: %v", ErrConnectionLost, cause)
+	}
+	if s.daemon != nil {
+		// The daemon re-dials a dead connection on the next request.
+		return nil
+	}
+
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+	if s.Alive() {
+		return nil
+	}
+
+	policy := s.Reconnect.withDefaults()
+	delay := policy.InitialBackoff
+	lastErr := cause
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrConnectionLost, context.Cause(ctx))
+		}
+		s.notifyReconnect(ReconnectEvent{Attempt: attempt, MaxAttempts: policy.MaxAttempts, Delay: delay, Err: lastErr})
+		reconnectSleep(delay)
+
+		fresh, err := newSSHSession(s.dialOpts)
+		if err == nil {
+			s.adopt(fresh)
+			s.notifyReconnect(ReconnectEvent{Attempt: attempt, MaxAttempts: policy.MaxAttempts, Reconnected: true})
+			return nil
+		}
+
+		lastErr = err
+		delay *= 2
+		if delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+	return fmt.Errorf("%w: gave up after %d reconnect attempts: %v", ErrConnectionLost, policy.MaxAttempts, lastErr)
+}
+
+// adopt replaces the dead connection with the one held by fresh.
+func (s *SSHSession) adopt(fresh *SSHSession) {
+	s.mu.Lock()
+	oldClient, oldJumps, oldTransport := s.Client, s.Jumps, s.transport
+
+	fresh.mu.Lock()
+	s.Client, s.Jumps, s.transport = fresh.Client, fresh.Jumps, fresh.transport
+	fresh.Client, fresh.Jumps, fresh.transport = nil, nil, nil
+	fresh.mu.Unlock()
+	s.mu.Unlock()
+
+	if oldTransport != nil {
+		oldTransport.close()
+	}
+	if oldClient != nil {
+		oldClient.Close()
+	}
+	closeJumps(oldJumps)
+}
+
+func (s *SSHSession) notifyReconnect(event ReconnectEvent) {
+	if s.OnReconnect != nil {
+		s.OnReconnect(event)
+	}
+}
+
+// client returns the SSH connection, dialing it on first use for sessions
+// loaded through the daemon. It fails with the error of that dial, or with
+// ErrConnectionLost when there is no connection.
+func (s *SSHSession) client() (*ssh.Client, error) {
+	s.mu.Lock()
+	client, dial := s.Client, s.dialDirect
+	s.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	if dial == nil {
+		return nil, ErrConnectionLost
+	}
+
+	s.directOnce.Do(func() {
+		fresh, err := dial()
+		if err != nil {
+			s.mu.Lock()
+			s.directErr = fmt.Errorf("connect to %s: %w", s.Name, err)
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Lock()
+		s.dialOpts = fresh.dialOpts
+		s.mu.Unlock()
+		s.adopt(fresh)
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.Client != nil:
+		return s.Client, nil
+	case s.directErr != nil:
+		return nil, s.directErr
+	default:
+		return nil, ErrConnectionLost
+	}
+}
@@ -0,0 +1,156 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyWithDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ReconnectPolicy
+		want   ReconnectPolicy
+	}{
+		{name: "zero value", policy: ReconnectPolicy{}, want: DefaultReconnectPolicy},
+		{
+			name:   "keeps configured attempts",
+			policy: ReconnectPolicy{MaxAttempts: 2},
+			want:   ReconnectPolicy{MaxAttempts: 2, InitialBackoff: time.Second, MaxBackoff: 30 * time.Second},
+		},
+		{
+			name:   "max backoff never below initial",
+			policy: ReconnectPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Second},
+			want:   ReconnectPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.withDefaults(); got != tt.want {
+				t.Errorf("withDefaults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	originalSleep := reconnectSleep
+	t.Cleanup(func() { reconnectSleep = originalSleep })
+	var delays []time.Duration
+	reconnectSleep = func(d time.Duration) { delays = append(delays, d) }
+
+	server := startForwardingServer(t, "secret")
+	opts := testSessionOptions(t, server, "secret")
+
+	t.Run("RunIdempotent re-dials a dropped connection", func(t *testing.T) {
+		delays = nil
+		session, err := NewSSHSession(opts)
+		if err != nil {
+			t.Fatalf("NewSSHSession: %v", err)
+		}
+		defer session.Close()
+
+		var events []ReconnectEvent
+		session.Reconnect = &ReconnectPolicy{MaxAttempts: 3}
+		session.OnReconnect = func(event ReconnectEvent) { events = append(events, event) }
+
+		server.dropConnections()
+		waitForDeadTransport(t, session)
+
+		output, err := session.RunIdempotent(context.Background(), "uptime")
+		if err != nil {
+			t.Fatalf("RunIdempotent: %v", err)
+		}
+		if output != "uptime" {
+			t.Fatalf("expected echoed command, got %q", output)
+		}
+		if len(events) != 2 || events[0].Attempt != 1 || !events[1].Reconnected {
+			t.Fatalf("expected one attempt then success, got %+v", events)
+		}
+		if !session.Alive() {
+			t.Fatalf("expected reconnected session to be alive")
+		}
+	})
+
+	t.Run("Run fails without a reconnect policy", func(t *testing.T) {
+		session, err := NewSSHSession(opts)
+		if err != nil {
+			t.Fatalf("NewSSHSession: %v", err)
+		}
+		defer session.Close()
+
+		server.dropConnections()
+		waitForDeadTransport(t, session)
+
+		if _, err := session.Run("uptime"); err == nil {
+			t.Fatalf("expected error on dropped connection")
+		}
+	})
+
+	t.Run("gives up after MaxAttempts with growing backoff", func(t *testing.T) {
+		delays = nil
+		original := newSSHSession
+		t.Cleanup(func() { newSSHSession = original })
+		dials := 0
+		newSSHSession = func(SessionOptions) (*SSHSession, error) {
+			dials++
+			return nil, errors.New("connection refused")
+		}
+
+		dead := &transport{done: make(chan struct{}), stop: make(chan struct{})}
+		close(dead.done)
+		session := &SSHSession{
+			transport: dead,
+			Reconnect: &ReconnectPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second},
+		}
+
+		err := session.ensureConnected(context.Background())
+		if !errors.Is(err, ErrConnectionLost) {
+			t.Fatalf("expected ErrConnectionLost, got %v", err)
+		}
+		if dials != 4 {
+			t.Fatalf("expected 4 dials, got %d", dials)
+		}
+		want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+		for i := range want {
+			if delays[i] != want[i] {
+				t.Fatalf("expected delays %v, got %v", want, delays)
+			}
+		}
+	})
+}
+
+func waitForDeadTransport(t *testing.T, session *SSHSession) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for session.Alive() {
+		if time.Now().After(deadline) {
+			t.Fatalf("transport did not notice the dropped connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionClientReportsDialError(t *testing.T) {
+	if _, err := (&SSHSession{}).client(); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost without a connection, got %v", err)
+	}
+
+	dials := 0
+	session := &SSHSession{Name: "lab", dialDirect: func() (*SSHSession, error) {
+		dials++
+		return nil, errors.New("host key for lab.example:22 is not trusted")
+	}}
+	for i := 0; i < 2; i++ {
+		if _, err := session.client(); err == nil || !strings.Contains(err.Error(), "connect to lab: host key for lab.example:22 is not trusted") {
+			t.Fatalf("expected the dial error, got %v", err)
+		}
+	}
+	if dials != 1 {
+		t.Fatalf("expected one dial, got %d", dials)
+	}
+}
@@ -0,0 +1,469 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPromptFunc asks the user whether an unknown host key should be trusted.
+type HostKeyPromptFunc func(hostname string, key ssh.PublicKey) (bool, error)
+
+// HostKeyPrompt is consulted when a server presents a key that is not yet in
+// known_hosts. Accepted keys are appended to the file. A nil prompt rejects
+// unknown hosts.
+var HostKeyPrompt HostKeyPromptFunc
+
+// HostKeyChangedError reports a server key that no longer matches known_hosts.
+type HostKeyChangedError struct {
+	Host  string
+	Key   ssh.PublicKey
+	Known []knownhosts.KnownKey
+}
+
+func (e *HostKeyChangedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "host key changed for %s: server offered %s %s", e.Host, e.Key.Type(), ssh.FingerprintSHA256(e.Key))
+	for _, known := range e.Known {
+		fmt.Fprintf(&b, "; %s:%d expects %s %s", known.Filename, known.Line, known.Key.Type(), ssh.FingerprintSHA256(known.Key))
+	}
+	fmt.Fprintf(&b, " (if the change is expected, run 'labman hosts forget %s')", stripDefaultPort(e.Host))
+	return b.String()
+}
+
+// KnownHostEntry describes one known_hosts line that matches a host.
+type KnownHostEntry struct {
+	Line        int
+	Marker      string
+	KeyType     string
+	Fingerprint string
+}
+
+var errHostKeyCaptured = errors.New("host key captured")
+
+// trustOnFirstUse verifies host keys against known_hosts, asking prompt about
+// hosts that have no entry yet. Mismatches are reported as *HostKeyChangedError.
+func trustOnFirstUse(knownHostsPath string, prompt HostKeyPromptFunc) (ssh.HostKeyCallback, error) {
+	path, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureKnownHostsFile(path); err != nil {
+		return nil, err
+	}
+
+	callback, err := hostKeyCallback(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		authorities := hostAuthorities(path, hostname)
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if isHostAuthority(authorities, cert.SignatureKey) {
+				if err := callback(hostname, remote, cert); err != nil {
+					return fmt.Errorf("host certificate for %s rejected: %w", hostname, err)
+				}
+				return nil
+			}
+			// Like ssh, a certificate from an unknown CA is checked as a
+			// plain key.
+			key = cert.Key
+		}
+
+		err := callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if known := recordedHostKeys(keyErr.Want, authorities); len(known) > 0 {
+			return &HostKeyChangedError{Host: hostname, Key: key, Known: known}
+		}
+
+		if prompt == nil {
+			return fmt.Errorf("host key for %s is not trusted (run 'labman hosts trust %s')", hostname, stripDefaultPort(hostname))
+		}
+		accepted, err := prompt(hostname, key)
+		if err != nil {
+			return fmt.Errorf("confirm host key: %w", err)
+		}
+		if !accepted {
+			return fmt.Errorf("host key for %s was not accepted", hostname)
+		}
+		return appendKnownHost(path, hostname, key)
+	}, nil
+}
+
+// certHostKeyAlgorithms are asked for first when a @cert-authority line
+// covers the host.
+var certHostKeyAlgorithms = []string{
+	ssh.CertAlgoED25519v01,
+	ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01,
+	ssh.CertAlgoECDSA521v01,
+	ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSASHA256v01,
+}
+
+// knownHostAlgorithms returns the key algorithms already recorded for addr so
+// the server is asked for a key we can actually verify, preceded by the
+// certificate algorithms when a @cert-authority line covers addr. It returns
+// nil when the host is unknown, leaving algorithm selection to the defaults.
+func knownHostAlgorithms(knownHostsPath, addr string) []string {
+	algorithms := knownKeyAlgorithms(knownHostsPath, addr)
+	if len(hostAuthorities(knownHostsPath, addr)) == 0 {
+		return algorithms
+	}
+	if len(algorithms) == 0 {
+		algorithms = defaultHostKeyAlgorithms
+	}
+	return append(slices.Clone(certHostKeyAlgorithms), algorithms...)
+}
+
+// knownKeyAlgorithms returns the algorithms of the plain keys recorded for addr.
+func knownKeyAlgorithms(knownHostsPath, addr string) []string {
+	callback, err := hostKeyCallback(knownHostsPath)
+	if err != nil {
+		return nil
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probeKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	err = callback(addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey)
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	seen := map[string]bool{}
+	for _, known := range recordedHostKeys(keyErr.Want, hostAuthorities(knownHostsPath, addr)) {
+		candidates := []string{known.Key.Type()}
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			candidates = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algo := range candidates {
+			if !seen[algo] {
+				seen[algo] = true
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+	return algorithms
+}
+
+// FetchHostKey connects to addr just long enough to read the server's host key.
+func FetchHostKey(addr string, timeout time.Duration) (ssh.PublicKey, error) {
+	var captured ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "labman",
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			captured = key
+			return errHostKeyCaptured
+		},
+		Timeout: timeout,
+	}
+
+	client, err := ssh.Dial("tcp", addr, config)
+	if client != nil {
+		client.Close()
+	}
+	if captured != nil {
+		return captured, nil
+	}
+	return nil, fmt.Errorf("fetch host key from %s: %w", addr, err)
+}
+
+// TrustHostKey records key for addr in known_hosts. Existing entries are left
+// untouched; a conflicting entry is reported as *HostKeyChangedError.
+func TrustHostKey(knownHostsPath, addr string, key ssh.PublicKey) (added bool, err error) {
+	path, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return false, err
+	}
+	if err := ensureKnownHostsFile(path); err != nil {
+		return false, err
+	}
+
+	callback, err := hostKeyCallback(path)
+	if err != nil {
+		return false, err
+	}
+
+	err = callback(addr, &net.TCPAddr{IP: net.IPv4zero}, key)
+	if err == nil {
+		return false, nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return false, err
+	}
+	if known := recordedHostKeys(keyErr.Want, hostAuthorities(path, addr)); len(known) > 0 {
+		return false, &HostKeyChangedError{Host: addr, Key: key, Known: known}
+	}
+
+	if err := appendKnownHost(path, addr, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ForgetHost removes every known_hosts entry for addr, including hashed ones.
+func ForgetHost(knownHostsPath, addr string) (int, error) {
+	path, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read known hosts: %w", err)
+	}
+
+	host := knownhosts.Normalize(addr)
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, hosts, _, _, _, err := ssh.ParseKnownHosts([]byte(line)); err == nil && hostsMatch(hosts, host) {
+			removed++
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read known hosts: %w", err)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := os.WriteFile(path, kept.Bytes(), 0o600); err != nil {
+		return 0, fmt.Errorf("write known hosts: %w", err)
+	}
+	return removed, nil
+}
+
+// KnownHostEntries lists the known_hosts lines recorded for addr.
+func KnownHostEntries(knownHostsPath, addr string) ([]KnownHostEntry, error) {
+	path, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open known hosts: %w", err)
+	}
+	defer file.Close()
+
+	host := knownhosts.Normalize(addr)
+	var entries []KnownHostEntry
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
+		if err != nil || !hostsMatch(hosts, host) {
+			continue
+		}
+		entries = append(entries, KnownHostEntry{
+			Line:        lineNum,
+			Marker:      marker,
+			KeyType:     key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read known hosts: %w", err)
+	}
+	return entries, nil
+}
+
+// hostAuthorities returns the CA keys of the @cert-authority lines whose
+// host patterns match addr.
+func hostAuthorities(knownHostsPath, addr string) []ssh.PublicKey {
+	path, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	host := knownhosts.Normalize(addr)
+	var authorities []ssh.PublicKey
+	for len(data) > 0 {
+		marker, hosts, key, _, rest, err := ssh.ParseKnownHosts(data)
+		if err != nil {
+			break
+		}
+		data = rest
+		if marker == "cert-authority" && hostPatternsMatch(hosts, host) {
+			authorities = append(authorities, key)
+		}
+	}
+	return authorities
+}
+
+func isHostAuthority(authorities []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, authority := range authorities {
+		if bytes.Equal(authority.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedHostKeys drops the @cert-authority entries that knownhosts lists
+// among the keys it expected for a host.
+func recordedHostKeys(known []knownhosts.KnownKey, authorities []ssh.PublicKey) []knownhosts.KnownKey {
+	var keys []knownhosts.KnownKey
+	for _, entry := range known {
+		if !isHostAuthority(authorities, entry.Key) {
+			keys = append(keys, entry)
+		}
+	}
+	return keys
+}
+
+// hostPatternsMatch applies known_hosts pattern rules: * and ? wildcards, and
+// a matching !pattern excludes the host.
+func hostPatternsMatch(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if !wildcardMatch(strings.TrimPrefix(pattern, "!"), host) && !hashedHostMatches(pattern, host) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// wildcardMatch matches s against a pattern where * is any run of characters
+// and ? is any single character.
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+func appendKnownHost(path, addr string, key ssh.PublicKey) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open known hosts: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)); err != nil {
+		return fmt.Errorf("write known hosts: %w", err)
+	}
+	return nil
+}
+
+func ensureKnownHostsFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create known hosts directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("create known hosts: %w", err)
+	}
+	return file.Close()
+}
+
+// hostsMatch reports whether a known_hosts host list names host exactly,
+// either in plain text or as a hashed |1|salt|hash entry.
+func hostsMatch(hosts []string, host string) bool {
+	for _, candidate := range hosts {
+		if candidate == host || hashedHostMatches(candidate, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashedHostMatches(entry, host string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+func stripDefaultPort(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && port == "22" {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,298 @@
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestTrustOnFirstUse(t *testing.T) {
+	remoteAddr := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+	t.Run("prompts for unknown host and records accepted key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+		key := newTestPublicKey(t)
+
+		prompted := ""
+		callback, err := trustOnFirstUse(path, func(hostname string, _ ssh.PublicKey) (bool, error) {
+			prompted = hostname
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+
+		if err := callback("lab.example:22", remoteAddr, key); err != nil {
+			t.Fatalf("expected unknown key to be accepted, got %v", err)
+		}
+		if prompted != "lab.example:22" {
+			t.Fatalf("expected prompt for lab.example:22, got %q", prompted)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read known_hosts: %v", err)
+		}
+		want := knownhosts.Line([]string{"lab.example"}, key)
+		if strings.TrimSpace(string(data)) != want {
+			t.Fatalf("expected known_hosts line %q, got %q", want, string(data))
+		}
+	})
+
+	t.Run("rejects unknown host when prompt declines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+
+		callback, err := trustOnFirstUse(path, func(string, ssh.PublicKey) (bool, error) {
+			return false, nil
+		})
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+
+		err = callback("lab.example:22", remoteAddr, newTestPublicKey(t))
+		if err == nil || !strings.Contains(err.Error(), "not accepted") {
+			t.Fatalf("expected rejection error, got %v", err)
+		}
+	})
+
+	t.Run("rejects unknown host without a prompt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+
+		callback, err := trustOnFirstUse(path, nil)
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+
+		err = callback("lab.example:22", remoteAddr, newTestPublicKey(t))
+		if err == nil || !strings.Contains(err.Error(), "labman hosts trust lab.example") {
+			t.Fatalf("expected trust hint, got %v", err)
+		}
+	})
+
+	t.Run("reports changed host key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		writeKnownHostsLines(t, path, knownhosts.Line([]string{"lab.example"}, newTestPublicKey(t)))
+
+		callback, err := trustOnFirstUse(path, func(string, ssh.PublicKey) (bool, error) {
+			t.Fatalf("prompt must not run for a changed key")
+			return false, nil
+		})
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+
+		err = callback("lab.example:22", remoteAddr, newTestPublicKey(t))
+		var changed *HostKeyChangedError
+		if !errors.As(err, &changed) {
+			t.Fatalf("expected HostKeyChangedError, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "host key changed for lab.example:22") {
+			t.Fatalf("unexpected error text: %v", err)
+		}
+	})
+}
+
+func TestForgetHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key := newTestPublicKey(t)
+	other := knownhosts.Line([]string{"other.example"}, newTestPublicKey(t))
+	writeKnownHostsLines(t, path,
+		knownhosts.Line([]string{"lab.example"}, key),
+		knownhosts.Line([]string{knownhosts.HashHostname("lab.example")}, key),
+		other,
+	)
+
+	removed, err := ForgetHost(path, "lab.example:22")
+	if err != nil {
+		t.Fatalf("ForgetHost: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 entries removed, got %d", removed)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read known_hosts: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != other {
+		t.Fatalf("expected only the other host to remain, got %q", string(data))
+	}
+}
+
+func TestKnownHostEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key := newTestPublicKey(t)
+	writeKnownHostsLines(t, path,
+		"# comment",
+		knownhosts.Line([]string{"other.example"}, newTestPublicKey(t)),
+		knownhosts.Line([]string{"[lab.example]:2222"}, key),
+	)
+
+	entries, err := KnownHostEntries(path, "lab.example:2222")
+	if err != nil {
+		t.Fatalf("KnownHostEntries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Line != 3 || entries[0].Fingerprint != ssh.FingerprintSHA256(key) {
+		t.Fatalf("unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestKnownHostAlgorithms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	writeKnownHostsLines(t, path, knownhosts.Line([]string{"lab.example"}, newTestPublicKey(t)))
+
+	got := knownHostAlgorithms(path, "lab.example:22")
+	if len(got) != 1 || got[0] != ssh.KeyAlgoED25519 {
+		t.Fatalf("expected [%s], got %v", ssh.KeyAlgoED25519, got)
+	}
+
+	if got := knownHostAlgorithms(path, "unknown.example:22"); got != nil {
+		t.Fatalf("expected nil for unknown host, got %v", got)
+	}
+}
+
+func TestHostCertificates(t *testing.T) {
+	remoteAddr := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+	ca := newTestSigner(t)
+	caLine := "@cert-authority *.lab.example,!vault.lab.example " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	hostCert := func(ca ssh.Signer, principals ...string) *ssh.Certificate {
+		return newTestCertificate(t, ca, newTestPublicKey(t), ssh.HostCert, principals, time.Now().Add(time.Hour))
+	}
+
+	tests := []struct {
+		name     string
+		hostname string
+		cert     *ssh.Certificate
+		wantErr  string
+	}{
+		{name: "trusted CA and matching principal", hostname: "nas.lab.example:22", cert: hostCert(ca, "nas.lab.example")},
+		{name: "principal for another host", hostname: "nas.lab.example:22", cert: hostCert(ca, "k8s.lab.example"), wantErr: "host certificate for nas.lab.example:22 rejected"},
+		{name: "user certificate", hostname: "nas.lab.example:22", cert: newTestCertificate(t, ca, newTestPublicKey(t), ssh.UserCert, []string{"nas.lab.example"}, time.Now().Add(time.Hour)), wantErr: "rejected"},
+		{name: "host excluded from the CA", hostname: "vault.lab.example:22", cert: hostCert(ca, "vault.lab.example"), wantErr: "not trusted"},
+		{name: "unknown CA", hostname: "nas.lab.example:22", cert: hostCert(newTestSigner(t), "nas.lab.example"), wantErr: "not trusted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "known_hosts")
+			writeKnownHostsLines(t, path, caLine)
+
+			callback, err := trustOnFirstUse(path, nil)
+			if err != nil {
+				t.Fatalf("trustOnFirstUse: %v", err)
+			}
+			err = callback(tt.hostname, remoteAddr, tt.cert)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected certificate to be accepted, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("certificate from an unknown CA falls back to its key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		cert := hostCert(newTestSigner(t), "nas.lab.example")
+		writeKnownHostsLines(t, path, knownhosts.Line([]string{"nas.lab.example"}, cert.Key))
+
+		callback, err := trustOnFirstUse(path, nil)
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+		if err := callback("nas.lab.example:22", remoteAddr, cert); err != nil {
+			t.Fatalf("expected the recorded key to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("plain key for a host under a CA is unknown, not changed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		writeKnownHostsLines(t, path, caLine)
+
+		callback, err := trustOnFirstUse(path, nil)
+		if err != nil {
+			t.Fatalf("trustOnFirstUse: %v", err)
+		}
+		err = callback("nas.lab.example:22", remoteAddr, newTestPublicKey(t))
+		var changed *HostKeyChangedError
+		if errors.As(err, &changed) || err == nil || !strings.Contains(err.Error(), "not trusted") {
+			t.Fatalf("expected an untrusted host error, got %v", err)
+		}
+	})
+
+	t.Run("asks for certificates first", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		writeKnownHostsLines(t, path, caLine, knownhosts.Line([]string{"nas.lab.example"}, newTestPublicKey(t)))
+
+		got := knownHostAlgorithms(path, "nas.lab.example:22")
+		if len(got) != len(certHostKeyAlgorithms)+1 || got[0] != ssh.CertAlgoED25519v01 || got[len(got)-1] != ssh.KeyAlgoED25519 {
+			t.Fatalf("expected certificate algorithms then %s, got %v", ssh.KeyAlgoED25519, got)
+		}
+		if got := knownHostAlgorithms(path, "k8s.lab.example:22"); len(got) != len(certHostKeyAlgorithms)+len(defaultHostKeyAlgorithms) {
+			t.Fatalf("expected certificate then default algorithms, got %v", got)
+		}
+	})
+}
+
+func TestHostPatternsMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{patterns: []string{"nas.lab.example"}, host: "nas.lab.example", want: true},
+		{patterns: []string{"*.lab.example"}, host: "nas.lab.example", want: true},
+		{patterns: []string{"*.lab.example"}, host: "lab.example", want: false},
+		{patterns: []string{"nas?.lab.example"}, host: "nas1.lab.example", want: true},
+		{patterns: []string{"*.lab.example", "!vault.lab.example"}, host: "vault.lab.example", want: false},
+		{patterns: []string{"!vault.lab.example"}, host: "nas.lab.example", want: false},
+		{patterns: []string{"[nas.lab.example]:2222"}, host: "[nas.lab.example]:2222", want: true},
+		{patterns: []string{"*"}, host: "[nas.lab.example]:2222", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.patterns, ",")+" "+tt.host, func(t *testing.T) {
+			if got := hostPatternsMatch(tt.patterns, tt.host); got != tt.want {
+				t.Fatalf("hostPatternsMatch(%v, %q) = %v, want %v", tt.patterns, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("convert ed25519 key: %v", err)
+	}
+	return key
+}
+
+func writeKnownHostsLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("prepare known_hosts dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+}
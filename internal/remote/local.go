@@ -0,0 +1,331 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// localInterruptGrace is how long a cancelled local command has to exit
+// after SIGINT before it is killed.
+const localInterruptGrace = 5 * time.Second
+
+// LocalExecutor runs commands with sh -c on the machine labman runs on, so
+// maintenance workflows work without an SSH session to localhost.
+type LocalExecutor struct {
+	// Sudo selects how RunSudo gains root. SudoAuto runs commands directly
+	// as root and through sudo -n otherwise; SudoPassword lets sudo prompt
+	// on the terminal.
+	Sudo SudoMode
+	// CommandTimeout bounds every command, like SSHSession.CommandTimeout.
+	CommandTimeout time.Duration
+}
+
+// NewLocalExecutor returns an executor for this machine using sudo mode.
+func NewLocalExecutor(sudo SudoMode) *LocalExecutor {
+	return &LocalExecutor{Sudo: sudo}
+}
+
+// RunContext runs cmd and returns its combined output.
+func (l *LocalExecutor) RunContext(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(l.Exec(ctx, cmd))
+}
+
+// RunIdempotent is RunContext; there is no connection to lose locally.
+func (l *LocalExecutor) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return l.RunContext(ctx, cmd)
+}
+
+// ExecIdempotent is Exec.
+func (l *LocalExecutor) ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error) {
+	return l.Exec(ctx, cmd)
+}
+
+// Exec runs cmd and reports its stdout, stderr, exit status and duration.
+// Like SSHSession.Exec, a failed command returns both the result and a
+// *CommandError, and a nil result means it never started.
+func (l *LocalExecutor) Exec(ctx context.Context, cmd string) (*RunResult, error) {
+	return l.exec(ctx, cmd, l.shell(cmd))
+}
+
+// RunSudo is RunContext for a command that must run as root.
+func (l *LocalExecutor) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(l.ExecSudo(ctx, cmd))
+}
+
+// ExecSudo is Exec for a command that must run as root.
+func (l *LocalExecutor) ExecSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	args, err := l.sudoArgs(cmd)
+	if err != nil {
+		return nil, err
+	}
+	result, err := l.exec(ctx, cmd, args)
+	return result, l.sudoError(err)
+}
+
+// RunStreamContext runs cmd and copies its stdout and stderr to w as they
+// arrive. Failures are reported as *CommandError with the stderr tail.
+func (l *LocalExecutor) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	return l.stream(ctx, cmd, l.shell(cmd), w)
+}
+
+// RunStreamSudo is RunStreamContext for a command that must run as root.
+func (l *LocalExecutor) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	args, err := l.sudoArgs(cmd)
+	if err != nil {
+		return err
+	}
+	return l.sudoError(l.stream(ctx, cmd, args, w))
+}
+
+// Close does nothing; local commands hold no connection.
+func (l *LocalExecutor) Close() error {
+	return nil
+}
+
+func (l *LocalExecutor) shell(cmd string) []string {
+	return []string{"sh", "-c", cmd}
+}
+
+// sudoArgs wraps cmd for the executor's sudo mode.
+func (l *LocalExecutor) sudoArgs(cmd string) ([]string, error) {
+	mode := l.Sudo
+	if mode == SudoAuto {
+		mode = SudoNoPasswd
+		if os.Geteuid() == 0 {
+			mode = SudoNone
+		}
+	}
+
+	switch mode {
+	case SudoNone:
+		return l.shell(cmd), nil
+	case SudoNoPasswd:
+		return append([]string{"sudo", "-n", "--"}, l.shell(cmd)...), nil
+	case SudoPassword:
+		// sudo reads the password from the terminal itself.
+		return append([]string{"sudo", "--"}, l.shell(cmd)...), nil
+	default:
+		return nil, fmt.Errorf("unknown sudo mode %q", l.Sudo)
+	}
+}
+
+func (l *LocalExecutor) sudoError(err error) error {
+	name := "root"
+	if current, userErr := user.Current(); userErr == nil {
+		name = current.Username
+	}
+	return sudoFailure(err, name, "localhost")
+}
+
+// command prepares args to run under ctx bounded by CommandTimeout. When
+// the context ends the command is interrupted, and killed if it is still
+// running localInterruptGrace later.
+func (l *LocalExecutor) command(ctx context.Context, args []string) (context.Context, *exec.Cmd, context.CancelFunc) {
+	ctx, cancel := withCommandTimeout(ctx, l.CommandTimeout)
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	interruptOnCancel(c, args[0] == "sudo" && l.Sudo == SudoPassword)
+	c.WaitDelay = localInterruptGrace
+	return ctx, c, cancel
+}
+
+func (l *LocalExecutor) exec(ctx context.Context, cmd string, args []string) (*RunResult, error) {
+	ctx, c, cancel := l.command(ctx, args)
+	defer cancel()
+
+	var stdout, stderr, combined syncBuffer
+	c.Stdout = io.MultiWriter(&stdout, &combined)
+	c.Stderr = io.MultiWriter(&stderr, &combined)
+
+	start := time.Now()
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run command: %w", err)
+	}
+	waitErr := l.wait(ctx, c)
+
+	result := &RunResult{
+		Command:  cmd,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Output:   combined.String(),
+		Duration: time.Since(start),
+	}
+	if waitErr != nil {
+		return result, fmt.Errorf("failed to run command: %w", localFailure(result, waitErr))
+	}
+	return result, nil
+}
+
+func (l *LocalExecutor) stream(ctx context.Context, cmd string, args []string, w io.Writer) error {
+	ctx, c, cancel := l.command(ctx, args)
+	defer cancel()
+
+	stderrTail := newTailBuffer(stderrTailBytes)
+	out := &lockedWriter{w: w}
+	c.Stdout = out
+	c.Stderr = io.MultiWriter(out, stderrTail)
+
+	start := time.Now()
+	if err := c.Start(); err != nil {
+		return err
+	}
+	if err := l.wait(ctx, c); err != nil {
+		result := &RunResult{Command: cmd, Stderr: stderrTail.String(), Duration: time.Since(start)}
+		return localFailure(result, err)
+	}
+	return nil
+}
+
+// wait reports the command timing out or being cancelled by its cause rather
+// than as the signal that stopped it.
+func (l *LocalExecutor) wait(ctx context.Context, c *exec.Cmd) error {
+	err := c.Wait()
+	if err != nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// localFailure records how a local command ended, like RunResult.fail does
+// for remote ones.
+func localFailure(r *RunResult, err error) *CommandError {
+	r.ExitCode = -1
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		r.ExitCode = exitErr.ExitCode()
+	}
+	return &CommandError{Result: r, Err: err}
+}
+
+// lockedWriter serialises writes from a command's stdout and stderr copiers.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// Upload copies localPath to remotePath on this machine with the same
+// semantics as SSHSession.Upload: permissions and modification times are
+// kept and an existing directory receives the source under its own name.
+func (l *LocalExecutor) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() && !opts.Recursive {
+		return nil, fmt.Errorf("%s is a directory (copy it recursively)", localPath)
+	}
+
+	var stats TransferStats
+	target := localTarget(expandHome(remotePath), filepath.Base(localPath))
+	if !info.IsDir() {
+		return &stats, copyLocalFile(localPath, target, info, opts, &stats)
+	}
+
+	var dirs []dirTimes
+	err = filepath.WalkDir(localPath, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return context.Cause(ctx)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return err
+			}
+			if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTimes{path: dst, modTime: info.ModTime()})
+		case info.Mode().IsRegular():
+			return copyLocalFile(name, dst, info, opts, &stats)
+		default:
+			stats.Skipped = append(stats.Skipped, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return &stats, err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return &stats, err
+		}
+	}
+	return &stats, nil
+}
+
+func copyLocalFile(src, dst string, info fs.FileInfo, opts TransferOptions, stats *TransferStats) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	stats.Files++
+	stats.Bytes += n
+	if opts.Progress != nil {
+		opts.Progress(TransferProgress{Path: dst, Bytes: n, Total: n, Done: true})
+	}
+	return nil
+}
+
+// expandHome resolves a leading ~ the way the remote shell would.
+func expandHome(name string) string {
+	if name != "~" && !strings.HasPrefix(name, "~/") {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, name[1:])
+}
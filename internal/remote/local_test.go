@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the local executor runs commands with sh")
+	}
+	ctx := context.Background()
+	local := NewLocalExecutor(SudoNone)
+
+	t.Run("combined output", func(t *testing.T) {
+		output, err := local.RunContext(ctx, "echo out; echo err >&2")
+		if err != nil || output != "out\nerr\n" {
+			t.Fatalf("RunContext = %q, %v", output, err)
+		}
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		result, err := local.Exec(ctx, "echo broken >&2; exit 3")
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || result.ExitCode != 3 || !strings.Contains(err.Error(), "broken") {
+			t.Fatalf("Exec = %+v, %v", result, err)
+		}
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		result, err := local.Exec(ctx, "labman-no-such-command")
+		if err == nil || !result.CommandNotFound() {
+			t.Fatalf("expected exit 127, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("sudo none runs directly", func(t *testing.T) {
+		output, err := local.RunSudo(ctx, "echo root | tr a-z A-Z")
+		if err != nil || output != "ROOT\n" {
+			t.Fatalf("RunSudo = %q, %v", output, err)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := local.RunStreamContext(ctx, "printf 'no newline'", &out); err != nil {
+			t.Fatalf("RunStreamContext: %v", err)
+		}
+		if out.String() != "no newline" {
+			t.Fatalf("streamed %q", out.String())
+		}
+
+		err := local.RunStreamContext(ctx, "echo gone >&2; exit 1", &out)
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Result.ExitCode != 1 || !strings.Contains(err.Error(), "gone") {
+			t.Fatalf("expected a command error, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		slow := &LocalExecutor{Sudo: SudoNone, CommandTimeout: 100 * time.Millisecond}
+		start := time.Now()
+		_, err := slow.RunContext(ctx, "sleep 5")
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Fatalf("command was not interrupted (took %s)", elapsed)
+		}
+	})
+}
+
+func TestLocalUpload(t *testing.T) {
+	src := t.TempDir()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.MkdirAll(filepath.Join(src, "conf", "nested"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, contents := range map[string]string{"conf/a.yaml": "a: 1\n", "conf/nested/b.yaml": "b: 2\n"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.WriteFile(path, []byte(contents), 0o640); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	local := NewLocalExecutor(SudoNone)
+	dst := t.TempDir()
+
+	if _, err := local.Upload(context.Background(), filepath.Join(src, "conf"), dst, TransferOptions{}); err == nil {
+		t.Fatal("expected a directory to need Recursive")
+	}
+
+	stats, err := local.Upload(context.Background(), filepath.Join(src, "conf"), dst, TransferOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if stats.Files != 2 || stats.Bytes != 10 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	copied := filepath.Join(dst, "conf", "nested", "b.yaml")
+	data, err := os.ReadFile(copied)
+	if err != nil || string(data) != "b: 2\n" {
+		t.Fatalf("read copy: %q, %v", data, err)
+	}
+	info, err := os.Stat(copied)
+	if err != nil {
+		t.Fatalf("stat copy: %v", err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("modification time %s, want %s", info.ModTime(), modTime)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o640 {
+		t.Errorf("mode %v, want 0640", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package remote
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// interruptOnCancel makes cancelling c send SIGINT to everything it started.
+// A command runs in its own process group so the whole pipeline stops, not
+// just sh; one that may prompt for a sudo password stays in labman's group,
+// since only the foreground group can read the terminal.
+func interruptOnCancel(c *exec.Cmd, prompts bool) {
+	if prompts {
+		c.Cancel = func() error { return c.Process.Signal(syscall.SIGINT) }
+		return
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error { return syscall.Kill(-c.Process.Pid, syscall.SIGINT) }
+}
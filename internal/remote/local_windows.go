@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package remote
+
+import "os/exec"
+
+// interruptOnCancel keeps exec's default on Windows, which cannot deliver
+// SIGINT to another process: cancelling c kills it.
+func interruptOnCancel(c *exec.Cmd, prompts bool) {}
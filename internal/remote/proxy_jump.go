@@ -0,0 +1,44 @@
+package remote
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialClient connects to addr directly or, when via is set, through a
+// direct-tcpip channel opened on the bastion's connection.
+func dialClient(addr string, config *ssh.ClientConfig, via *ssh.Client) (*ssh.Client, error) {
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("open tunnel to %s: %w", addr, err)
+	}
+
+	// ssh.Dial applies config.Timeout to the handshake; tunnelled connections
+	// have no deadlines, so close the channel if the handshake stalls.
+	timer := time.AfterFunc(config.Timeout, func() { conn.Close() })
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !timer.Stop() && err != nil {
+		return nil, fmt.Errorf("handshake with %s timed out after %s", addr, config.Timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// closeJumps tears down bastion sessions from the innermost outwards.
+func closeJumps(jumps []*SSHSession) {
+	for i := len(jumps) - 1; i >= 0; i-- {
+		if jumps[i].Client != nil {
+			jumps[i].Client.Close()
+		}
+	}
+}
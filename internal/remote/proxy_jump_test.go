@@ -0,0 +1,354 @@
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewSSHSessionProxyJump(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	target := startForwardingServer(t, "target-secret")
+	bastion := startForwardingServer(t, "bastion-secret")
+
+	hostOptions := func(addr, password string) SessionOptions {
+		host, portText, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("split %s: %v", addr, err)
+		}
+		port, _ := strconv.Atoi(portText)
+		return SessionOptions{
+			Host:           host,
+			Port:           port,
+			User:           "admin",
+			Auth:           AuthOptions{Methods: []string{AuthPassword}, Password: password},
+			HostKeyPolicy:  HostKeyAcceptNew,
+			KnownHostsFile: knownHosts,
+		}
+	}
+
+	t.Run("tunnels the target through the bastion", func(t *testing.T) {
+		opts := hostOptions(target.addr, "target-secret")
+		opts.Jumps = []SessionOptions{hostOptions(bastion.addr, "bastion-secret")}
+
+		session, err := NewSSHSession(opts)
+		if err != nil {
+			t.Fatalf("NewSSHSession: %v", err)
+		}
+		defer session.Close()
+
+		if !session.IsConnected() {
+			t.Fatalf("expected tunnelled session to be connected")
+		}
+		if len(session.Jumps) != 1 || session.Jumps[0].Password != "bastion-secret" {
+			t.Fatalf("expected one authenticated jump session, got %+v", session.Jumps)
+		}
+		if got := bastion.forwarded(); len(got) != 1 || got[0] != target.addr {
+			t.Fatalf("expected bastion to forward to %s, got %v", target.addr, got)
+		}
+	})
+
+	t.Run("reports which jump host failed", func(t *testing.T) {
+		opts := hostOptions(target.addr, "target-secret")
+		opts.Jumps = []SessionOptions{hostOptions(bastion.addr, "wrong")}
+
+		_, err := NewSSHSession(opts)
+		if err == nil {
+			t.Fatalf("expected bastion auth failure")
+		}
+		if want := "jump host " + bastion.addr; !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention %q, got %v", want, err)
+		}
+	})
+}
+
+// testSessionOptions dials server with its password, recording host keys in
+// a temporary known_hosts file.
+func testSessionOptions(t *testing.T, server *forwardingServer, password string) SessionOptions {
+	t.Helper()
+
+	host, portText, err := net.SplitHostPort(server.addr)
+	if err != nil {
+		t.Fatalf("split %s: %v", server.addr, err)
+	}
+	port, _ := strconv.Atoi(portText)
+	return SessionOptions{
+		Host:           host,
+		Port:           port,
+		User:           "admin",
+		Auth:           AuthOptions{Methods: []string{AuthPassword}, Password: password},
+		HostKeyPolicy:  HostKeyAcceptNew,
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}
+}
+
+// newTestSession connects to a server started with password "secret".
+func newTestSession(t *testing.T, server *forwardingServer) *SSHSession {
+	t.Helper()
+
+	session, err := NewSSHSession(testSessionOptions(t, server, "secret"))
+	if err != nil {
+		t.Fatalf("NewSSHSession: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// forwardingServer is a minimal sshd that accepts one password, echoes exec
+// requests back, and honours direct-tcpip requests, which is all a bastion
+// needs to do. It also serves SFTP and sha256sum on the local filesystem.
+type forwardingServer struct {
+	addr string
+	// noSha256sum makes sha256sum exit 127 as on a host without coreutils.
+	noSha256sum bool
+
+	mu      sync.Mutex
+	targets []string
+	conns   []net.Conn
+	signals []string
+	ptys    []string
+}
+
+func (s *forwardingServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.signals...)
+}
+
+// dropConnections cuts every open connection without a clean SSH shutdown.
+func (s *forwardingServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// terminal lists the pty-req and window-change requests, e.g. "pty xterm 80x24".
+func (s *forwardingServer) terminal() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ptys...)
+}
+
+func (s *forwardingServer) forwarded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+func startForwardingServer(t *testing.T, password string) *forwardingServer {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("host signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if string(given) == password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &forwardingServer{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *forwardingServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go s.serveExec(channel, requests)
+		case "direct-tcpip":
+			var payload struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			addr := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				upstream.Close()
+				continue
+			}
+			s.mu.Lock()
+			s.targets = append(s.targets, addr)
+			s.mu.Unlock()
+
+			go ssh.DiscardRequests(requests)
+			go func() {
+				defer channel.Close()
+				defer upstream.Close()
+				go func() {
+					io.Copy(upstream, channel)
+					upstream.(*net.TCPConn).CloseWrite()
+				}()
+				io.Copy(channel, upstream)
+			}()
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+		}
+	}
+}
+
+// serveExec answers an exec request by echoing the command line. The
+// command "block" runs until the client sends a signal, and "exit N" writes
+// to stderr and exits with status N. A shell request echoes stdin back until
+// EOF.
+func (s *forwardingServer) serveExec(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				return
+			}
+			req.Reply(true, nil)
+			if payload.Command == "block" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(payload.Command, "sha256sum -- "); ok {
+				s.serveChecksum(channel, strings.Trim(name, "'"))
+				return
+			}
+			status := 0
+			if code, ok := strings.CutPrefix(payload.Command, "exit "); ok {
+				status, _ = strconv.Atoi(code)
+				fmt.Fprintf(channel.Stderr(), "error: %s failed\n", payload.Command)
+			}
+			io.WriteString(channel, payload.Command)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		case "shell":
+			req.Reply(true, nil)
+			go func() {
+				io.Copy(channel, channel)
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				channel.Close()
+			}()
+		case "pty-req":
+			var payload struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			ssh.Unmarshal(req.Payload, &payload)
+			s.recordTerminal(fmt.Sprintf("pty %s %dx%d", payload.Term, payload.Columns, payload.Rows))
+			req.Reply(true, nil)
+		case "window-change":
+			var payload struct{ Columns, Rows, Width, Height uint32 }
+			ssh.Unmarshal(req.Payload, &payload)
+			s.recordTerminal(fmt.Sprintf("resize %dx%d", payload.Columns, payload.Rows))
+		case "signal":
+			var payload struct{ Signal string }
+			ssh.Unmarshal(req.Payload, &payload)
+			s.mu.Lock()
+			s.signals = append(s.signals, payload.Signal)
+			s.mu.Unlock()
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (s *forwardingServer) recordTerminal(request string) {
+	s.mu.Lock()
+	s.ptys = append(s.ptys, request)
+	s.mu.Unlock()
+}
+
+func (s *forwardingServer) serveChecksum(channel ssh.Channel, name string) {
+	status := 0
+	data, err := os.ReadFile(name)
+	switch {
+	case s.noSha256sum:
+		fmt.Fprintln(channel.Stderr(), "sh: sha256sum: not found")
+		status = ExitCommandNotFound
+	case err != nil:
+		fmt.Fprintf(channel.Stderr(), "sha256sum: %v\n", err)
+		status = 1
+	default:
+		fmt.Fprintf(channel, "%x  %s\n", sha256.Sum256(data), name)
+	}
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+}
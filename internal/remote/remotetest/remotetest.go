@@ -0,0 +1,237 @@
+// Package remotetest provides a scripted remote.Executor for tests of
+// workflows that should not need a server at all. Tests register canned
+// responses per command, exactly or by regular expression, and inspect the
+// calls the executor received afterwards.
+package remotetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+// Response is what the executor answers a command with.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Call is one command the executor was asked to run.
+type Call struct {
+	Command string
+	// Sudo reports whether the command was run as root.
+	Sudo bool
+	// Stream reports whether the output was streamed to a writer.
+	Stream bool
+}
+
+// Upload is one file the executor was asked to copy.
+type Upload struct {
+	LocalPath  string
+	RemotePath string
+	Data       []byte
+}
+
+// Executor answers commands with canned responses. Commands without a
+// registered response exit with status 127 and a "command not found"
+// message, like a shell would. The zero value is ready to use.
+type Executor struct {
+	mu       sync.Mutex
+	handlers []handler
+	calls    []Call
+	uploads  []Upload
+	closed   bool
+}
+
+type handler struct {
+	command  string
+	pattern  *regexp.Regexp
+	response Response
+}
+
+func (h handler) matches(command string) bool {
+	if h.pattern != nil {
+		return h.pattern.MatchString(command)
+	}
+	return h.command == command
+}
+
+var _ remote.Executor = (*Executor)(nil)
+
+// New returns an executor with no responses registered.
+func New() *Executor {
+	return &Executor{}
+}
+
+// Handle answers command, matched exactly, with response. Later
+// registrations take precedence over earlier ones.
+func (e *Executor) Handle(command string, response Response) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, handler{command: command, response: response})
+}
+
+// HandleRegexp answers every command matching pattern with response. It
+// panics if pattern does not compile. Later registrations take precedence
+// over earlier ones.
+func (e *Executor) HandleRegexp(pattern string, response Response) {
+	re := regexp.MustCompile(pattern)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, handler{pattern: re, response: response})
+}
+
+// Calls returns the commands run so far, in order.
+func (e *Executor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Call(nil), e.calls...)
+}
+
+// Commands returns the text of the commands run so far, in order.
+func (e *Executor) Commands() []string {
+	calls := e.Calls()
+	commands := make([]string, len(calls))
+	for i, call := range calls {
+		commands[i] = call.Command
+	}
+	return commands
+}
+
+// Uploads returns the files copied so far, in order.
+func (e *Executor) Uploads() []Upload {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Upload(nil), e.uploads...)
+}
+
+// Closed reports whether Close has been called.
+func (e *Executor) Closed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
+// respond records call and looks up its response.
+func (e *Executor) respond(call Call) Response {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, call)
+	for i := len(e.handlers) - 1; i >= 0; i-- {
+		if e.handlers[i].matches(call.Command) {
+			return e.handlers[i].response
+		}
+	}
+	return Response{Stderr: fmt.Sprintf("sh: 1: %s: not found\n", call.Command), ExitCode: remote.ExitCommandNotFound}
+}
+
+// Exec answers cmd like remote.SSHSession.Exec: a non-zero exit status
+// returns both the result and a *remote.CommandError.
+func (e *Executor) Exec(ctx context.Context, cmd string) (*remote.RunResult, error) {
+	return e.exec(ctx, Call{Command: cmd})
+}
+
+// ExecIdempotent is Exec.
+func (e *Executor) ExecIdempotent(ctx context.Context, cmd string) (*remote.RunResult, error) {
+	return e.Exec(ctx, cmd)
+}
+
+// ExecSudo is Exec, recorded as run as root.
+func (e *Executor) ExecSudo(ctx context.Context, cmd string) (*remote.RunResult, error) {
+	return e.exec(ctx, Call{Command: cmd, Sudo: true})
+}
+
+func (e *Executor) exec(ctx context.Context, call Call) (*remote.RunResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, context.Cause(ctx)
+	}
+
+	response := e.respond(call)
+	result := &remote.RunResult{
+		Command:  call.Command,
+		Stdout:   response.Stdout,
+		Stderr:   response.Stderr,
+		Output:   response.Stdout + response.Stderr,
+		ExitCode: response.ExitCode,
+		Duration: time.Millisecond,
+	}
+	if response.ExitCode != 0 {
+		err := &remote.CommandError{Result: result, Err: fmt.Errorf("exit status %d", response.ExitCode)}
+		return result, fmt.Errorf("failed to run command: %w", err)
+	}
+	return result, nil
+}
+
+func (e *Executor) run(ctx context.Context, call Call) (string, error) {
+	result, err := e.exec(ctx, call)
+	if result == nil {
+		return "", err
+	}
+	return result.Output, err
+}
+
+// RunContext answers cmd with its combined output.
+func (e *Executor) RunContext(ctx context.Context, cmd string) (string, error) {
+	return e.run(ctx, Call{Command: cmd})
+}
+
+// RunIdempotent is RunContext.
+func (e *Executor) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return e.RunContext(ctx, cmd)
+}
+
+// RunSudo is RunContext, recorded as run as root.
+func (e *Executor) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return e.run(ctx, Call{Command: cmd, Sudo: true})
+}
+
+// RunStreamContext writes the response's stdout and stderr to w.
+func (e *Executor) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	return e.stream(ctx, Call{Command: cmd, Stream: true}, w)
+}
+
+// RunStreamSudo is RunStreamContext, recorded as run as root.
+func (e *Executor) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	return e.stream(ctx, Call{Command: cmd, Sudo: true, Stream: true}, w)
+}
+
+func (e *Executor) stream(ctx context.Context, call Call, w io.Writer) error {
+	result, err := e.exec(ctx, call)
+	if result != nil {
+		io.WriteString(w, result.Output)
+	}
+	return err
+}
+
+// Upload records the contents of localPath, which must be a regular file.
+func (e *Executor) Upload(ctx context.Context, localPath, remotePath string, opts remote.TransferOptions) (*remote.TransferStats, error) {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.uploads = append(e.uploads, Upload{LocalPath: localPath, RemotePath: remotePath, Data: data})
+	e.mu.Unlock()
+
+	size := int64(len(data))
+	if opts.Progress != nil {
+		opts.Progress(remote.TransferProgress{Path: remotePath, Bytes: size, Total: size, Done: true})
+	}
+	return &remote.TransferStats{Files: 1, Bytes: size}, nil
+}
+
+// Close records that the executor was closed.
+func (e *Executor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	return nil
+}
@@ -0,0 +1,75 @@
+package remotetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tinotenda-alfaneti/labman/internal/remote"
+)
+
+func TestExecutor(t *testing.T) {
+	ctx := context.Background()
+	fake := New()
+	fake.Handle("uptime", Response{Stdout: "up 3 days\n"})
+	fake.HandleRegexp(`^systemctl is-active `, Response{Stdout: "active\n"})
+	fake.Handle("systemctl is-active pihole", Response{Stdout: "inactive\n", Stderr: "unit failed\n", ExitCode: 3})
+
+	if output, err := fake.RunContext(ctx, "uptime"); err != nil || output != "up 3 days\n" {
+		t.Fatalf("RunContext = %q, %v", output, err)
+	}
+	if output, err := fake.RunSudo(ctx, "systemctl is-active microk8s"); err != nil || output != "active\n" {
+		t.Fatalf("RunSudo = %q, %v", output, err)
+	}
+
+	output, err := fake.RunIdempotent(ctx, "systemctl is-active pihole")
+	var cmdErr *remote.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Result.ExitCode != 3 || output != "inactive\nunit failed\n" {
+		t.Fatalf("RunIdempotent = %q, %v", output, err)
+	}
+
+	var streamed bytes.Buffer
+	err = fake.RunStreamSudo(ctx, "kubectl version", &streamed)
+	if !errors.As(err, &cmdErr) || !cmdErr.Result.CommandNotFound() {
+		t.Fatalf("expected an unknown command to exit 127, got %v", err)
+	}
+	if streamed.String() != "sh: 1: kubectl version: not found\n" {
+		t.Fatalf("streamed %q", streamed.String())
+	}
+
+	want := []Call{
+		{Command: "uptime"},
+		{Command: "systemctl is-active microk8s", Sudo: true},
+		{Command: "systemctl is-active pihole"},
+		{Command: "kubectl version", Sudo: true, Stream: true},
+	}
+	calls := fake.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %+v", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+
+	local := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(local, []byte("hello"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stats, err := fake.Upload(ctx, local, "/tmp/notes.txt", remote.TransferOptions{})
+	if err != nil || stats.Bytes != 5 {
+		t.Fatalf("Upload = %+v, %v", stats, err)
+	}
+	if uploads := fake.Uploads(); len(uploads) != 1 || uploads[0].RemotePath != "/tmp/notes.txt" || string(uploads[0].Data) != "hello" {
+		t.Fatalf("uploads = %+v", uploads)
+	}
+
+	fake.Close()
+	if !fake.Closed() {
+		t.Fatal("expected Close to be recorded")
+	}
+}
@@ -0,0 +1,93 @@
+package remote
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExitCommandNotFound is the status shells use when a command does not exist.
+const ExitCommandNotFound = 127
+
+const (
+	stderrTailLines = 5
+	stderrTailBytes = 512
+)
+
+// RunResult is the outcome of a remote command.
+type RunResult struct {
+	Command string
+	Stdout  string
+	Stderr  string
+	// Output holds stdout and stderr interleaved in the order they arrived.
+	Output string
+	// ExitCode is -1 when the process reported no status, e.g. it was
+	// interrupted or the connection dropped.
+	ExitCode int
+	// Signal names the signal that killed the process (e.g. "TERM"), if any.
+	Signal   string
+	Duration time.Duration
+}
+
+// Success reports whether the command exited with status 0.
+func (r *RunResult) Success() bool {
+	return r.ExitCode == 0
+}
+
+// CommandNotFound reports whether the remote shell could not find the command.
+func (r *RunResult) CommandNotFound() bool {
+	return r.ExitCode == ExitCommandNotFound
+}
+
+// StderrTail returns the last few lines of stderr on a single line.
+func (r *RunResult) StderrTail() string {
+	lines := strings.Split(strings.TrimSpace(r.Stderr), "\n")
+	if len(lines) > stderrTailLines {
+		lines = lines[len(lines)-stderrTailLines:]
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	tail := strings.Join(kept, "; ")
+	if len(tail) > stderrTailBytes {
+		tail = "..." + tail[len(tail)-stderrTailBytes:]
+	}
+	return tail
+}
+
+// fail records how the command ended and wraps err with the stderr tail.
+func (r *RunResult) fail(err error) *CommandError {
+	r.ExitCode = -1
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		r.ExitCode = exitErr.ExitStatus()
+		r.Signal = exitErr.Signal()
+	}
+	return &CommandError{Result: r, Err: err}
+}
+
+// CommandError is returned when a remote command fails. It carries the full
+// result so callers can inspect the exit code and output.
+type CommandError struct {
+	Result *RunResult
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	msg := e.Err.Error()
+	if tail := e.Result.StderrTail(); tail != "" {
+		msg += ": " + tail
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
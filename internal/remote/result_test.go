@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunResultStderrTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{name: "empty", stderr: "", want: ""},
+		{name: "single line", stderr: "bash: foo: command not found\n", want: "bash: foo: command not found"},
+		{name: "keeps last lines", stderr: "1\n2\n3\n4\n5\n6\n7\n", want: "3; 4; 5; 6; 7"},
+		{name: "skips blank lines", stderr: "first\n\n  \nlast\n", want: "first; last"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &RunResult{Stderr: tt.stderr}
+			if got := result.StderrTail(); got != tt.want {
+				t.Errorf("StderrTail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("truncates long output", func(t *testing.T) {
+		result := &RunResult{Stderr: strings.Repeat("x", 2*stderrTailBytes)}
+		if got := result.StderrTail(); len(got) != stderrTailBytes+3 || !strings.HasPrefix(got, "...") {
+			t.Errorf("expected truncated tail, got %d bytes", len(got))
+		}
+	})
+}
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "short output is kept", writes: []string{"warn", "\n"}, want: "warn\n"},
+		{name: "older writes are dropped", writes: []string{"0123", "4567", "89"}, want: "...456789"},
+		{name: "one long write keeps its end", writes: []string{"0123456789"}, want: "...456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := newTailBuffer(6)
+			for _, write := range tt.writes {
+				if n, err := tail.Write([]byte(write)); n != len(write) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", write, n, err)
+				}
+			}
+			if got := tail.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("stays bounded", func(t *testing.T) {
+		tail := newTailBuffer(stderrTailBytes)
+		for range 1000 {
+			tail.Write([]byte(strings.Repeat("noise", 100) + "\n"))
+		}
+		if len(tail.buf) != stderrTailBytes {
+			t.Errorf("kept %d bytes, want %d", len(tail.buf), stderrTailBytes)
+		}
+	})
+}
+
+func TestSessionExec(t *testing.T) {
+	session := newTestSession(t, startForwardingServer(t, "secret"))
+
+	t.Run("successful command", func(t *testing.T) {
+		result, err := session.Exec(context.Background(), "uptime")
+		if err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+		if !result.Success() || result.Stdout != "uptime" || result.Stderr != "" || result.Duration <= 0 {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("non-zero exit keeps output and explains itself", func(t *testing.T) {
+		result, err := session.Exec(context.Background(), "exit 127")
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			t.Fatalf("expected CommandError, got %v", err)
+		}
+		if result == nil || result.ExitCode != 127 || !result.CommandNotFound() {
+			t.Fatalf("expected exit 127, got %+v", result)
+		}
+		if result.Stdout != "exit 127" || !strings.Contains(result.Stderr, "exit 127 failed") {
+			t.Fatalf("expected separate stdout and stderr, got %q / %q", result.Stdout, result.Stderr)
+		}
+		if !strings.Contains(err.Error(), "status 127: error: exit 127 failed") {
+			t.Fatalf("expected stderr tail in error, got %v", err)
+		}
+	})
+
+	t.Run("RunContext returns output on failure", func(t *testing.T) {
+		output, err := session.RunContext(context.Background(), "exit 2")
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+		if !strings.Contains(output, "exit 2 failed") || !strings.Contains(output, "exit 2") {
+			t.Fatalf("expected combined output, got %q", output)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultSessionMaxTTL caps sliding renewals and extensions when no maximum
+// is configured.
+const DefaultSessionMaxTTL = 24 * time.Hour
+
+// ErrSessionMaxTTL is returned when a session is already at its maximum
+// lifetime and only a new login can renew it.
+var ErrSessionMaxTTL = errors.New("session reached its maximum lifetime")
+
+// SessionExpiry controls how long a cached session stays valid.
+type SessionExpiry struct {
+	// TTL is the lifetime from login, or from the last successful command
+	// when Sliding is set. Zero means DefaultSessionTTL.
+	TTL     time.Duration
+	Sliding bool
+	// MaxTTL is the hard limit, counted from login, that neither sliding
+	// renewals nor ExtendSession can pass. Zero means DefaultSessionMaxTTL,
+	// or TTL when that is longer.
+	MaxTTL time.Duration
+}
+
+// EffectiveTTL is TTL with the default applied.
+func (e SessionExpiry) EffectiveTTL() time.Duration {
+	if e.TTL <= 0 {
+		return DefaultSessionTTL
+	}
+	return e.TTL
+}
+
+// EffectiveMaxTTL is MaxTTL with the default applied, never below the TTL.
+func (e SessionExpiry) EffectiveMaxTTL() time.Duration {
+	if e.MaxTTL > 0 {
+		return max(e.MaxTTL, e.EffectiveTTL())
+	}
+	return max(DefaultSessionMaxTTL, e.EffectiveTTL())
+}
+
+// Expiry returns the expiry settings the session was saved with.
+func (c SSHSessionConfig) Expiry() SessionExpiry {
+	return SessionExpiry{TTL: c.TTL, Sliding: c.Sliding, MaxTTL: c.MaxTTL}
+}
+
+// Deadline is the latest the session can be kept alive without a new login.
+func (c SSHSessionConfig) Deadline() time.Time {
+	loginAt := c.LoginAt
+	if loginAt.IsZero() {
+		// Sessions saved before login times were recorded.
+		loginAt = c.Timeout.Add(-c.Expiry().EffectiveTTL())
+	}
+	return loginAt.Add(c.Expiry().EffectiveMaxTTL())
+}
+
+// TouchSession renews a sliding session after a successful command: its
+// timeout moves to TTL from now, but never past its Deadline. Fixed and
+// already expired sessions are left alone. name selects the session as in
+// LoadSession.
+func TouchSession(name string) error {
+	sessionFile, err := resolveSessionFile(name)
+	if err != nil {
+		return err
+	}
+	sessionData, err := loadSessionDataFromFile(sessionFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if !sessionData.Sliding || sessionData.Timeout.Before(now) {
+		return nil
+	}
+	timeout := now.Add(sessionData.Expiry().EffectiveTTL())
+	if deadline := sessionData.Deadline(); timeout.After(deadline) {
+		timeout = deadline
+	}
+	if !timeout.After(sessionData.Timeout) {
+		return nil
+	}
+
+	sessionData.Timeout = timeout
+	return writeSessionData(sessionFile, sessionData)
+}
+
+// ExtendSession pushes a session's timeout back by d (its TTL when d is not
+// positive), counting from now if it has already expired, and caps it at the
+// session's Deadline. The cached credentials are verified by dialing the host
+// first, so a session whose password has changed is not kept alive. name
+// selects the session as in LoadSession.
+func ExtendSession(name string, d time.Duration) (SSHSessionConfig, error) {
+	sessionFile, err := resolveSessionFile(name)
+	if err != nil {
+		return SSHSessionConfig{}, err
+	}
+	sessionData, err := loadSessionDataFromFile(sessionFile)
+	if err != nil {
+		return SSHSessionConfig{}, err
+	}
+
+	now := time.Now()
+	deadline := sessionData.Deadline()
+	if !deadline.After(now) || !deadline.After(sessionData.Timeout) {
+		return sessionData, fmt.Errorf("%w at %s; run 'labman login' again", ErrSessionMaxTTL, deadline.Format(time.RFC3339))
+	}
+
+	session, err := dialCachedSession(sessionData)
+	if err != nil {
+		return sessionData, fmt.Errorf("verify cached credentials: %w", err)
+	}
+	session.Close()
+
+	if d <= 0 {
+		d = sessionData.Expiry().EffectiveTTL()
+	}
+	start := sessionData.Timeout
+	if start.Before(now) {
+		start = now
+	}
+	sessionData.Timeout = start.Add(d)
+	if sessionData.Timeout.After(deadline) {
+		sessionData.Timeout = deadline
+	}
+
+	if err := writeSessionData(sessionFile, sessionData); err != nil {
+		return sessionData, err
+	}
+	return sessionData, nil
+}
@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	setTempHome(t)
+
+	secrets, restoreKeyring := stubKeyring()
+	t.Cleanup(restoreKeyring)
+
+	restoreNewSession := stubNewSSHSession()
+	t.Cleanup(restoreNewSession)
+
+	// cache writes a session file with the given times and makes it active.
+	cache := func(t *testing.T, sessionData SSHSessionConfig) {
+		t.Helper()
+		file, err := sessionFilePath(sessionData.Name)
+		if err != nil {
+			t.Fatalf("session file path: %v", err)
+		}
+		if err := writeSessionData(file, sessionData); err != nil {
+			t.Fatalf("write session: %v", err)
+		}
+		if err := SetActiveSession(sessionData.Name); err != nil {
+			t.Fatalf("SetActiveSession: %v", err)
+		}
+		secrets[credentialsKey(sessionData.Host, sessionData.Port, sessionData.User)] = "secret"
+	}
+
+	t.Run("SaveSession applies the configured TTL", func(t *testing.T) {
+		session := &SSHSession{Name: "ttl", Host: "ttl.example", User: "admin", Password: "secret",
+			Expiry: SessionExpiry{TTL: 8 * time.Hour, Sliding: true, MaxTTL: 12 * time.Hour}}
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+
+		meta, err := SessionMetadata("ttl")
+		if err != nil {
+			t.Fatalf("SessionMetadata: %v", err)
+		}
+		if got := time.Until(meta.Timeout); got < 7*time.Hour || got > 8*time.Hour {
+			t.Fatalf("expected an 8h timeout, got %s", got)
+		}
+		if got := meta.Deadline().Sub(meta.LoginAt); got != 12*time.Hour {
+			t.Fatalf("expected a 12h deadline, got %s", got)
+		}
+
+		loaded, err := LoadSession("ttl")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Expiry != session.Expiry {
+			t.Fatalf("expected expiry %+v restored, got %+v", session.Expiry, loaded.Expiry)
+		}
+	})
+
+	t.Run("TouchSession slides up to the deadline", func(t *testing.T) {
+		now := time.Now()
+		cache(t, SSHSessionConfig{Name: "sliding", Host: "slide.example", User: "admin",
+			LoginAt: now.Add(-90 * time.Minute), Timeout: now.Add(10 * time.Minute),
+			TTL: time.Hour, Sliding: true, MaxTTL: 2 * time.Hour})
+
+		if err := TouchSession(""); err != nil {
+			t.Fatalf("TouchSession: %v", err)
+		}
+		meta, err := SessionMetadata("sliding")
+		if err != nil {
+			t.Fatalf("SessionMetadata: %v", err)
+		}
+		if !meta.Timeout.Equal(meta.Deadline()) {
+			t.Fatalf("expected the timeout capped at %s, got %s", meta.Deadline(), meta.Timeout)
+		}
+	})
+
+	t.Run("TouchSession leaves fixed sessions alone", func(t *testing.T) {
+		timeout := time.Now().Add(10 * time.Minute).Round(time.Second)
+		cache(t, SSHSessionConfig{Name: "fixed", Host: "fixed.example", User: "admin",
+			LoginAt: time.Now().Add(-50 * time.Minute), Timeout: timeout})
+
+		if err := TouchSession("fixed"); err != nil {
+			t.Fatalf("TouchSession: %v", err)
+		}
+		meta, _ := SessionMetadata("fixed")
+		if !meta.Timeout.Equal(timeout) {
+			t.Fatalf("expected timeout %s unchanged, got %s", timeout, meta.Timeout)
+		}
+	})
+
+	t.Run("ExtendSession revives an expired session", func(t *testing.T) {
+		now := time.Now()
+		cache(t, SSHSessionConfig{Name: "expired", Host: "expired.example", User: "admin",
+			LoginAt: now.Add(-2 * time.Hour), Timeout: now.Add(-time.Hour)})
+
+		meta, err := ExtendSession("expired", 2*time.Hour)
+		if err != nil {
+			t.Fatalf("ExtendSession: %v", err)
+		}
+		if got := time.Until(meta.Timeout); got < 119*time.Minute || got > 2*time.Hour {
+			t.Fatalf("expected 2h from now, got %s", got)
+		}
+		if _, err := LoadSession("expired"); err != nil {
+			t.Fatalf("expected the extended session to load: %v", err)
+		}
+	})
+
+	t.Run("ExtendSession stops at the deadline", func(t *testing.T) {
+		now := time.Now()
+		cache(t, SSHSessionConfig{Name: "capped", Host: "capped.example", User: "admin",
+			LoginAt: now.Add(-23 * time.Hour), Timeout: now.Add(30 * time.Minute)})
+
+		meta, err := ExtendSession("capped", 4*time.Hour)
+		if err != nil {
+			t.Fatalf("ExtendSession: %v", err)
+		}
+		if !meta.Timeout.Equal(meta.Deadline()) {
+			t.Fatalf("expected the timeout capped at %s, got %s", meta.Deadline(), meta.Timeout)
+		}
+		if _, err := ExtendSession("capped", time.Hour); !errors.Is(err, ErrSessionMaxTTL) {
+			t.Fatalf("expected ErrSessionMaxTTL once at the deadline, got %v", err)
+		}
+	})
+
+	t.Run("ExtendSession requires the cached credential", func(t *testing.T) {
+		now := time.Now()
+		cache(t, SSHSessionConfig{Name: "forgotten", Host: "forgotten.example", User: "admin",
+			LoginAt: now, Timeout: now.Add(time.Hour)})
+		delete(secrets, credentialsKey("forgotten.example", 0, "admin"))
+
+		if _, err := ExtendSession("forgotten", time.Hour); err == nil {
+			t.Fatalf("expected extend to fail without the keyring password")
+		}
+	})
+}
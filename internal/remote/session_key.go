@@ -2,20 +2,19 @@ package remote
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func hostKeyCallback(knownHostsPath string) (ssh.HostKeyCallback, error) {
-	if knownHostsPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("resolve home directory: %w", err)
-		}
-		knownHostsPath = filepath.Join(homeDir, ".ssh", "known_hosts")
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return nil, err
 	}
 
 	callback, err := knownhosts.New(knownHostsPath)
@@ -26,6 +25,40 @@ func hostKeyCallback(knownHostsPath string) (ssh.HostKeyCallback, error) {
 	return callback, nil
 }
 
-func credentialsKey(host, user string) string {
+// knownHostsFile returns path, or ~/.ssh/known_hosts when path is empty.
+func knownHostsFile(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".ssh", "known_hosts"), nil
+}
+
+// credentialsKey names the password stored for user on host and port, so
+// aliases that reach different machines through one address keep their own.
+// Port 0 is 22, as when dialing.
+func credentialsKey(host string, port int, user string) string {
+	if port == 0 {
+		port = 22
+	}
+	return user + "@" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func sudoKey(host string, port int, user string) string {
+	return "sudo:" + credentialsKey(host, port, user)
+}
+
+// legacyCredentialsKey is the name older releases stored a password under,
+// one per user and host whatever the port. Secrets found there are copied
+// to credentialsKey when they are read.
+func legacyCredentialsKey(host, user string) string {
 	return fmt.Sprintf("%s@%s", user, host)
-}
\ No newline at end of file
+}
+
+func legacySudoKey(host, user string) string {
+	return "sudo:" + legacyCredentialsKey(host, user)
+}
@@ -5,26 +5,51 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/zalando/go-keyring"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	keyringSet    = keyring.Set
-	keyringGet    = keyring.Get
-	keyringDelete = keyring.Delete
+	keyringSet = func(service, key, secret string) error {
+		return credentialStore().Set(service, key, secret)
+	}
+	keyringGet = func(service, key string) (string, error) {
+		return credentialStore().Get(service, key)
+	}
+	keyringDelete = func(service, key string) error {
+		return credentialStore().Delete(service, key)
+	}
 	newSSHSession = NewSSHSession
 )
 
 // DefaultSessionTTL is the time a session remains valid after login
 const DefaultSessionTTL = time.Hour
 
-func LoadSession() (*SSHSession, error) {
-	sessionFile, err := getSessionFilePath()
+// ErrNoActiveSession is returned when no session name is given and none has
+// been selected with login or SetActiveSession.
+var ErrNoActiveSession = errors.New("no active session")
+
+// LoadSession re-dials the session cached under name, or the active session
+// when name is empty. When a daemon is running the session borrows its
+// connection instead, which skips the handshake and keyring lookups.
+func LoadSession(name string) (*SSHSession, error) {
+	session, err := loadDaemonSession(name)
+	// The daemon cannot prompt, so a session it failed to dial is dialed
+	// here, where an unknown host key or a passphrase can be asked for.
+	if err == nil || !errors.Is(err, ErrDaemonNotRunning) && !errors.Is(err, errSessionDial) {
+		return session, err
+	}
+	return loadSessionDirect(name)
+}
+
+// loadSessionDirect is LoadSession without the daemon.
+func loadSessionDirect(name string) (*SSHSession, error) {
+	sessionFile, err := resolveSessionFile(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session file path: %v", err)
+		return nil, err
 	}
 
 	if _, err := os.Stat(sessionFile); os.IsNotExist(err) {
@@ -40,26 +65,122 @@ func LoadSession() (*SSHSession, error) {
 		return nil, fmt.Errorf("session has expired at %s", sessionData.Timeout.Format(time.RFC3339))
 	}
 
-	password, err := keyringGet(keyringService, credentialsKey(sessionData.Host, sessionData.User))
+	return dialCachedSession(sessionData)
+}
+
+// dialCachedSession re-dials a cached session with the secrets stored in the
+// keyring, whether or not it has expired.
+func dialCachedSession(sessionData SSHSessionConfig) (*SSHSession, error) {
+	opts, err := cachedSessionOptions(sessionData)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, jump := range sessionData.Jumps {
+		hop, err := cachedSessionOptions(jump)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %s: %w", jump.Host, err)
+		}
+		opts.Jumps = append(opts.Jumps, hop)
+	}
+
+	session, err := newSSHSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	session.Name = sessionData.Name
+	session.Expiry = sessionData.Expiry()
+
+	if sessionData.Sudo == SudoPassword && session.Password == "" {
+		sudoPassword, err := keyringGetMigrating(sudoKey(sessionData.Host, sessionData.Port, sessionData.User), legacySudoKey(sessionData.Host, sessionData.User))
+		if err != nil && !errors.Is(err, ErrCredentialNotFound) {
+			session.Close()
+			return nil, fmt.Errorf("failed to load sudo password from keyring: %w", err)
+		}
+		session.SudoPassword = sudoPassword
+	}
+	return session, nil
+}
+
+// cachedSessionOptions rebuilds the dial options for one cached host.
+func cachedSessionOptions(sessionData SSHSessionConfig) (SessionOptions, error) {
+	auth, err := cachedAuthOptions(sessionData)
+	if err != nil {
+		return SessionOptions{}, err
+	}
+
+	return SessionOptions{
+		Host:              sessionData.Host,
+		Port:              sessionData.Port,
+		User:              sessionData.User,
+		Timeout:           sessionData.ConnectTimeout,
+		Auth:              auth,
+		HostKeyPolicy:     sessionData.HostKeyPolicy,
+		KeepaliveInterval: sessionData.KeepaliveInterval,
+		Sudo:              sessionData.Sudo,
+	}, nil
+}
+
+// cachedAuthOptions rebuilds the credentials recorded for a cached session.
+// Key-based sessions only need the keyring when the key has a passphrase.
+func cachedAuthOptions(sessionData SSHSessionConfig) (AuthOptions, error) {
+	switch sessionData.AuthMethod {
+	case AuthAgent:
+		return AuthOptions{Methods: []string{AuthAgent}}, nil
+	case AuthPublicKey:
+		passphrase, err := keyringGet(keyringService, passphraseKey(sessionData.KeyFile))
+		if err != nil && !errors.Is(err, ErrCredentialNotFound) {
+			return AuthOptions{}, fmt.Errorf("failed to load key passphrase from keyring: %w", err)
+		}
+		return AuthOptions{Methods: []string{AuthPublicKey}, KeyFile: sessionData.KeyFile, Passphrase: passphrase, CertFile: sessionData.CertFile}, nil
+	}
+
+	password, err := keyringGetMigrating(credentialsKey(sessionData.Host, sessionData.Port, sessionData.User), legacyCredentialsKey(sessionData.Host, sessionData.User))
 	if err != nil {
-		return nil, fmt.Errorf("failed to load password from keyring: %w", err)
+		return AuthOptions{}, fmt.Errorf("failed to load password from keyring: %w", err)
 	}
+	return AuthOptions{Methods: []string{AuthPassword}, Password: password}, nil
+}
 
-	return newSSHSession(sessionData.Host, sessionData.User, password)
+// keyringGetMigrating reads key, falling back to legacy, where older releases
+// stored the same secret. A secret found there is copied to key; the legacy
+// entry stays until no cached session can need it, see DeleteSession.
+func keyringGetMigrating(key, legacy string) (string, error) {
+	secret, err := keyringGet(keyringService, key)
+	if !errors.Is(err, ErrCredentialNotFound) {
+		return secret, err
+	}
+	secret, legacyErr := keyringGet(keyringService, legacy)
+	if legacyErr != nil {
+		return "", err
+	}
+	// Best effort: the legacy entry still answers if the copy fails.
+	_ = keyringSet(keyringService, key, secret)
+	return secret, nil
 }
 
+// SaveSession caches s under s.Name (its host when unnamed) and makes it the
+// active session.
 func SaveSession(s *SSHSession) error {
-	createSessionFilePath, err := getSessionFilePath()
+	if s.Name == "" {
+		s.Name = SessionName(s.Host)
+	}
+	createSessionFilePath, err := sessionFilePath(s.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get session file path: %w", err)
 	}
-	return saveSessionToFile(createSessionFilePath, s)
+	if err := saveSessionToFile(createSessionFilePath, s); err != nil {
+		return err
+	}
+	return SetActiveSession(s.Name)
 }
 
-func SessionMetadata() (SSHSessionConfig, error) {
-	sessionFile, err := getSessionFilePath()
+// SessionMetadata reads the session cached under name, or the active session
+// when name is empty, without connecting.
+func SessionMetadata(name string) (SSHSessionConfig, error) {
+	sessionFile, err := resolveSessionFile(name)
 	if err != nil {
-		return SSHSessionConfig{}, fmt.Errorf("failed to get session file path: %w", err)
+		return SSHSessionConfig{}, err
 	}
 
 	if _, err := os.Stat(sessionFile); err != nil {
@@ -72,10 +193,12 @@ func SessionMetadata() (SSHSessionConfig, error) {
 	return loadSessionDataFromFile(sessionFile)
 }
 
-func DeleteSession() error {
-	sessionFile, err := getSessionFilePath()
+// DeleteSession removes the session cached under name, or the active session
+// when name is empty, along with keyring secrets no other session uses.
+func DeleteSession(name string) error {
+	sessionFile, err := resolveSessionFile(name)
 	if err != nil {
-		return fmt.Errorf("failed to get session file path: %w", err)
+		return err
 	}
 
 	sessionData, err := loadSessionDataFromFile(sessionFile)
@@ -86,42 +209,268 @@ func DeleteSession() error {
 		return err
 	}
 
-	credentialKey := credentialsKey(sessionData.Host, sessionData.User)
-	if err := keyringDelete(keyringService, credentialKey); err != nil && !errors.Is(err, keyring.ErrNotFound) {
-		return fmt.Errorf("remove credentials from keyring: %w", err)
+	others, err := ListSessions()
+	if err != nil {
+		return err
+	}
+	inUse := map[string]bool{}
+	for _, other := range others {
+		if other.Name == sessionData.Name {
+			continue
+		}
+		for _, cached := range append([]SSHSessionConfig{other}, other.Jumps...) {
+			for _, key := range cachedCredentialKeys(cached) {
+				inUse[key] = true
+			}
+		}
 	}
 
-	if err := os.Remove(sessionFile); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
+	for _, cached := range append([]SSHSessionConfig{sessionData}, sessionData.Jumps...) {
+		if err := deleteCachedCredentials(cached, inUse); err != nil {
+			return err
 		}
+	}
+
+	if err := os.Remove(sessionFile); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("remove session file: %w", err)
 	}
 
+	if active, err := ActiveSession(); err == nil && active == sessionData.Name {
+		activeFile, err := activeSessionFile()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(activeFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("clear active session: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListSessions returns every cached session, sorted by name. Expired
+// sessions are included; check Timeout.
+func ListSessions() ([]SSHSessionConfig, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateLegacySession(dir); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+sessionFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+
+	var sessions []SSHSessionConfig
+	for _, file := range files {
+		sessionData, err := loadSessionDataFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if sessionData.Name == "" {
+			sessionData.Name = strings.TrimSuffix(filepath.Base(file), sessionFileExt)
+		}
+		sessions = append(sessions, sessionData)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+// ActiveSession returns the name of the session commands use by default.
+func ActiveSession() (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	if err := migrateLegacySession(dir); err != nil {
+		return "", err
+	}
+
+	activeFile, err := activeSessionFile()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(activeFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNoActiveSession
+	}
+	if err != nil {
+		return "", fmt.Errorf("read active session: %w", err)
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return "", ErrNoActiveSession
+	}
+	return name, nil
+}
+
+// SetActiveSession makes the session cached under name the default.
+func SetActiveSession(name string) error {
+	sessionFile, err := sessionFilePath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(sessionFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no cached session named %q", name)
+		}
+		return fmt.Errorf("stat session file: %w", err)
+	}
+
+	activeFile, err := activeSessionFile()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(activeFile, []byte(name+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write active session: %w", err)
+	}
+	return nil
+}
+
+// SessionName turns a login identifier (an alias or address) into the name
+// its session is cached under. Characters that are unsafe in file names
+// become '_'.
+func SessionName(identifier string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, identifier)
+}
+
+// cachedCredentialKeys lists the keyring entries a cached host may use. Many
+// sessions can share one key file, and so its passphrase.
+func cachedCredentialKeys(sessionData SSHSessionConfig) []string {
+	keys := []string{
+		credentialsKey(sessionData.Host, sessionData.Port, sessionData.User),
+		sudoKey(sessionData.Host, sessionData.Port, sessionData.User),
+		legacyCredentialsKey(sessionData.Host, sessionData.User),
+		legacySudoKey(sessionData.Host, sessionData.User),
+	}
+	if sessionData.KeyFile != "" {
+		keys = append(keys, passphraseKey(sessionData.KeyFile))
+	}
+	return keys
+}
+
+// deleteCachedCredentials removes the keyring entries stored for one host,
+// except those in inUse.
+func deleteCachedCredentials(sessionData SSHSessionConfig, inUse map[string]bool) error {
+	for _, key := range cachedCredentialKeys(sessionData) {
+		if inUse[key] {
+			continue
+		}
+		if err := keyringDelete(keyringService, key); err != nil && !errors.Is(err, ErrCredentialNotFound) {
+			return fmt.Errorf("remove %s from keyring: %w", key, err)
+		}
+	}
 	return nil
 }
 
-func getSessionFilePath() (string, error) {
+const sessionFileExt = ".yaml"
+
+// legacySessionFile is where the single cached session lived before
+// sessions were kept per host.
+const legacySessionFile = "credentials.yaml"
+
+func sessionDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("resolve home directory: %w", err)
 	}
-	return filepath.Join(homeDir, ".labman", "sessions", "credentials.yaml"), nil
+	return filepath.Join(homeDir, ".labman", "sessions"), nil
 }
 
-func saveSessionToFile(filePath string, session *SSHSession) error {
-	sessionTimeout := time.Now().Add(DefaultSessionTTL)
-	credentialKey := credentialsKey(session.Host, session.User)
+func sessionFilePath(name string) (string, error) {
+	if name == "" || name != SessionName(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+sessionFileExt), nil
+}
 
-	if err := keyringSet(keyringService, credentialKey, session.Password); err != nil {
-		return fmt.Errorf("store password in keyring: %w", err)
+func activeSessionFile() (string, error) {
+	dir, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "active"), nil
+}
+
+// resolveSessionFile returns the file for name, or for the active session
+// when name is empty.
+func resolveSessionFile(name string) (string, error) {
+	if name == "" {
+		active, err := ActiveSession()
+		if err != nil {
+			return "", err
+		}
+		name = active
+	}
+	return sessionFilePath(name)
+}
+
+// migrateLegacySession moves a session saved by older releases to its
+// per-host file and makes it active, unless another session already is.
+func migrateLegacySession(dir string) error {
+	legacy := filepath.Join(dir, legacySessionFile)
+	sessionData, err := loadSessionDataFromFile(legacy)
+	if err != nil || sessionData.Name != "" {
+		// Nothing to migrate, or a host that is really called "credentials".
+		return nil
+	}
+
+	sessionData.Name = SessionName(sessionData.Host)
+	target := filepath.Join(dir, sessionData.Name+sessionFileExt)
+	if err := writeSessionData(target, sessionData); err != nil {
+		return fmt.Errorf("migrate cached session: %w", err)
+	}
+	if target != legacy {
+		if err := os.Remove(legacy); err != nil {
+			return fmt.Errorf("migrate cached session: %w", err)
+		}
+	}
+
+	activeFile := filepath.Join(dir, "active")
+	if _, err := os.Stat(activeFile); errors.Is(err, os.ErrNotExist) {
+		return os.WriteFile(activeFile, []byte(sessionData.Name+"\n"), 0o600)
+	}
+	return nil
+}
+
+func saveSessionToFile(filePath string, session *SSHSession) error {
+	sessionData, err := storeSessionCredentials(session)
+	if err != nil {
+		return err
 	}
+	now := time.Now()
+	sessionData.Name = session.Name
+	sessionData.LoginAt = now
+	sessionData.TTL = session.Expiry.TTL
+	sessionData.Sliding = session.Expiry.Sliding
+	sessionData.MaxTTL = session.Expiry.MaxTTL
+	sessionData.Timeout = now.Add(session.Expiry.EffectiveTTL())
 
-	sessionData := SSHSessionConfig{
-		Host:    session.Host,
-		User:    session.User,
-		Timeout: sessionTimeout,
+	for _, jump := range session.Jumps {
+		jumpData, err := storeSessionCredentials(jump)
+		if err != nil {
+			return fmt.Errorf("jump host %s: %w", jump.Host, err)
+		}
+		sessionData.Jumps = append(sessionData.Jumps, jumpData)
 	}
+
+	return writeSessionData(filePath, sessionData)
+}
+
+func writeSessionData(filePath string, sessionData SSHSessionConfig) error {
 	err := os.MkdirAll(filepath.Dir(filePath), 0o700)
 	if err != nil {
 		return fmt.Errorf("failed to create session directory: %v", err)
@@ -143,6 +492,50 @@ func saveSessionToFile(filePath string, session *SSHSession) error {
 	return nil
 }
 
+// storeSessionCredentials saves whatever secret the session authenticated
+// with in the keyring and returns the metadata needed to dial it again.
+func storeSessionCredentials(session *SSHSession) (SSHSessionConfig, error) {
+	authMethod := session.AuthMethod
+	if authMethod == "" {
+		authMethod = AuthPassword
+	}
+
+	switch authMethod {
+	case AuthAgent:
+		// the agent holds the keys; nothing to store
+	case AuthPublicKey:
+		if session.Passphrase != "" {
+			if err := keyringSet(keyringService, passphraseKey(session.KeyFile), session.Passphrase); err != nil {
+				return SSHSessionConfig{}, fmt.Errorf("store key passphrase in keyring: %w", err)
+			}
+		}
+	default:
+		credentialKey := credentialsKey(session.Host, session.Port, session.User)
+		if err := keyringSet(keyringService, credentialKey, session.Password); err != nil {
+			return SSHSessionConfig{}, fmt.Errorf("store password in keyring: %w", err)
+		}
+	}
+
+	if session.SudoPassword != "" {
+		if err := keyringSet(keyringService, sudoKey(session.Host, session.Port, session.User), session.SudoPassword); err != nil {
+			return SSHSessionConfig{}, fmt.Errorf("store sudo password in keyring: %w", err)
+		}
+	}
+
+	return SSHSessionConfig{
+		Host:              session.Host,
+		Port:              session.Port,
+		User:              session.User,
+		AuthMethod:        authMethod,
+		KeyFile:           session.KeyFile,
+		CertFile:          session.CertFile,
+		ConnectTimeout:    session.ConnectTimeout,
+		HostKeyPolicy:     session.HostKeyPolicy,
+		KeepaliveInterval: session.KeepaliveInterval,
+		Sudo:              session.Sudo,
+	}, nil
+}
+
 func loadSessionDataFromFile(sessionFile string) (SSHSessionConfig, error) {
 	var sessionConfig SSHSessionConfig
 
@@ -1,11 +1,14 @@
 package remote
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/zalando/go-keyring"
 )
 
 func TestSessionManager(t *testing.T) {
@@ -18,23 +21,22 @@ func TestSessionManager(t *testing.T) {
 	t.Cleanup(restoreNewSession)
 
 	t.Run("saveSessionToFile stores session config", func(t *testing.T) {
-		sessionFilePath, err := getSessionFilePath()
-		if err != nil {
-			t.Fatalf("get session file path: %v", err)
-		}
-
 		session := &SSHSession{
 			Host:     "localhost",
 			User:     "user",
 			Password: "password",
 		}
 
-		if err := saveSessionToFile(sessionFilePath, session); err != nil {
+		if err := SaveSession(session); err != nil {
 			t.Fatalf("save session: %v", err)
 		}
-		t.Cleanup(func() { os.Remove(sessionFilePath) })
+		t.Cleanup(func() { DeleteSession(session.Name) })
 
-		data, err := loadSessionDataFromFile(sessionFilePath)
+		file, err := sessionFilePath("localhost")
+		if err != nil {
+			t.Fatalf("get session file path: %v", err)
+		}
+		data, err := loadSessionDataFromFile(file)
 		if err != nil {
 			t.Fatalf("load session data: %v", err)
 		}
@@ -51,30 +53,25 @@ func TestSessionManager(t *testing.T) {
 			t.Fatalf("expected timeout in the future, got %v", data.Timeout)
 		}
 
-		wantSecret := credentialsKey(session.Host, session.User)
+		wantSecret := credentialsKey(session.Host, session.Port, session.User)
 		if got := secrets[wantSecret]; got != session.Password {
 			t.Fatalf("expected password %q in keyring, got %q", session.Password, got)
 		}
 	})
 
 	t.Run("LoadSession returns SSHSession built from saved data", func(t *testing.T) {
-		sessionFilePath, err := getSessionFilePath()
-		if err != nil {
-			t.Fatalf("get session file path: %v", err)
-		}
-
 		session := &SSHSession{
 			Host:     "example.com",
 			User:     "admin",
 			Password: "secret",
 		}
 
-		if err := saveSessionToFile(sessionFilePath, session); err != nil {
+		if err := SaveSession(session); err != nil {
 			t.Fatalf("save session: %v", err)
 		}
-		t.Cleanup(func() { os.Remove(sessionFilePath) })
+		t.Cleanup(func() { DeleteSession(session.Name) })
 
-		loaded, err := LoadSession()
+		loaded, err := LoadSession("")
 		if err != nil {
 			t.Fatalf("load session: %v", err)
 		}
@@ -92,24 +89,148 @@ func TestSessionManager(t *testing.T) {
 		}
 	})
 
-	t.Run("SessionMetadata returns saved session config", func(t *testing.T) {
-		sessionFilePath, err := getSessionFilePath()
+	t.Run("LoadSession re-dials key sessions without a password", func(t *testing.T) {
+		session := &SSHSession{
+			Host:       "keys.example",
+			User:       "admin",
+			AuthMethod: AuthPublicKey,
+			KeyFile:    "/home/admin/.ssh/id_ed25519",
+			Passphrase: "unlock",
+		}
+
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession(session.Name) })
+
+		if _, ok := secrets[credentialsKey(session.Host, session.Port, session.User)]; ok {
+			t.Fatalf("expected no password stored for key-based session")
+		}
+
+		meta, err := SessionMetadata("")
 		if err != nil {
-			t.Fatalf("get session file path: %v", err)
+			t.Fatalf("SessionMetadata: %v", err)
+		}
+		if meta.AuthMethod != AuthPublicKey || meta.KeyFile != session.KeyFile {
+			t.Fatalf("expected publickey auth with %s, got %s with %s", session.KeyFile, meta.AuthMethod, meta.KeyFile)
+		}
+
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.KeyFile != session.KeyFile || loaded.Passphrase != session.Passphrase {
+			t.Fatalf("expected key %s with cached passphrase, got %s/%q", session.KeyFile, loaded.KeyFile, loaded.Passphrase)
+		}
+	})
+
+	t.Run("LoadSession re-dials the saved endpoint and options", func(t *testing.T) {
+		session := &SSHSession{
+			Host:           "port.example",
+			Port:           2222,
+			User:           "admin",
+			Password:       "secret",
+			ConnectTimeout: 5 * time.Second,
+			HostKeyPolicy:  HostKeyStrict,
+		}
+
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession(session.Name) })
+
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Port != 2222 || loaded.ConnectTimeout != 5*time.Second || loaded.HostKeyPolicy != HostKeyStrict {
+			t.Fatalf("expected port 2222, 5s timeout and strict policy, got %d/%s/%s", loaded.Port, loaded.ConnectTimeout, loaded.HostKeyPolicy)
+		}
+	})
+
+	t.Run("LoadSession re-dials through the saved jump hosts", func(t *testing.T) {
+		session := &SSHSession{
+			Host:     "internal.example",
+			User:     "admin",
+			Password: "inner",
+			Jumps: []*SSHSession{
+				{Host: "bastion.example", Port: 2200, User: "jump", Password: "outer"},
+			},
+		}
+
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession(session.Name) })
+
+		if got := secrets[credentialsKey("bastion.example", 2200, "jump")]; got != "outer" {
+			t.Fatalf("expected bastion password in keyring, got %q", got)
+		}
+
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if len(loaded.Jumps) != 1 {
+			t.Fatalf("expected 1 jump host, got %d", len(loaded.Jumps))
+		}
+		jump := loaded.Jumps[0]
+		if jump.Host != "bastion.example" || jump.Port != 2200 || jump.User != "jump" || jump.Password != "outer" {
+			t.Fatalf("unexpected jump session: %+v", jump)
+		}
+
+		if err := DeleteSession(""); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[credentialsKey("bastion.example", 2200, "jump")]; ok {
+			t.Fatalf("expected bastion secret removed")
+		}
+	})
+
+	t.Run("LoadSession restores a separate sudo password", func(t *testing.T) {
+		session := &SSHSession{
+			Host:         "sudo.example",
+			User:         "admin",
+			AuthMethod:   AuthPublicKey,
+			KeyFile:      "/home/admin/.ssh/id_ed25519",
+			Sudo:         SudoPassword,
+			SudoPassword: "root-secret",
+		}
+
+		if err := SaveSession(session); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession(session.Name) })
+
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Sudo != SudoPassword || loaded.SudoPassword != session.SudoPassword {
+			t.Fatalf("expected sudo password mode with cached password, got %q/%q", loaded.Sudo, loaded.SudoPassword)
+		}
+
+		if err := DeleteSession(""); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[sudoKey(session.Host, session.Port, session.User)]; ok {
+			t.Fatalf("expected sudo password removed from keyring")
 		}
+	})
 
+	t.Run("SessionMetadata returns saved session config", func(t *testing.T) {
 		session := &SSHSession{
 			Host:     "metadata.example",
 			User:     "me",
 			Password: "topsecret",
 		}
 
-		if err := saveSessionToFile(sessionFilePath, session); err != nil {
+		if err := SaveSession(session); err != nil {
 			t.Fatalf("save session: %v", err)
 		}
-		t.Cleanup(func() { os.Remove(sessionFilePath) })
+		t.Cleanup(func() { DeleteSession(session.Name) })
 
-		meta, err := SessionMetadata()
+		meta, err := SessionMetadata("")
 		if err != nil {
 			t.Fatalf("SessionMetadata: %v", err)
 		}
@@ -120,33 +241,226 @@ func TestSessionManager(t *testing.T) {
 	})
 
 	t.Run("DeleteSession removes session file and secrets", func(t *testing.T) {
-		sessionFilePath, err := getSessionFilePath()
-		if err != nil {
-			t.Fatalf("get session file path: %v", err)
-		}
-
 		session := &SSHSession{
 			Host:     "delete.example",
 			User:     "deleter",
 			Password: "secret",
 		}
 
-		if err := saveSessionToFile(sessionFilePath, session); err != nil {
+		if err := SaveSession(session); err != nil {
 			t.Fatalf("save session: %v", err)
 		}
 
-		if err := DeleteSession(); err != nil {
+		file, err := sessionFilePath(session.Name)
+		if err != nil {
+			t.Fatalf("get session file path: %v", err)
+		}
+
+		if err := DeleteSession(""); err != nil {
 			t.Fatalf("DeleteSession: %v", err)
 		}
 
-		if _, err := os.Stat(sessionFilePath); !os.IsNotExist(err) {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
 			t.Fatalf("expected session file removed, stat err=%v", err)
 		}
 
-		if _, ok := secrets[credentialsKey(session.Host, session.User)]; ok {
+		if _, ok := secrets[credentialsKey(session.Host, session.Port, session.User)]; ok {
 			t.Fatalf("expected keyring secret removed")
 		}
 	})
+
+	t.Run("sessions are cached per host and one is active", func(t *testing.T) {
+		prod := &SSHSession{Name: "homelab-prod", Host: "192.168.1.10", User: "admin", Password: "prod"}
+		k8s := &SSHSession{Name: "k8s-master", Host: "192.168.1.20", User: "admin", Password: "k8s"}
+		for _, session := range []*SSHSession{prod, k8s} {
+			if err := SaveSession(session); err != nil {
+				t.Fatalf("save session: %v", err)
+			}
+			t.Cleanup(func() { DeleteSession(session.Name) })
+		}
+
+		sessions, err := ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].Name != "homelab-prod" || sessions[1].Name != "k8s-master" {
+			t.Fatalf("expected both sessions sorted by name, got %+v", sessions)
+		}
+
+		if active, err := ActiveSession(); err != nil || active != "k8s-master" {
+			t.Fatalf("expected the last login to be active, got %q (%v)", active, err)
+		}
+		if err := SetActiveSession("homelab-prod"); err != nil {
+			t.Fatalf("SetActiveSession: %v", err)
+		}
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Name != "homelab-prod" || loaded.Password != "prod" {
+			t.Fatalf("expected the homelab-prod session, got %s with %q", loaded.Name, loaded.Password)
+		}
+		if loaded, err := LoadSession("k8s-master"); err != nil || loaded.Host != k8s.Host {
+			t.Fatalf("expected k8s-master by name, got %+v (%v)", loaded, err)
+		}
+
+		if err := SetActiveSession("missing"); err == nil {
+			t.Fatalf("expected an error activating an unknown session")
+		}
+		if err := DeleteSession(""); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := ActiveSession(); !errors.Is(err, ErrNoActiveSession) {
+			t.Fatalf("expected no active session after dropping it, got %v", err)
+		}
+	})
+
+	t.Run("DeleteSession keeps secrets shared with another session", func(t *testing.T) {
+		first := &SSHSession{Name: "nas", Host: "10.0.0.9", User: "admin", Password: "shared"}
+		second := &SSHSession{Name: "nas-by-ip", Host: "10.0.0.9", User: "admin", Password: "shared"}
+		for _, session := range []*SSHSession{first, second} {
+			if err := SaveSession(session); err != nil {
+				t.Fatalf("save session: %v", err)
+			}
+		}
+		t.Cleanup(func() { DeleteSession(second.Name) })
+
+		if err := DeleteSession(first.Name); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[credentialsKey("10.0.0.9", 0, "admin")]; !ok {
+			t.Fatalf("expected the password to stay for %s", second.Name)
+		}
+	})
+
+	t.Run("DeleteSession keeps a key passphrase shared with another session", func(t *testing.T) {
+		keyFile := "/home/admin/.ssh/id_ed25519"
+		nas := &SSHSession{Name: "nas", Host: "10.0.0.9", User: "admin", AuthMethod: AuthPublicKey, KeyFile: keyFile, Passphrase: "hunter2"}
+		pi := &SSHSession{Name: "pi", Host: "10.0.0.7", User: "pi", AuthMethod: AuthPublicKey, KeyFile: keyFile, Passphrase: "hunter2"}
+		for _, session := range []*SSHSession{nas, pi} {
+			if err := SaveSession(session); err != nil {
+				t.Fatalf("save session: %v", err)
+			}
+		}
+		secrets[sudoKey(nas.Host, nas.Port, nas.User)] = "sudo"
+
+		if err := DeleteSession(nas.Name); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[passphraseKey(keyFile)]; !ok {
+			t.Fatalf("expected the passphrase to stay for %s", pi.Name)
+		}
+		if _, ok := secrets[sudoKey(nas.Host, nas.Port, nas.User)]; ok {
+			t.Fatalf("expected the sudo password of %s removed", nas.Name)
+		}
+
+		if err := DeleteSession(pi.Name); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[passphraseKey(keyFile)]; ok {
+			t.Fatalf("expected the passphrase removed with the last session using it")
+		}
+	})
+
+	t.Run("aliases behind one address keep their own passwords", func(t *testing.T) {
+		web := &SSHSession{Name: "web", Host: "203.0.113.5", Port: 2201, User: "admin", Password: "web-secret"}
+		db := &SSHSession{Name: "db", Host: "203.0.113.5", Port: 2202, User: "admin", Password: "db-secret"}
+		for _, session := range []*SSHSession{web, db} {
+			if err := SaveSession(session); err != nil {
+				t.Fatalf("save session: %v", err)
+			}
+		}
+		t.Cleanup(func() { DeleteSession(db.Name) })
+
+		loaded, err := LoadSession(web.Name)
+		if err != nil || loaded.Password != "web-secret" {
+			t.Fatalf("expected the web password, got %q (%v)", loaded.Password, err)
+		}
+
+		if err := DeleteSession(web.Name); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, ok := secrets[credentialsKey(web.Host, web.Port, web.User)]; ok {
+			t.Fatalf("expected the password of %s removed", web.Name)
+		}
+		if got := secrets[credentialsKey(db.Host, db.Port, db.User)]; got != "db-secret" {
+			t.Fatalf("expected the password of %s kept, got %q", db.Name, got)
+		}
+	})
+
+	t.Run("passwords stored by older releases are migrated", func(t *testing.T) {
+		file, err := sessionFilePath("legacy-keys")
+		if err != nil {
+			t.Fatalf("session file path: %v", err)
+		}
+		if err := writeSessionData(file, SSHSessionConfig{Name: "legacy-keys", Host: "legacy.example", User: "admin",
+			Sudo: SudoPassword, Timeout: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("write session: %v", err)
+		}
+		secrets[legacyCredentialsKey("legacy.example", "admin")] = "old-secret"
+		secrets[legacySudoKey("legacy.example", "admin")] = "old-sudo"
+
+		loaded, err := LoadSession("legacy-keys")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Password != "old-secret" {
+			t.Fatalf("expected the legacy password, got %q", loaded.Password)
+		}
+		if got := secrets[credentialsKey("legacy.example", 22, "admin")]; got != "old-secret" {
+			t.Fatalf("expected the password copied to the per-port entry, got %q", got)
+		}
+
+		if err := DeleteSession("legacy-keys"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		for _, key := range []string{legacyCredentialsKey("legacy.example", "admin"), legacySudoKey("legacy.example", "admin"), credentialsKey("legacy.example", 0, "admin")} {
+			if _, ok := secrets[key]; ok {
+				t.Fatalf("expected %s removed with the last session using it", key)
+			}
+		}
+	})
+
+	t.Run("a session saved by older releases is migrated", func(t *testing.T) {
+		dir, err := sessionDir()
+		if err != nil {
+			t.Fatalf("sessionDir: %v", err)
+		}
+		legacy := &SSHSession{Host: "old.example", User: "admin", Password: "secret"}
+		if err := saveSessionToFile(filepath.Join(dir, legacySessionFile), legacy); err != nil {
+			t.Fatalf("save legacy session: %v", err)
+		}
+		t.Cleanup(func() { DeleteSession("old.example") })
+
+		loaded, err := LoadSession("")
+		if err != nil {
+			t.Fatalf("load session: %v", err)
+		}
+		if loaded.Name != "old.example" || loaded.Host != legacy.Host {
+			t.Fatalf("expected the migrated session, got %s@%s", loaded.Name, loaded.Host)
+		}
+		if _, err := os.Stat(filepath.Join(dir, legacySessionFile)); !os.IsNotExist(err) {
+			t.Fatalf("expected the legacy file removed, stat err=%v", err)
+		}
+	})
+}
+
+func TestSessionName(t *testing.T) {
+	tests := map[string]string{
+		"homelab-prod":  "homelab-prod",
+		"192.168.1.10":  "192.168.1.10",
+		"::1":           "__1",
+		"../etc/passwd": ".._etc_passwd",
+	}
+	for identifier, want := range tests {
+		if got := SessionName(identifier); got != want {
+			t.Errorf("SessionName(%q) = %q, want %q", identifier, got, want)
+		}
+	}
+
+	if _, err := sessionFilePath(".._etc_passwd"); err == nil {
+		t.Errorf("expected names starting with a dot to be rejected")
+	}
 }
 
 func stubKeyring() (map[string]string, func()) {
@@ -163,7 +477,7 @@ func stubKeyring() (map[string]string, func()) {
 	keyringGet = func(service, user string) (string, error) {
 		secret, ok := secrets[user]
 		if !ok {
-			return "", fmt.Errorf("secret %s not found", user)
+			return "", fmt.Errorf("secret %s not found: %w", user, keyring.ErrNotFound)
 		}
 		return secret, nil
 	}
@@ -182,12 +496,32 @@ func stubKeyring() (map[string]string, func()) {
 func stubNewSSHSession() func() {
 	original := newSSHSession
 
-	newSSHSession = func(host, user, password string) (*SSHSession, error) {
-		return &SSHSession{
-			Host:     host,
-			User:     user,
-			Password: password,
-		}, nil
+	var dial func(opts SessionOptions) *SSHSession
+	dial = func(opts SessionOptions) *SSHSession {
+		session := &SSHSession{
+			Host:           opts.Host,
+			Port:           opts.Port,
+			User:           opts.User,
+			Password:       opts.Auth.Password,
+			AuthMethod:     AuthPassword,
+			ConnectTimeout: opts.Timeout,
+			HostKeyPolicy:  opts.HostKeyPolicy,
+			Sudo:           opts.Sudo,
+		}
+		if opts.Auth.KeyFile != "" {
+			session.AuthMethod = AuthPublicKey
+			session.KeyFile = opts.Auth.KeyFile
+			session.Passphrase = opts.Auth.Passphrase
+			session.CertFile = opts.Auth.CertFile
+		}
+		for _, hop := range opts.Jumps {
+			session.Jumps = append(session.Jumps, dial(hop))
+		}
+		return session
+	}
+
+	newSSHSession = func(opts SessionOptions) (*SSHSession, error) {
+		return dial(opts), nil
 	}
 
 	return func() {
@@ -0,0 +1,418 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// ErrChecksumMismatch reports that a copied file does not hash the same on both ends.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// TransferOptions controls Upload and Download.
+type TransferOptions struct {
+	// Recursive allows copying directories.
+	Recursive bool
+	// Progress, if set, is called as each file is copied and once more with
+	// Done set after its checksum has been verified.
+	Progress func(TransferProgress)
+}
+
+// TransferProgress reports how far a single file has been copied.
+type TransferProgress struct {
+	Path  string
+	Bytes int64
+	Total int64
+	Done  bool
+}
+
+// TransferStats summarises a finished copy.
+type TransferStats struct {
+	Files int
+	Bytes int64
+	// Skipped lists entries that are neither regular files nor directories,
+	// such as symlinks and devices.
+	Skipped []string
+}
+
+// OpenSFTP starts the SFTP subsystem on the session's connection. The caller
+// must close the returned client.
+func (s *SSHSession) OpenSFTP(ctx context.Context) (*sftp.Client, error) {
+	if err := s.ensureConnected(ctx); err != nil {
+		return nil, err
+	}
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	return sftpClient, nil
+}
+
+// Upload copies localPath to remotePath like scp -p: permissions and
+// modification times are preserved, and a remotePath that is an existing
+// directory receives the source under its own name. Every file is verified
+// against a SHA-256 checksum computed on the server.
+func (s *SSHSession) Upload(ctx context.Context, localPath, remotePath string, opts TransferOptions) (*TransferStats, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() && !opts.Recursive {
+		return nil, fmt.Errorf("%s is a directory (copy it recursively)", localPath)
+	}
+
+	t, err := s.newTransfer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.client.Close()
+
+	target, err := t.remoteTarget(remotePath, filepath.Base(localPath))
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return &t.stats, t.upload(localPath, target, info)
+	}
+
+	var dirs []dirTimes
+	err = filepath.WalkDir(localPath, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return context.Cause(ctx)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, name)
+		if err != nil {
+			return err
+		}
+		dst := path.Join(target, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			if err := t.client.MkdirAll(dst); err != nil {
+				return fmt.Errorf("create %s: %w", dst, err)
+			}
+			if err := t.client.Chmod(dst, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("chmod %s: %w", dst, err)
+			}
+			dirs = append(dirs, dirTimes{path: dst, modTime: info.ModTime()})
+		case info.Mode().IsRegular():
+			return t.upload(name, dst, info)
+		default:
+			t.stats.Skipped = append(t.stats.Skipped, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return &t.stats, err
+	}
+
+	// Directory mtimes change as files are written, so they are set last,
+	// deepest first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := t.client.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return &t.stats, fmt.Errorf("set times on %s: %w", dirs[i].path, err)
+		}
+	}
+	return &t.stats, nil
+}
+
+// Download copies remotePath to localPath with the same semantics as Upload.
+func (s *SSHSession) Download(ctx context.Context, remotePath, localPath string, opts TransferOptions) (*TransferStats, error) {
+	t, err := s.newTransfer(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.client.Close()
+
+	source := sftpPath(remotePath)
+	info, err := t.client.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", remotePath, err)
+	}
+	if info.IsDir() && !opts.Recursive {
+		return nil, fmt.Errorf("%s is a directory (copy it recursively)", remotePath)
+	}
+
+	target := localTarget(localPath, path.Base(source))
+	if !info.IsDir() {
+		return &t.stats, t.download(source, target, info)
+	}
+
+	var dirs []dirTimes
+	walker := t.client.Walk(source)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return &t.stats, err
+		}
+		if err := ctx.Err(); err != nil {
+			return &t.stats, context.Cause(ctx)
+		}
+
+		info := walker.Stat()
+		dst := filepath.Join(target, filepath.FromSlash(remoteRel(source, walker.Path())))
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return &t.stats, err
+			}
+			if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+				return &t.stats, err
+			}
+			dirs = append(dirs, dirTimes{path: dst, modTime: info.ModTime()})
+		case info.Mode().IsRegular():
+			if err := t.download(walker.Path(), dst, info); err != nil {
+				return &t.stats, err
+			}
+		default:
+			t.stats.Skipped = append(t.stats.Skipped, walker.Path())
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return &t.stats, err
+		}
+	}
+	return &t.stats, nil
+}
+
+type dirTimes struct {
+	path    string
+	modTime time.Time
+}
+
+// transfer holds the state of one Upload or Download.
+type transfer struct {
+	ctx     context.Context
+	session *SSHSession
+	client  *sftp.Client
+	opts    TransferOptions
+	stats   TransferStats
+}
+
+func (s *SSHSession) newTransfer(ctx context.Context, opts TransferOptions) (*transfer, error) {
+	client, err := s.OpenSFTP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &transfer{ctx: ctx, session: s, client: client, opts: opts}, nil
+}
+
+// remoteTarget resolves where a source named base lands under dst.
+func (t *transfer) remoteTarget(dst, base string) (string, error) {
+	target := sftpPath(dst)
+	if strings.HasSuffix(dst, "/") {
+		return path.Join(target, base), nil
+	}
+
+	info, err := t.client.Stat(target)
+	switch {
+	case err == nil && info.IsDir():
+		return path.Join(target, base), nil
+	case err == nil, errors.Is(err, fs.ErrNotExist):
+		return target, nil
+	default:
+		return "", fmt.Errorf("stat %s: %w", dst, err)
+	}
+}
+
+// localTarget resolves where a source named base lands under dst.
+func localTarget(dst, base string) string {
+	if strings.HasSuffix(dst, string(filepath.Separator)) || strings.HasSuffix(dst, "/") {
+		return filepath.Join(dst, base)
+	}
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return filepath.Join(dst, base)
+	}
+	return dst
+}
+
+func (t *transfer) upload(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := t.client.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dst, err)
+	}
+
+	sum := sha256.New()
+	n, err := io.Copy(out, t.track(in, sum, dst, info.Size()))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", src, err)
+	}
+
+	if err := t.client.Chmod(dst, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod %s: %w", dst, err)
+	}
+	if err := t.client.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("set times on %s: %w", dst, err)
+	}
+	return t.verify(dst, sum, n)
+}
+
+func (t *transfer) download(src, dst string, info fs.FileInfo) error {
+	in, err := t.client.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.New()
+	n, err := io.Copy(out, t.track(in, sum, src, info.Size()))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download %s: %w", src, err)
+	}
+
+	// OpenFile's mode is filtered by the umask and ignored for existing files.
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return t.verify(src, sum, n)
+}
+
+// verify compares the hash of the bytes that were copied with the checksum
+// of the remote file.
+func (t *transfer) verify(remotePath string, sum hash.Hash, n int64) error {
+	want := hex.EncodeToString(sum.Sum(nil))
+	got, err := t.session.remoteChecksum(t.ctx, t.client, remotePath)
+	if err != nil {
+		return fmt.Errorf("checksum %s: %w", remotePath, err)
+	}
+	if got != want {
+		return fmt.Errorf("%w for %s: copied %s, server has %s", ErrChecksumMismatch, remotePath, want, got)
+	}
+
+	t.stats.Files++
+	t.stats.Bytes += n
+	t.report(TransferProgress{Path: remotePath, Bytes: n, Total: n, Done: true})
+	return nil
+}
+
+// remoteChecksum hashes a remote file with sha256sum, or by reading it back
+// over SFTP on hosts without coreutils.
+func (s *SSHSession) remoteChecksum(ctx context.Context, client *sftp.Client, name string) (string, error) {
+	result, err := s.Exec(ctx, "sha256sum -- "+ShellQuote(name))
+	if err == nil {
+		sum, _, _ := strings.Cut(strings.TrimSpace(result.Stdout), " ")
+		if len(sum) != sha256.Size*2 {
+			return "", fmt.Errorf("unexpected sha256sum output %q", result.Stdout)
+		}
+		return sum, nil
+	}
+	if result == nil || !result.CommandNotFound() {
+		return "", err
+	}
+
+	file, err := client.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (t *transfer) report(progress TransferProgress) {
+	if t.opts.Progress != nil {
+		t.opts.Progress(progress)
+	}
+}
+
+// track hashes what is read from r and reports progress, stopping when the
+// transfer's context is cancelled.
+func (t *transfer) track(r io.Reader, sum hash.Hash, name string, total int64) io.Reader {
+	return &progressReader{transfer: t, r: io.TeeReader(r, sum), name: name, total: total}
+}
+
+type progressReader struct {
+	transfer *transfer
+	r        io.Reader
+	name     string
+	read     int64
+	total    int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.transfer.ctx.Err(); err != nil {
+		return 0, context.Cause(p.transfer.ctx)
+	}
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.transfer.report(TransferProgress{Path: p.name, Bytes: p.read, Total: p.total})
+	}
+	return n, err
+}
+
+// remoteRel returns name relative to the walk root.
+func remoteRel(root, name string) string {
+	switch {
+	case name == root:
+		return ""
+	case root == ".":
+		return name
+	default:
+		return strings.TrimPrefix(name, strings.TrimSuffix(root, "/")+"/")
+	}
+}
+
+// sftpPath maps shell-style home paths onto SFTP paths, which are relative
+// to the login directory.
+func sftpPath(name string) string {
+	switch {
+	case name == "" || name == "~":
+		return "."
+	case strings.HasPrefix(name, "~/"):
+		return path.Clean(strings.TrimPrefix(name, "~/"))
+	default:
+		return path.Clean(name)
+	}
+}
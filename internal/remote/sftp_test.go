@@ -0,0 +1,131 @@
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionTransfer(t *testing.T) {
+	server := startForwardingServer(t, "secret")
+	session := newTestSession(t, server)
+	ctx := context.Background()
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeFile := func(t *testing.T, name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(name, []byte(content), mode); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatalf("chmod %s: %v", name, err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatalf("chtimes %s: %v", name, err)
+		}
+	}
+	assertFile := func(t *testing.T, name, content string, mode os.FileMode) {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s = %q, want %q", name, data, content)
+		}
+		info, _ := os.Stat(name)
+		if info.Mode().Perm() != mode {
+			t.Fatalf("%s mode = %v, want %v", name, info.Mode().Perm(), mode)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Fatalf("%s mtime = %v, want %v", name, info.ModTime(), modTime)
+		}
+	}
+
+	t.Run("uploads a file into an existing directory", func(t *testing.T) {
+		local := filepath.Join(t.TempDir(), "notes.txt")
+		writeFile(t, local, "hello", 0o640)
+		remoteDir := t.TempDir()
+
+		var progress []TransferProgress
+		stats, err := session.Upload(ctx, local, remoteDir, TransferOptions{
+			Progress: func(p TransferProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		assertFile(t, filepath.Join(remoteDir, "notes.txt"), "hello", 0o640)
+		if stats.Files != 1 || stats.Bytes != 5 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+		if len(progress) == 0 || !progress[len(progress)-1].Done {
+			t.Fatalf("expected progress ending with Done, got %+v", progress)
+		}
+	})
+
+	t.Run("refuses directories without recursion", func(t *testing.T) {
+		if _, err := session.Upload(ctx, t.TempDir(), t.TempDir(), TransferOptions{}); err == nil {
+			t.Fatalf("expected directory upload to need Recursive")
+		}
+	})
+
+	t.Run("round-trips a directory tree", func(t *testing.T) {
+		source := filepath.Join(t.TempDir(), "configs")
+		writeFile(t, filepath.Join(source, "a.yaml"), "a: 1\n", 0o600)
+		writeFile(t, filepath.Join(source, "nested", "run.sh"), "#!/bin/sh\n", 0o755)
+		if err := os.Symlink("a.yaml", filepath.Join(source, "link.yaml")); err != nil {
+			t.Fatalf("symlink: %v", err)
+		}
+
+		remoteDir := t.TempDir()
+		stats, err := session.Upload(ctx, source, remoteDir+"/", TransferOptions{Recursive: true})
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		if stats.Files != 2 || len(stats.Skipped) != 1 {
+			t.Fatalf("expected 2 files and a skipped symlink, got %+v", stats)
+		}
+
+		local := filepath.Join(t.TempDir(), "restored")
+		if _, err := session.Download(ctx, filepath.Join(remoteDir, "configs"), local, TransferOptions{Recursive: true}); err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		assertFile(t, filepath.Join(local, "a.yaml"), "a: 1\n", 0o600)
+		assertFile(t, filepath.Join(local, "nested", "run.sh"), "#!/bin/sh\n", 0o755)
+	})
+
+	t.Run("verifies by reading back without sha256sum", func(t *testing.T) {
+		server.noSha256sum = true
+		t.Cleanup(func() { server.noSha256sum = false })
+
+		remote := filepath.Join(t.TempDir(), "remote.txt")
+		writeFile(t, remote, "from the server", 0o644)
+
+		local := filepath.Join(t.TempDir(), "copy.txt")
+		if _, err := session.Download(ctx, remote, local, TransferOptions{}); err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		assertFile(t, local, "from the server", 0o644)
+	})
+}
+
+func TestSFTPPath(t *testing.T) {
+	tests := map[string]string{
+		"":              ".",
+		"~":             ".",
+		"~/backups/":    "backups",
+		"/var/log/":     "/var/log",
+		"relative/./x":  "relative/x",
+		"/tmp/file.txt": "/tmp/file.txt",
+	}
+	for input, want := range tests {
+		if got := sftpPath(input); got != want {
+			t.Errorf("sftpPath(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
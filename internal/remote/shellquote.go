@@ -0,0 +1,13 @@
+package remote
+
+import "strings"
+
+// ShellQuote wraps a value in single quotes and escapes any embedded single
+// quotes, so user-supplied values can be interpolated in remote shell
+// commands.
+func ShellQuote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(value, "'", "'\\''") + "'"
+}
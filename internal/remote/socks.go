@@ -0,0 +1,333 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultProxyListen is where Proxy listens when no address is given.
+const DefaultProxyListen = "127.0.0.1:1080"
+
+// socksHandshakeTimeout bounds how long a client may take to negotiate.
+const socksHandshakeTimeout = 10 * time.Second
+
+// ErrDestinationDenied reports a CONNECT to an address outside the allowlist.
+var ErrDestinationDenied = errors.New("destination not in allowlist")
+
+// ProxyOptions configures the SOCKS5 server started by Proxy.
+type ProxyOptions struct {
+	// Listen defaults to DefaultProxyListen.
+	Listen string
+	// Username enables RFC 1929 username/password authentication; without it
+	// clients connect with no authentication.
+	Username string
+	Password string
+	// Allow restricts CONNECT destinations. Each entry is a hostname (with
+	// * wildcards), an IP address or a CIDR range, optionally followed by
+	// :port. An empty list allows everything.
+	Allow []string
+}
+
+const (
+	socksVersion          = 5
+	socksAuthNone         = 0x00
+	socksAuthUser         = 0x02
+	socksAuthNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksSucceeded         = 0x00
+	socksNotAllowed        = 0x02
+	socksHostUnreachable   = 0x04
+	socksCmdNotSupported   = 0x07
+	socksAtypNotSupported  = 0x08
+	socksUserAuthVersion   = 0x01
+	socksUserAuthSucceeded = 0x00
+	socksUserAuthRejected  = 0x01
+)
+
+// Proxy runs a SOCKS5 server that tunnels every CONNECT through the session,
+// so the client reaches addresses as the server sees them. Connections are
+// reported as ForwardEvents whose Spec is the listen address and the
+// requested destination; clients that fail the handshake are reported with
+// an empty RemoteHost. Proxy returns nil once ctx is cancelled.
+func (s *SSHSession) Proxy(ctx context.Context, opts ProxyOptions, onEvent func(ForwardEvent)) error {
+	rules, err := parseAllowRules(opts.Allow)
+	if err != nil {
+		return err
+	}
+
+	listen := opts.Listen
+	if listen == "" {
+		listen = DefaultProxyListen
+	}
+	bindHost, bindPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", listen, err)
+	}
+
+	local := ForwardSpec{BindAddress: bindHost}
+	local.LocalPort, _ = strconv.Atoi(bindPort)
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		local.LocalPort = addr.Port
+	}
+
+	f := newForwarder(ctx, s, onEvent)
+	socks := &socksServer{forwarder: f, opts: opts, rules: rules, local: local}
+	return f.run([]net.Listener{listener}, []func(net.Conn){socks.handle})
+}
+
+type socksServer struct {
+	forwarder *forwarder
+	opts      ProxyOptions
+	rules     []allowRule
+	local     ForwardSpec
+}
+
+func (p *socksServer) handle(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	host, port, err := p.handshake(conn)
+	if err != nil {
+		// Only the close is reported: there was never a destination to open.
+		p.forwarder.fail(p.forwarder.event(conn, p.local), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	spec := p.local
+	spec.RemoteHost, spec.RemotePort = host, port
+	event := p.forwarder.open(conn, spec)
+
+	if !allowed(p.rules, host, port) {
+		socksReply(conn, socksNotAllowed)
+		p.forwarder.fail(event, fmt.Errorf("%w: %s", ErrDestinationDenied, spec.RemoteAddr()))
+		return
+	}
+
+	remote, err := p.forwarder.dial(spec.RemoteAddr())
+	if err != nil {
+		socksReply(conn, socksHostUnreachable)
+		p.forwarder.fail(event, err)
+		return
+	}
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		remote.Close()
+		p.forwarder.fail(event, err)
+		return
+	}
+	p.forwarder.relay(conn, remote, event)
+}
+
+// handshake negotiates authentication and reads a CONNECT request.
+func (p *socksServer) handshake(conn net.Conn) (string, int, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", 0, fmt.Errorf("read greeting: %w", err)
+	}
+	if header[0] != socksVersion {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", 0, fmt.Errorf("read auth methods: %w", err)
+	}
+
+	method := byte(socksAuthNone)
+	if p.opts.Username != "" {
+		method = socksAuthUser
+	}
+	if bytes.IndexByte(methods, method) < 0 {
+		conn.Write([]byte{socksVersion, socksAuthNoAcceptable})
+		return "", 0, errors.New("client does not support the required authentication method")
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", 0, err
+	}
+	if method == socksAuthUser {
+		if err := p.authenticate(conn); err != nil {
+			return "", 0, err
+		}
+	}
+
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return "", 0, fmt.Errorf("read request: %w", err)
+	}
+	if request[0] != socksVersion {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", 0, fmt.Errorf("read address: %w", err)
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return "", 0, fmt.Errorf("read address: %w", err)
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", 0, fmt.Errorf("read address: %w", err)
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAtypNotSupported)
+		return "", 0, fmt.Errorf("unsupported address type %d", request[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", 0, fmt.Errorf("read port: %w", err)
+	}
+	if request[1] != socksCmdConnect {
+		socksReply(conn, socksCmdNotSupported)
+		return "", 0, fmt.Errorf("unsupported SOCKS command %d (only CONNECT)", request[1])
+	}
+	return host, int(binary.BigEndian.Uint16(port[:])), nil
+}
+
+// authenticate runs the RFC 1929 username/password exchange.
+func (p *socksServer) authenticate(conn net.Conn) error {
+	readField := func() ([]byte, error) {
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		field := make([]byte, length[0])
+		_, err := io.ReadFull(conn, field)
+		return field, err
+	}
+
+	var version [1]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+	username, err := readField()
+	if err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+	password, err := readField()
+	if err != nil {
+		return fmt.Errorf("read credentials: %w", err)
+	}
+
+	userOK := subtle.ConstantTimeCompare(username, []byte(p.opts.Username)) == 1
+	passOK := subtle.ConstantTimeCompare(password, []byte(p.opts.Password)) == 1
+	if version[0] != socksUserAuthVersion || !userOK || !passOK {
+		conn.Write([]byte{socksUserAuthVersion, socksUserAuthRejected})
+		return fmt.Errorf("authentication failed for user %q", username)
+	}
+	_, err = conn.Write([]byte{socksUserAuthVersion, socksUserAuthSucceeded})
+	return err
+}
+
+// socksReply answers a request. The bound address is not meaningful for a
+// tunnel, so it is always 0.0.0.0:0.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// allowRule is one parsed ProxyOptions.Allow entry.
+type allowRule struct {
+	pattern string
+	network *net.IPNet
+	// port is 0 when any port is allowed.
+	port int
+}
+
+func parseAllowRules(entries []string) ([]allowRule, error) {
+	var rules []allowRule
+	for _, entry := range entries {
+		rule, err := parseAllowRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseAllowRule(entry string) (allowRule, error) {
+	host := strings.TrimSpace(entry)
+	var rule allowRule
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		port, err := parsePort(p)
+		if err != nil {
+			return allowRule{}, fmt.Errorf("invalid allow entry %q: %w", entry, err)
+		}
+		host, rule.port = h, port
+	}
+	if host == "" {
+		return allowRule{}, fmt.Errorf("invalid allow entry %q: empty host", entry)
+	}
+
+	if strings.Contains(host, "/") {
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return allowRule{}, fmt.Errorf("invalid allow entry %q: %w", entry, err)
+		}
+		rule.network = network
+		return rule, nil
+	}
+	if _, err := path.Match(host, ""); err != nil {
+		return allowRule{}, fmt.Errorf("invalid allow entry %q: %w", entry, err)
+	}
+	rule.pattern = strings.ToLower(host)
+	return rule, nil
+}
+
+// allowed reports whether host:port matches a rule. CIDR rules only match
+// literal IP destinations, since names are resolved on the server.
+func allowed(rules []allowRule, host string, port int) bool {
+	if len(rules) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	host = strings.ToLower(host)
+	for _, rule := range rules {
+		if rule.port != 0 && rule.port != port {
+			continue
+		}
+		if rule.network != nil {
+			if ip != nil && rule.network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(rule.pattern, host); ok {
+			return true
+		}
+		if ip != nil && net.ParseIP(rule.pattern).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
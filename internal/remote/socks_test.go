@@ -0,0 +1,202 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAllowRules(t *testing.T) {
+	rules, err := parseAllowRules([]string{"192.168.1.0/24", "*.lan", "grafana.internal:3000", "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("parseAllowRules: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		port int
+		want bool
+	}{
+		{host: "192.168.1.20", port: 80, want: true},
+		{host: "192.168.2.20", port: 80, want: false},
+		{host: "pihole.lan", port: 443, want: true},
+		{host: "PiHole.LAN", port: 443, want: true},
+		{host: "grafana.internal", port: 3000, want: true},
+		{host: "grafana.internal", port: 22, want: false},
+		{host: "10.0.0.5", port: 8080, want: true},
+		{host: "example.com", port: 443, want: false},
+	}
+	for _, tt := range tests {
+		if got := allowed(rules, tt.host, tt.port); got != tt.want {
+			t.Errorf("allowed(%s:%d) = %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	if !allowed(nil, "anything", 1) {
+		t.Errorf("expected an empty allowlist to allow everything")
+	}
+
+	for _, entry := range []string{"10.0.0.0/33", "host:99999", "[bad", ""} {
+		if _, err := parseAllowRule(entry); err == nil {
+			t.Errorf("parseAllowRule(%q) succeeded, want error", entry)
+		}
+	}
+}
+
+func TestSessionProxy(t *testing.T) {
+	session := newTestSession(t, startForwardingServer(t, "secret"))
+
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, "hello from the lan")
+			}()
+		}
+	}()
+	servicePort := service.Addr().(*net.TCPAddr).Port
+
+	listen := net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t)))
+	opts := ProxyOptions{
+		Listen:   listen,
+		Username: "lab",
+		Password: "pass",
+		Allow:    []string{"127.0.0.0/8"},
+	}
+
+	var mu sync.Mutex
+	var events []ForwardEvent
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Proxy(ctx, opts, func(event ForwardEvent) {
+			if event.Closed {
+				mu.Lock()
+				events = append(events, event)
+				mu.Unlock()
+			}
+		})
+	}()
+
+	t.Run("tunnels an authenticated CONNECT", func(t *testing.T) {
+		conn, reply, err := socksConnect(listen, "lab", "pass", "127.0.0.1", servicePort)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer conn.Close()
+		if reply != socksSucceeded {
+			t.Fatalf("reply = %d, want success", reply)
+		}
+		data, _ := io.ReadAll(conn)
+		if string(data) != "hello from the lan" {
+			t.Fatalf("read %q", data)
+		}
+	})
+
+	t.Run("rejects a wrong password", func(t *testing.T) {
+		if _, _, err := socksConnect(listen, "lab", "nope", "127.0.0.1", servicePort); err == nil {
+			t.Fatalf("expected authentication to fail")
+		}
+	})
+
+	t.Run("denies destinations outside the allowlist", func(t *testing.T) {
+		conn, reply, err := socksConnect(listen, "lab", "pass", "grafana.lan", 3000)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		conn.Close()
+		if reply != socksNotAllowed {
+			t.Fatalf("reply = %d, want not allowed", reply)
+		}
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Proxy: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Proxy did not stop after cancellation")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 close events, got %+v", events)
+	}
+	var tunnelled, rejected, denied int
+	for _, event := range events {
+		switch {
+		case errors.Is(event.Err, ErrDestinationDenied):
+			denied++
+		case event.Spec.RemoteHost == "" && event.Err != nil:
+			rejected++
+		case event.Err == nil && event.Received == int64(len("hello from the lan")):
+			tunnelled++
+		}
+	}
+	if tunnelled != 1 || rejected != 1 || denied != 1 {
+		t.Fatalf("expected one tunnelled, rejected and denied event, got %+v", events)
+	}
+}
+
+// socksConnect performs a username/password SOCKS5 CONNECT to a domain or IP
+// and returns the connection with the server's reply code.
+func socksConnect(proxyAddr, username, password, host string, port int) (net.Conn, byte, error) {
+	conn, err := dialWithRetry(proxyAddr)
+	if err != nil {
+		return nil, 0, err
+	}
+	fail := func(err error) (net.Conn, byte, error) {
+		conn.Close()
+		return nil, 0, err
+	}
+
+	conn.Write([]byte{socksVersion, 1, socksAuthUser})
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil || choice[1] != socksAuthUser {
+		return fail(fmt.Errorf("auth method refused: %v %v", choice, err))
+	}
+
+	auth := []byte{socksUserAuthVersion, byte(len(username))}
+	auth = append(auth, username...)
+	auth = append(auth, byte(len(password)))
+	auth = append(auth, password...)
+	conn.Write(auth)
+	var status [2]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil || status[1] != socksUserAuthSucceeded {
+		return fail(fmt.Errorf("authentication rejected: %v %v", status, err))
+	}
+
+	request := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		request = append(append(request, socksAtypIPv4), ip...)
+	} else {
+		request = append(append(request, socksAtypDomain, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	conn.Write(request)
+
+	var reply [10]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fail(fmt.Errorf("read reply: %w", err))
+	}
+	return conn, reply[1], nil
+}
@@ -2,8 +2,13 @@ package remote
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -12,106 +17,535 @@ import (
 const keyringService = "labman"
 
 type SSHSession struct {
-	Client   *ssh.Client
-	Host     string
-	User     string
-	Password string
+	Client *ssh.Client
+	// Name is the alias the session is cached under, see SaveSession.
+	Name       string
+	Host       string
+	Port       int
+	User       string
+	Password   string
+	AuthMethod string
+	KeyFile    string
+	Passphrase string
+	// CertFile is the user certificate presented with KeyFile, if any.
+	CertFile       string
+	ConnectTimeout time.Duration
+	HostKeyPolicy  HostKeyPolicy
+	// Jumps holds the bastion sessions this session is tunnelled through.
+	Jumps []*SSHSession
+	// KeepaliveInterval is how often keepalive@openssh.com is sent.
+	KeepaliveInterval time.Duration
+	// Reconnect enables re-dialing a dropped connection. Nil disables it.
+	Reconnect *ReconnectPolicy
+	// OnReconnect is told about every reconnect attempt.
+	OnReconnect func(ReconnectEvent)
+	// CommandTimeout bounds every remote command. Zero means no limit.
+	CommandTimeout time.Duration
+	// Sudo selects how RunSudo and friends gain root.
+	Sudo SudoMode
+	// SudoPassword is fed to sudo when it differs from the login password,
+	// e.g. for key-based logins.
+	SudoPassword string
+	// Expiry controls how long SaveSession keeps the session cached.
+	Expiry SessionExpiry
+
+	mu          sync.Mutex
+	reconnectMu sync.Mutex
+	transport   *transport
+	// dialOpts re-creates this session with the credentials that worked.
+	dialOpts SessionOptions
+	// daemon runs commands for sessions loaded through a running daemon.
+	// Channels that cannot go through it (SFTP, forwards, terminals) dial
+	// the host directly with dialDirect on first use.
+	daemon     *daemonClient
+	dialDirect func() (*SSHSession, error)
+	directOnce sync.Once
+	directErr  error
+	// daemonServed marks the daemon's own sessions, whose commands are
+	// audited by the client that asked for them.
+	daemonServed bool
+	// facts caches what Facts probed.
+	facts   *Facts
+	factsMu sync.Mutex
 }
 
 type SSHSessionConfig struct {
-	Host    string    `yaml:"host"`
-	User    string    `yaml:"user"`
-	Timeout time.Time `yaml:"timeout"`
+	Name              string             `yaml:"name,omitempty"`
+	Host              string             `yaml:"host"`
+	Port              int                `yaml:"port,omitempty"`
+	User              string             `yaml:"user"`
+	Timeout           time.Time          `yaml:"timeout"`
+	AuthMethod        string             `yaml:"auth_method,omitempty"`
+	KeyFile           string             `yaml:"key_file,omitempty"`
+	CertFile          string             `yaml:"cert_file,omitempty"`
+	ConnectTimeout    time.Duration      `yaml:"connect_timeout,omitempty"`
+	HostKeyPolicy     HostKeyPolicy      `yaml:"host_key_policy,omitempty"`
+	Jumps             []SSHSessionConfig `yaml:"jumps,omitempty"`
+	KeepaliveInterval time.Duration      `yaml:"keepalive_interval,omitempty"`
+	Sudo              SudoMode           `yaml:"sudo,omitempty"`
+	LoginAt           time.Time          `yaml:"login_at,omitempty"`
+	TTL               time.Duration      `yaml:"ttl,omitempty"`
+	Sliding           bool               `yaml:"sliding,omitempty"`
+	MaxTTL            time.Duration      `yaml:"max_ttl,omitempty"`
+	// Facts is the platform probed by SSHSession.Facts, dropped at login.
+	Facts *Facts `yaml:"facts,omitempty"`
+}
+
+// HostKeyPolicy controls what happens when a server's key is not in known_hosts.
+type HostKeyPolicy string
+
+const (
+	// HostKeyAsk shows the fingerprint and asks through HostKeyPrompt (default).
+	HostKeyAsk HostKeyPolicy = "ask"
+	// HostKeyStrict only accepts keys already in known_hosts.
+	HostKeyStrict HostKeyPolicy = "strict"
+	// HostKeyAcceptNew records unknown keys without asking. Changed keys still fail.
+	HostKeyAcceptNew HostKeyPolicy = "accept-new"
+)
+
+// DefaultConnectTimeout bounds the TCP connect and SSH handshake when no timeout is configured.
+const DefaultConnectTimeout = 30 * time.Second
+
+// SessionOptions describes how to reach and authenticate to a host.
+type SessionOptions struct {
+	Host          string
+	Port          int
+	User          string
+	Timeout       time.Duration
+	Auth          AuthOptions
+	HostKeyPolicy HostKeyPolicy
+	// KnownHostsFile overrides ~/.ssh/known_hosts.
+	KnownHostsFile string
+	// Jumps lists bastion hosts dialed in order before Host. Each hop
+	// authenticates and verifies its host key independently.
+	Jumps []SessionOptions
+	// KeepaliveInterval defaults to DefaultKeepaliveInterval; negative
+	// disables keepalives.
+	KeepaliveInterval time.Duration
+	Sudo              SudoMode
 }
 
-func NewSSHSession(host, user, password string) (*SSHSession, error) {
+// Addr returns the host:port to dial.
+func (o SessionOptions) Addr() string {
+	port := o.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(o.Host, strconv.Itoa(port))
+}
+
+func (o SessionOptions) hostKeyPrompt() (HostKeyPromptFunc, error) {
+	switch o.HostKeyPolicy {
+	case "", HostKeyAsk:
+		return HostKeyPrompt, nil
+	case HostKeyStrict:
+		return nil, nil
+	case HostKeyAcceptNew:
+		return func(string, ssh.PublicKey) (bool, error) { return true, nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown host key policy %q", o.HostKeyPolicy)
+	}
+}
+
+var defaultHostKeyAlgorithms = []string{
+	ssh.KeyAlgoRSASHA256,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoED25519,
+}
+
+// NewSSHSession dials opts.Host, first hopping through any jump hosts in order.
+func NewSSHSession(opts SessionOptions) (*SSHSession, error) {
+	var jumps []*SSHSession
+	var via *ssh.Client
+	for _, hop := range opts.Jumps {
+		hopSession, err := dialSession(hop, via)
+		if err != nil {
+			closeJumps(jumps)
+			return nil, fmt.Errorf("jump host %s: %w", hop.Addr(), err)
+		}
+		jumps = append(jumps, hopSession)
+		via = hopSession.Client
+	}
+
+	session, err := dialSession(opts, via)
+	if err != nil {
+		closeJumps(jumps)
+		return nil, err
+	}
+	session.Jumps = jumps
+	for _, hop := range jumps {
+		session.dialOpts.Jumps = append(session.dialOpts.Jumps, hop.dialOpts)
+	}
+
+	interval := opts.KeepaliveInterval
+	if interval == 0 {
+		interval = DefaultKeepaliveInterval
+	}
+	session.KeepaliveInterval = opts.KeepaliveInterval
+	session.transport = watchTransport(session.Client, interval)
+	return session, nil
+}
+
+// dialSession authenticates to a single host, directly or through via.
+func dialSession(opts SessionOptions, via *ssh.Client) (*SSHSession, error) {
+	addr := opts.Addr()
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	prompt, err := opts.hostKeyPrompt()
+	if err != nil {
+		return nil, err
+	}
+	verifyHostKey, err := trustOnFirstUse(opts.KnownHostsFile, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("prepare host key verification: %w", err)
+	}
+
+	hostKeyAlgorithms := knownHostAlgorithms(opts.KnownHostsFile, addr)
+	if len(hostKeyAlgorithms) == 0 {
+		hostKeyAlgorithms = defaultHostKeyAlgorithms
+	}
+
+	state := &authState{opts: opts.Auth}
+	defer state.close()
+	authMethods := state.authMethods()
+	if len(authMethods) == 0 {
+		if err := state.unavailable(); err != nil {
+			return nil, fmt.Errorf("no authentication method available for %s@%s: %w", opts.User, opts.Host, err)
+		}
+		return nil, fmt.Errorf("no authentication method available for %s@%s", opts.User, opts.Host)
+	}
 
 	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		HostKeyAlgorithms: []string{
-			ssh.KeyAlgoRSASHA256,
-			ssh.KeyAlgoRSASHA512,
-			ssh.KeyAlgoRSA,
-			ssh.KeyAlgoECDSA256,
-			ssh.KeyAlgoECDSA384,
-			ssh.KeyAlgoECDSA521,
-			ssh.KeyAlgoED25519,
-		},
-		Timeout: 30 * time.Second,
-	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:22", host), config)
+		User:              opts.User,
+		Auth:              authMethods,
+		HostKeyCallback:   verifyHostKey,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           timeout,
+	}
+
+	client, err := dialClient(addr, config, via)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial: %w", err)
+		if problems := state.unavailable(); problems != nil {
+			return nil, fmt.Errorf("failed to dial %s: %w (skipped auth: %v)", addr, err, problems)
+		}
+		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
 	}
 
-	return &SSHSession{
-		Client:   client,
-		Host:     host,
-		User:     user,
-		Password: password,
-	}, nil
+	session := &SSHSession{
+		Client:         client,
+		Host:           opts.Host,
+		Port:           opts.Port,
+		User:           opts.User,
+		Password:       state.password,
+		AuthMethod:     state.method(),
+		ConnectTimeout: opts.Timeout,
+		HostKeyPolicy:  opts.HostKeyPolicy,
+		Sudo:           opts.Sudo,
+	}
+	if session.AuthMethod == AuthPublicKey {
+		session.KeyFile = opts.Auth.KeyFile
+		session.Passphrase = state.passphrase
+		session.CertFile = state.certFile
+	}
+
+	// Re-dials must not prompt again, so pin the method and secret that worked.
+	session.dialOpts = opts
+	session.dialOpts.Jumps = nil
+	session.dialOpts.Auth = AuthOptions{
+		Methods:    []string{session.AuthMethod},
+		Password:   session.Password,
+		KeyFile:    session.KeyFile,
+		Passphrase: session.Passphrase,
+		CertFile:   session.CertFile,
+	}
+	return session, nil
 }
 
+// Run executes cmd and returns its combined output. It is RunContext
+// without a caller context, so CommandTimeout still applies.
 func (s *SSHSession) Run(cmd string) (string, error) {
-	session, err := s.Client.NewSession()
+	return s.RunContext(context.Background(), cmd)
+}
+
+// RunContext executes cmd and returns its combined output, which is kept
+// even when the command fails. Use Exec to inspect stdout, stderr and the
+// exit status separately.
+func (s *SSHSession) RunContext(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(s.Exec(ctx, cmd))
+}
+
+// RunIdempotent is RunContext for commands that are safe to repeat: if the
+// connection drops while cmd runs, it reconnects and runs cmd again.
+func (s *SSHSession) RunIdempotent(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(s.ExecIdempotent(ctx, cmd))
+}
+
+// ExecIdempotent is Exec with the retry of RunIdempotent.
+func (s *SSHSession) ExecIdempotent(ctx context.Context, cmd string) (*RunResult, error) {
+	result, err := s.Exec(ctx, cmd)
+	if s.Reconnect == nil || ctx.Err() != nil || !s.connectionLost(err) {
+		return result, err
+	}
+
+	if reconnectErr := s.reconnect(ctx, err); reconnectErr != nil {
+		return nil, reconnectErr
+	}
+	start := time.Now()
+	result, err = s.exec(ctx, cmd, nil)
+	s.audit(cmd, false, start, result, err)
+	return result, err
+}
+
+// Exec runs cmd and reports its stdout, stderr, exit status and duration. If
+// ctx is cancelled or CommandTimeout elapses, the remote process is sent
+// SIGINT and the channel is closed. A session with a reconnect policy
+// re-dials first if the connection has dropped.
+//
+// When the command itself fails, both the result and a *CommandError are
+// returned; a nil result means the command never started.
+func (s *SSHSession) Exec(ctx context.Context, cmd string) (*RunResult, error) {
+	start := time.Now()
+	if err := s.ensureConnected(ctx); err != nil {
+		s.audit(cmd, false, start, nil, err)
+		return nil, err
+	}
+	result, err := s.exec(ctx, cmd, nil)
+	s.audit(cmd, false, start, result, err)
+	return result, err
+}
+
+// exec runs cmd, feeding it stdin when one is given.
+func (s *SSHSession) exec(ctx context.Context, cmd string, stdin io.Reader) (*RunResult, error) {
+	if s.daemon != nil {
+		return s.daemon.exec(ctx, s, cmd, false)
+	}
+	ctx, cancel := s.commandContext(ctx)
+	defer cancel()
+
+	client, err := s.client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	session, err := client.NewSession()
 	if err != nil {
-		return "", fmt.Errorf("failed to create session: %w", err)
+		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 	defer session.Close()
 
-	output, err := session.CombinedOutput(cmd)
-	if err != nil {
-		return "", fmt.Errorf("failed to run command: %w", err)
+	var stdout, stderr, combined syncBuffer
+	session.Stdin = stdin
+	session.Stdout = io.MultiWriter(&stdout, &combined)
+	session.Stderr = io.MultiWriter(&stderr, &combined)
+
+	start := time.Now()
+	if err := session.Start(cmd); err != nil {
+		return nil, fmt.Errorf("failed to run command: %w", err)
 	}
+	waitErr := waitContext(ctx, session, session.Wait)
 
-	return string(output), nil
+	result := &RunResult{
+		Command:  cmd,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Output:   combined.String(),
+		Duration: time.Since(start),
+	}
+	if waitErr != nil {
+		return result, fmt.Errorf("failed to run command: %w", result.fail(waitErr))
+	}
+	return result, nil
 }
 
+func combinedOutput(result *RunResult, err error) (string, error) {
+	if result == nil {
+		return "", err
+	}
+	return result.Output, err
+}
+
+// RunStream is RunStreamContext without a caller context.
 func (s *SSHSession) RunStream(cmd string, w io.Writer) error {
-	session, err := s.Client.NewSession()
+	return s.RunStreamContext(context.Background(), cmd, w)
+}
+
+// RunStreamContext executes cmd and copies its output to w line by line. It
+// is interrupted like Exec, and failures are reported as *CommandError with
+// the stderr tail.
+func (s *SSHSession) RunStreamContext(ctx context.Context, cmd string, w io.Writer) error {
+	start := time.Now()
+	err := s.ensureConnected(ctx)
+	if err == nil {
+		err = s.runStream(ctx, cmd, nil, w)
+	}
+	s.auditStream(cmd, false, start, err)
+	return err
+}
+
+// runStream streams cmd's output to w, feeding it stdin when one is given.
+func (s *SSHSession) runStream(ctx context.Context, cmd string, stdin io.Reader, w io.Writer) error {
+	if s.daemon != nil {
+		return s.daemon.stream(ctx, s, cmd, false, w)
+	}
+	ctx, cancel := s.commandContext(ctx)
+	defer cancel()
+
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	session, err := client.NewSession()
 	if err != nil {
 		return err
 	}
 	defer session.Close()
 
+	stderrTail := newTailBuffer(stderrTailBytes)
+	session.Stdin = stdin
 	stdout, _ := session.StdoutPipe()
 	stderr, _ := session.StderrPipe()
-	go io.Copy(w, stderr)
+	go io.Copy(io.MultiWriter(w, stderrTail), stderr)
 
+	start := time.Now()
 	if err := session.Start(cmd); err != nil {
 		return err
 	}
 
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		fmt.Fprintln(w, scanner.Text())
+	err = waitContext(ctx, session, func() error {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			fmt.Fprintln(w, scanner.Text())
+		}
+		return session.Wait()
+	})
+	if err != nil {
+		result := &RunResult{Command: cmd, Stderr: stderrTail.String(), Duration: time.Since(start)}
+		return result.fail(err)
+	}
+	return nil
+}
+
+// commandContext applies CommandTimeout to ctx.
+func (s *SSHSession) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withCommandTimeout(ctx, s.CommandTimeout)
+}
+
+// withCommandTimeout bounds ctx by timeout, when positive, with a cause that
+// says the command timed out.
+func withCommandTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("command timed out after %s", timeout))
+}
+
+// waitContext runs wait until the remote command finishes. If ctx ends first
+// the process is sent SIGINT and the channel closed, which also unblocks wait.
+func waitContext(ctx context.Context, session *ssh.Session, wait func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- wait() }()
 
-	if err := session.Wait(); err != nil {
+	select {
+	case err := <-done:
 		return err
+	case <-ctx.Done():
+		session.Signal(ssh.SIGINT)
+		session.Close()
+		return context.Cause(ctx)
 	}
+}
 
-	return nil
+// syncBuffer collects stdout and stderr, which the ssh package copies from
+// separate goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// tailBuffer keeps the last max bytes of a streamed command's stderr, which
+// has already gone to the caller and is only kept for the error message.
+type tailBuffer struct {
+	mu      sync.Mutex
+	max     int
+	buf     []byte
+	dropped bool
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max, buf: make([]byte, 0, max)}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if len(p) > b.max {
+		b.dropped = true
+		p = p[len(p)-b.max:]
+	}
+	if over := len(b.buf) + len(p) - b.max; over > 0 {
+		b.dropped = true
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// String marks a tail that lost its start with "...".
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped {
+		return "..." + string(b.buf)
+	}
+	return string(b.buf)
 }
 
 func (s *SSHSession) Close() error {
-	if s.Client != nil {
-		return s.Client.Close()
+	s.mu.Lock()
+	client, jumps, transport := s.Client, s.Jumps, s.transport
+	s.mu.Unlock()
+
+	if transport != nil {
+		transport.close()
 	}
-	return nil
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+	closeJumps(jumps)
+	return err
 }
 
 func (s *SSHSession) IsConnected() bool {
-	if s.Client == nil {
+	if s.daemon != nil {
+		return s.daemon.ping(s.Name) == nil
+	}
+	client, err := s.client()
+	if err != nil {
 		return false
 	}
 
-	session, err := s.Client.NewSession()
+	session, err := client.NewSession()
 	if err != nil {
 		return false
 	}
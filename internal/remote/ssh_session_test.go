@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSessionOptionsAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SessionOptions
+		want string
+	}{
+		{name: "defaults to port 22", opts: SessionOptions{Host: "lab.example"}, want: "lab.example:22"},
+		{name: "custom port", opts: SessionOptions{Host: "lab.example", Port: 2222}, want: "lab.example:2222"},
+		{name: "ipv6 literal", opts: SessionOptions{Host: "fd00::10", Port: 22}, want: "[fd00::10]:22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.Addr(); got != tt.want {
+				t.Errorf("Addr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionOptionsHostKeyPrompt(t *testing.T) {
+	original := HostKeyPrompt
+	t.Cleanup(func() { HostKeyPrompt = original })
+
+	asked := false
+	HostKeyPrompt = func(string, ssh.PublicKey) (bool, error) {
+		asked = true
+		return false, nil
+	}
+
+	t.Run("ask uses the interactive prompt", func(t *testing.T) {
+		prompt, err := SessionOptions{}.hostKeyPrompt()
+		if err != nil || prompt == nil {
+			t.Fatalf("expected prompt, got %v/%v", prompt, err)
+		}
+		prompt("lab.example:22", nil)
+		if !asked {
+			t.Fatalf("expected HostKeyPrompt to be used")
+		}
+	})
+
+	t.Run("strict has no prompt", func(t *testing.T) {
+		prompt, err := SessionOptions{HostKeyPolicy: HostKeyStrict}.hostKeyPrompt()
+		if err != nil || prompt != nil {
+			t.Fatalf("expected nil prompt, got %v/%v", prompt, err)
+		}
+	})
+
+	t.Run("accept-new accepts without asking", func(t *testing.T) {
+		prompt, err := SessionOptions{HostKeyPolicy: HostKeyAcceptNew}.hostKeyPrompt()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok, _ := prompt("lab.example:22", nil); !ok {
+			t.Fatalf("expected accept-new to accept")
+		}
+	})
+
+	t.Run("unknown policy fails", func(t *testing.T) {
+		if _, err := (SessionOptions{HostKeyPolicy: "sometimes"}).hostKeyPrompt(); err == nil {
+			t.Fatalf("expected error for unknown policy")
+		}
+	})
+}
+
+func TestRunContext(t *testing.T) {
+	server := startForwardingServer(t, "secret")
+	session := newTestSession(t, server)
+
+	t.Run("returns output", func(t *testing.T) {
+		output, err := session.RunContext(context.Background(), "hostname")
+		if err != nil || output != "hostname" {
+			t.Fatalf("expected echoed command, got %q/%v", output, err)
+		}
+	})
+
+	t.Run("cancellation interrupts the remote process", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err := session.RunContext(ctx, "block")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		waitForSignal(t, server, "INT")
+	})
+
+	t.Run("CommandTimeout bounds RunStream", func(t *testing.T) {
+		session.CommandTimeout = 50 * time.Millisecond
+		t.Cleanup(func() { session.CommandTimeout = 0 })
+
+		err := session.RunStream("block", &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "command timed out after 50ms") {
+			t.Fatalf("expected timeout error, got %v", err)
+		}
+	})
+}
+
+func waitForSignal(t *testing.T, server *forwardingServer, signal string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, got := range server.received() {
+			if got == signal {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server never received SIG%s, got %v", signal, server.received())
+}
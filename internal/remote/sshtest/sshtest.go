@@ -0,0 +1,227 @@
+// Package sshtest runs an in-process SSH server on localhost for tests that
+// exercise real sessions without a network. Tests register canned responses
+// per command, exactly or by regular expression, and inspect the commands the
+// server received afterwards.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Default credentials accepted by a new Server.
+const (
+	DefaultUser     = "tester"
+	DefaultPassword = "sshtest"
+)
+
+// Response is what the server answers a command with.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Server is an SSH server that answers exec requests with canned responses.
+// Commands without a registered response exit with status 127 and a
+// "command not found" message, like a shell would.
+type Server struct {
+	// User and Password are the only credentials the server accepts.
+	User     string
+	Password string
+	// HostKey is the server's ed25519 host key.
+	HostKey ssh.PublicKey
+
+	listener net.Listener
+
+	mu       sync.Mutex
+	handlers []handler
+	commands []string
+}
+
+type handler struct {
+	command  string
+	pattern  *regexp.Regexp
+	response Response
+}
+
+func (h handler) matches(command string) bool {
+	if h.pattern != nil {
+		return h.pattern.MatchString(command)
+	}
+	return h.command == command
+}
+
+// NewServer starts a server on a loopback port. It is closed when the test
+// finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("sshtest: generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("sshtest: host signer: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("sshtest: listen: %v", err)
+	}
+
+	s := &Server{
+		User:     DefaultUser,
+		Password: DefaultPassword,
+		HostKey:  signer.PublicKey(),
+		listener: listener,
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if meta.User() == s.User && string(given) == s.Password {
+				return nil, nil
+			}
+			return nil, errors.New("sshtest: wrong user or password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the address the server listens on, without the port.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// Close stops accepting connections.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Handle answers command, matched exactly, with response. Later
+// registrations take precedence over earlier ones.
+func (s *Server) Handle(command string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handler{command: command, response: response})
+}
+
+// HandleRegexp answers every command matching pattern with response. It
+// panics if pattern does not compile. Later registrations take precedence
+// over earlier ones.
+func (s *Server) HandleRegexp(pattern string, response Response) {
+	re := regexp.MustCompile(pattern)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handler{pattern: re, response: response})
+}
+
+// Commands returns the commands received so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// respond records command and looks up its response.
+func (s *Server) respond(command string) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, command)
+	for i := len(s.handlers) - 1; i >= 0; i-- {
+		if s.handlers[i].matches(command) {
+			return s.handlers[i].response
+		}
+	}
+	return Response{Stderr: fmt.Sprintf("sh: 1: %s: not found\n", command), ExitCode: 127}
+}
+
+func (s *Server) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "sshtest only serves sessions")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+// session answers the first exec request on a channel and closes it.
+func (s *Server) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	// Drain stdin, such as a sudo password, so the client never blocks
+	// writing it.
+	go io.Copy(io.Discard, channel)
+
+	for req := range requests {
+		if req.Type != "exec" {
+			// env, pty-req and signals are accepted and ignored.
+			req.Reply(req.Type == "env" || req.Type == "pty-req" || req.Type == "signal", nil)
+			continue
+		}
+
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		response := s.respond(payload.Command)
+		io.WriteString(channel, response.Stdout)
+		io.WriteString(channel.Stderr(), response.Stderr)
+
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, uint32(response.ExitCode))
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
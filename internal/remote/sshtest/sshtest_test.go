@@ -0,0 +1,88 @@
+package sshtest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func dial(t *testing.T, server *Server, password string) (*ssh.Client, error) {
+	t.Helper()
+	return ssh.Dial("tcp", server.Addr(), &ssh.ClientConfig{
+		User:            server.User,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.FixedHostKey(server.HostKey),
+	})
+}
+
+func run(t *testing.T, client *ssh.Client, command string) (string, string, int) {
+	t.Helper()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	err = session.Run(command)
+
+	var exitErr *ssh.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return stdout.String(), stderr.String(), exitErr.ExitStatus()
+	case err != nil:
+		t.Fatalf("run %q: %v", command, err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer(t)
+	server.Handle("uptime", Response{Stdout: "up 3 days\n"})
+	server.HandleRegexp(`^systemctl is-active `, Response{Stdout: "active\n"})
+	server.Handle("systemctl is-active pihole", Response{Stdout: "inactive\n", Stderr: "unit failed\n", ExitCode: 3})
+
+	if _, err := dial(t, server, "wrong"); err == nil {
+		t.Fatal("expected a wrong password to be rejected")
+	}
+	client, err := dial(t, server, server.Password)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		command  string
+		stdout   string
+		stderr   string
+		exitCode int
+	}{
+		{command: "uptime", stdout: "up 3 days\n"},
+		{command: "systemctl is-active microk8s", stdout: "active\n"},
+		{command: "systemctl is-active pihole", stdout: "inactive\n", stderr: "unit failed\n", exitCode: 3},
+		{command: "kubectl version", stderr: "sh: 1: kubectl version: not found\n", exitCode: 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			stdout, stderr, exitCode := run(t, client, tt.command)
+			if stdout != tt.stdout || stderr != tt.stderr || exitCode != tt.exitCode {
+				t.Fatalf("got %q/%q/%d, want %q/%q/%d", stdout, stderr, exitCode, tt.stdout, tt.stderr, tt.exitCode)
+			}
+		})
+	}
+
+	commands := server.Commands()
+	if len(commands) != len(tests) {
+		t.Fatalf("expected %d recorded commands, got %q", len(tests), commands)
+	}
+	for i, tt := range tests {
+		if commands[i] != tt.command {
+			t.Errorf("command %d = %q, want %q", i, commands[i], tt.command)
+		}
+	}
+}
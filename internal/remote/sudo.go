@@ -0,0 +1,150 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SudoMode selects how commands that need root are run on a host.
+type SudoMode string
+
+const (
+	// SudoAuto uses SudoPassword when a password is cached, SudoNoPasswd otherwise.
+	SudoAuto SudoMode = ""
+	// SudoNoPasswd runs sudo -n, failing fast instead of waiting for a password.
+	SudoNoPasswd SudoMode = "nopasswd"
+	// SudoPassword runs sudo -S and feeds the cached password on stdin.
+	SudoPassword SudoMode = "password"
+	// SudoNone runs commands as the login user, e.g. when logging in as root.
+	SudoNone SudoMode = "none"
+)
+
+var (
+	// ErrSudoPassword reports that sudo rejected the cached password.
+	ErrSudoPassword = errors.New("sudo rejected the password")
+	// ErrSudoPasswordRequired reports that sudo wanted a password in nopasswd mode.
+	ErrSudoPasswordRequired = errors.New("sudo requires a password")
+)
+
+// RunSudo is RunContext for a command that must run as root.
+func (s *SSHSession) RunSudo(ctx context.Context, cmd string) (string, error) {
+	return combinedOutput(s.ExecSudo(ctx, cmd))
+}
+
+// ExecSudo is Exec for a command that must run as root. cmd is run through
+// sh -c, so it may be a pipeline and must not start with sudo itself.
+func (s *SSHSession) ExecSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	start := time.Now()
+	result, err := s.execSudo(ctx, cmd)
+	s.audit(cmd, true, start, result, err)
+	return result, err
+}
+
+func (s *SSHSession) execSudo(ctx context.Context, cmd string) (*RunResult, error) {
+	if s.daemon != nil {
+		return s.daemon.exec(ctx, s, cmd, true)
+	}
+	wrapped, stdin, err := s.sudoCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureConnected(ctx); err != nil {
+		return nil, err
+	}
+
+	result, err := s.exec(ctx, wrapped, stdin)
+	if result != nil {
+		result.Command = cmd
+	}
+	return result, s.sudoError(err)
+}
+
+// RunStreamSudo is RunStreamContext for a command that must run as root.
+func (s *SSHSession) RunStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	start := time.Now()
+	err := s.runStreamSudo(ctx, cmd, w)
+	s.auditStream(cmd, true, start, err)
+	return err
+}
+
+func (s *SSHSession) runStreamSudo(ctx context.Context, cmd string, w io.Writer) error {
+	if s.daemon != nil {
+		return s.daemon.stream(ctx, s, cmd, true, w)
+	}
+	wrapped, stdin, err := s.sudoCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureConnected(ctx); err != nil {
+		return err
+	}
+	return s.sudoError(s.runStream(ctx, wrapped, stdin, w))
+}
+
+// sudoCommand wraps cmd for the session's sudo mode and returns what to feed
+// on stdin.
+func (s *SSHSession) sudoCommand(cmd string) (string, io.Reader, error) {
+	script := "sh -c " + ShellQuote(cmd)
+
+	switch s.sudoMode() {
+	case SudoNone:
+		return script, nil, nil
+	case SudoNoPasswd:
+		return "sudo -n -- " + script, nil, nil
+	case SudoPassword:
+		password := s.sudoPassword()
+		if password == "" {
+			return "", nil, fmt.Errorf("sudo mode %q needs a password but none is cached for %s@%s (log in again)", SudoPassword, s.User, s.Host)
+		}
+		// -k ignores a cached sudo timestamp so the password line is always
+		// consumed by sudo rather than passed on to the command.
+		return "sudo -k -S -p '' -- " + script, strings.NewReader(password + "\n"), nil
+	default:
+		return "", nil, fmt.Errorf("unknown sudo mode %q", s.Sudo)
+	}
+}
+
+func (s *SSHSession) sudoMode() SudoMode {
+	if s.Sudo != SudoAuto {
+		return s.Sudo
+	}
+	if s.sudoPassword() != "" {
+		return SudoPassword
+	}
+	return SudoNoPasswd
+}
+
+// sudoPassword prefers a dedicated sudo password over the login password.
+func (s *SSHSession) sudoPassword() string {
+	if s.SudoPassword != "" {
+		return s.SudoPassword
+	}
+	return s.Password
+}
+
+// sudoError recognises sudo's own failures in a command error.
+func (s *SSHSession) sudoError(err error) error {
+	return sudoFailure(err, s.User, s.Host)
+}
+
+// sudoFailure wraps err with ErrSudoPassword or ErrSudoPasswordRequired when
+// stderr shows sudo itself failed for user on host.
+func sudoFailure(err error, user, host string) error {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return err
+	}
+
+	stderr := cmdErr.Result.Stderr
+	switch {
+	case strings.Contains(stderr, "incorrect password attempt"), strings.Contains(stderr, "Sorry, try again"):
+		return fmt.Errorf("%w for %s@%s: %w", ErrSudoPassword, user, host, err)
+	case strings.Contains(stderr, "a password is required"):
+		return fmt.Errorf("%w on %s (set 'sudo: password' for this host): %w", ErrSudoPasswordRequired, host, err)
+	}
+	return err
+}
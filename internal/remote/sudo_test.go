@@ -0,0 +1,122 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSudoCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		session   *SSHSession
+		want      string
+		wantStdin string
+		wantErr   bool
+	}{
+		{
+			name:    "auto without password uses nopasswd",
+			session: &SSHSession{},
+			want:    "sudo -n -- sh -c 'ls /root'",
+		},
+		{
+			name:      "auto with login password feeds it on stdin",
+			session:   &SSHSession{Password: "secret"},
+			want:      "sudo -k -S -p '' -- sh -c 'ls /root'",
+			wantStdin: "secret\n",
+		},
+		{
+			name:      "sudo password wins over login password",
+			session:   &SSHSession{Sudo: SudoPassword, Password: "login", SudoPassword: "root"},
+			want:      "sudo -k -S -p '' -- sh -c 'ls /root'",
+			wantStdin: "root\n",
+		},
+		{
+			name:    "nopasswd ignores a cached password",
+			session: &SSHSession{Sudo: SudoNoPasswd, Password: "secret"},
+			want:    "sudo -n -- sh -c 'ls /root'",
+		},
+		{
+			name:    "none runs as the login user",
+			session: &SSHSession{Sudo: SudoNone},
+			want:    "sh -c 'ls /root'",
+		},
+		{
+			name:    "password mode without a password",
+			session: &SSHSession{Sudo: SudoPassword},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			session: &SSHSession{Sudo: "doas"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stdin, err := tt.session.sudoCommand("ls /root")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sudoCommand: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("command = %q, want %q", got, tt.want)
+			}
+
+			var gotStdin string
+			if stdin != nil {
+				data, _ := io.ReadAll(stdin)
+				gotStdin = string(data)
+			}
+			if gotStdin != tt.wantStdin {
+				t.Errorf("stdin = %q, want %q", gotStdin, tt.wantStdin)
+			}
+		})
+	}
+
+	t.Run("quotes single quotes in the command", func(t *testing.T) {
+		session := &SSHSession{Sudo: SudoNone}
+		got, _, _ := session.sudoCommand("echo 'hi'")
+		if want := `sh -c 'echo '\''hi'\'''`; got != want {
+			t.Errorf("command = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSudoError(t *testing.T) {
+	session := &SSHSession{Host: "pi.local", User: "pi"}
+
+	tests := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{name: "wrong password", stderr: "Sorry, try again.\nsudo: 1 incorrect password attempt\n", want: ErrSudoPassword},
+		{name: "password required", stderr: "sudo: a password is required\n", want: ErrSudoPasswordRequired},
+		{name: "command failure", stderr: "ls: cannot access '/nope'\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdErr := &CommandError{Result: &RunResult{Stderr: tt.stderr, ExitCode: 1}, Err: errors.New("exit status 1")}
+			err := session.sudoError(cmdErr)
+
+			var unwrapped *CommandError
+			if !errors.As(err, &unwrapped) {
+				t.Fatalf("expected the CommandError to stay reachable, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if tt.want == nil && err != error(cmdErr) {
+				t.Fatalf("expected the error unchanged, got %v", err)
+			}
+		})
+	}
+}
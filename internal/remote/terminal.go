@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultTerm is the TERM requested for a PTY when none is given.
+const DefaultTerm = "xterm-256color"
+
+// ExitSignaled is the status reported when the remote process was killed by
+// a signal, matching what OpenSSH's client exits with.
+const ExitSignaled = 255
+
+// TerminalSize is a terminal's width and height in character cells.
+type TerminalSize struct {
+	Width  int
+	Height int
+}
+
+// TerminalOptions configures an interactive session started by Terminal.
+type TerminalOptions struct {
+	// Command runs instead of the login shell when set.
+	Command string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// PTY requests a pseudo-terminal of type Term (DefaultTerm when empty)
+	// and the given Size. Without one the remote side sees plain pipes, as
+	// with ssh -T.
+	PTY  bool
+	Term string
+	Size TerminalSize
+	// Resize delivers new sizes while the session runs, e.g. on SIGWINCH.
+	Resize <-chan TerminalSize
+}
+
+// Terminal runs the login shell, or opts.Command, wired to the given streams
+// and returns its exit status. Unlike Exec it ignores CommandTimeout, since
+// an interactive session has no natural bound; cancelling ctx interrupts the
+// remote process and closes the channel. An error means the session could
+// not start or ended without an exit status, in which case the status is -1.
+func (s *SSHSession) Terminal(ctx context.Context, opts TerminalOptions) (int, error) {
+	start := time.Now()
+	status, err := s.terminal(ctx, opts)
+	s.audit(opts.Command, false, start, &RunResult{ExitCode: status}, err)
+	return status, err
+}
+
+func (s *SSHSession) terminal(ctx context.Context, opts TerminalOptions) (int, error) {
+	if err := s.ensureConnected(ctx); err != nil {
+		return -1, err
+	}
+	client, err := s.client()
+	if err != nil {
+		return -1, fmt.Errorf("failed to create session: %w", err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if opts.PTY {
+		termType := opts.Term
+		if termType == "" {
+			termType = DefaultTerm
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, opts.Size.Height, opts.Size.Width, modes); err != nil {
+			return -1, fmt.Errorf("request pty: %w", err)
+		}
+	}
+
+	if opts.Command != "" {
+		err = session.Start(opts.Command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to start remote shell: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	resize := opts.Resize
+	for {
+		select {
+		case err := <-done:
+			return exitStatus(err)
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil
+				continue
+			}
+			session.WindowChange(size.Height, size.Width)
+		case <-ctx.Done():
+			session.Signal(ssh.SIGINT)
+			session.Close()
+			return -1, context.Cause(ctx)
+		}
+	}
+}
+
+// exitStatus turns the result of session.Wait into an exit code.
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.Signal() != "" {
+			return ExitSignaled, nil
+		}
+		return exitErr.ExitStatus(), nil
+	}
+	return -1, fmt.Errorf("remote session ended without an exit status: %w", err)
+}
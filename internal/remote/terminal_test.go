@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionTerminal(t *testing.T) {
+	server := startForwardingServer(t, "secret")
+	session := newTestSession(t, server)
+
+	t.Run("shell with a pty follows resizes", func(t *testing.T) {
+		stdin, input := io.Pipe()
+		var stdout syncBuffer
+		resize := make(chan TerminalSize, 1)
+
+		type outcome struct {
+			status int
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			status, err := session.Terminal(context.Background(), TerminalOptions{
+				Stdin:  stdin,
+				Stdout: &stdout,
+				PTY:    true,
+				Term:   "xterm",
+				Size:   TerminalSize{Width: 80, Height: 24},
+				Resize: resize,
+			})
+			done <- outcome{status, err}
+		}()
+
+		io.WriteString(input, "hello\n")
+		resize <- TerminalSize{Width: 120, Height: 40}
+		waitFor(t, func() bool { return slices.Contains(server.terminal(), "resize 120x40") })
+		input.Close()
+
+		select {
+		case got := <-done:
+			if got.err != nil || got.status != 0 {
+				t.Fatalf("Terminal = %d, %v; want 0, nil", got.status, got.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Terminal did not return after stdin closed")
+		}
+		if !strings.Contains(stdout.String(), "hello") {
+			t.Fatalf("stdout = %q, want the echoed input", stdout.String())
+		}
+		if got := server.terminal(); got[0] != "pty xterm 80x24" {
+			t.Fatalf("terminal requests = %v", got)
+		}
+	})
+
+	t.Run("command exit status is returned", func(t *testing.T) {
+		var stderr bytes.Buffer
+		status, err := session.Terminal(context.Background(), TerminalOptions{
+			Command: "exit 3",
+			Stdout:  io.Discard,
+			Stderr:  &stderr,
+		})
+		if err != nil {
+			t.Fatalf("Terminal: %v", err)
+		}
+		if status != 3 {
+			t.Fatalf("status = %d, want 3", status)
+		}
+		if !strings.Contains(stderr.String(), "exit 3 failed") {
+			t.Fatalf("stderr = %q", stderr.String())
+		}
+	})
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}